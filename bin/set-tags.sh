@@ -10,14 +10,17 @@
 # a6ff589a-33e5-4caf-8286-29dea98fc2e2 travel
 # 89e105c9-2c45-42a9-a5f0-fc1ea6e7ba8b outdoors
 
-if [[ $# -eq 0 ]] ; then
-  echo "Usage: $0 [tripbot-server-url]"
+# this requires an API key with the tokens:read permission, create one with:
+#   tripbot apikey create set-tags tokens:read
+
+if [[ $# -eq 0 ]] || [[ -z "$TRIPBOT_API_KEY" ]]; then
+  echo "Usage: TRIPBOT_API_KEY=... $0 [tripbot-server-url]"
   exit 0
 fi
 
 SERVER_URL=$1
 
-RESP=$(curl -s "$SERVER_URL/auth/twitch?auth=yes")
+RESP=$(curl -s -H "Authorization: Bearer $TRIPBOT_API_KEY" "$SERVER_URL/auth/twitch")
 echo "$RESP" | jq
 
 # extract the fields from the response
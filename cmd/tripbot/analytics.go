@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/analytics"
+)
+
+// runAnalyticsCommand prints a viewer report,
+// it's run instead of the bot with "tripbot analytics [days]"
+func runAnalyticsCommand(args []string) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -reportDays(args, "analytics"))
+	report, err := analytics.Generate(from, to)
+	exitIfError(err)
+	fmt.Print(report)
+}
+
+// runGuessesCommand prints a report of the states people guess wrong,
+// it's run instead of the bot with "tripbot guesses [days]"
+func runGuessesCommand(args []string) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -reportDays(args, "guesses"))
+	report, err := analytics.GenerateGuessReport(from, to)
+	exitIfError(err)
+	fmt.Print(report)
+}
+
+// reportDays reads the optional number of days for a report (default 30)
+func reportDays(args []string, subcommand string) int {
+	if len(args) == 0 {
+		return 30
+	}
+	days, err := strconv.Atoi(args[0])
+	if err != nil || days < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: tripbot %s [days]\n", subcommand)
+		os.Exit(1)
+	}
+	return days
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adanalife/tripbot/pkg/apikeys"
+)
+
+const apiKeyUsage = `Usage:
+  tripbot apikey create <name> <permission,...>
+  tripbot apikey rotate <name>
+  tripbot apikey revoke <name>
+  tripbot apikey list
+
+Permissions: %s
+`
+
+// runAPIKeyCommand manages the API keys used by supporting scripts,
+// it's run instead of the bot with "tripbot apikey ..."
+func runAPIKeyCommand(args []string) {
+	if len(args) == 0 {
+		apiKeyUsageAndExit()
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 {
+			apiKeyUsageAndExit()
+		}
+		key, err := apikeys.Create(args[1], strings.Split(args[2], ","))
+		exitIfError(err)
+		fmt.Println("created key (this is the only time it will be shown):")
+		fmt.Println(key)
+
+	case "rotate":
+		if len(args) != 2 {
+			apiKeyUsageAndExit()
+		}
+		key, err := apikeys.Rotate(args[1])
+		exitIfError(err)
+		fmt.Println("rotated key, the old one no longer works (this is the only time it will be shown):")
+		fmt.Println(key)
+
+	case "revoke":
+		if len(args) != 2 {
+			apiKeyUsageAndExit()
+		}
+		exitIfError(apikeys.Revoke(args[1]))
+		fmt.Println("revoked key", args[1])
+
+	case "list":
+		keys, err := apikeys.List()
+		exitIfError(err)
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+
+	default:
+		apiKeyUsageAndExit()
+	}
+}
+
+// apiKeyUsageAndExit prints the usage and exits
+func apiKeyUsageAndExit() {
+	fmt.Fprintf(os.Stderr, apiKeyUsage, strings.Join(apikeys.Permissions, ", "))
+	os.Exit(1)
+}
+
+// exitIfError prints the error and exits if there is one
+func exitIfError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
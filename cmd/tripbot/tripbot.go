@@ -9,14 +9,19 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/adanalife/tripbot/pkg/announcements"
 	"github.com/adanalife/tripbot/pkg/background"
 	"github.com/adanalife/tripbot/pkg/chatbot"
+	"github.com/adanalife/tripbot/pkg/commands"
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
 	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/miles"
 	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
 	"github.com/adanalife/tripbot/pkg/server"
+	"github.com/adanalife/tripbot/pkg/trivia"
 	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
 	"github.com/adanalife/tripbot/pkg/users"
 	"github.com/adanalife/tripbot/pkg/video"
@@ -30,17 +35,41 @@ var client *twitch.Client
 
 // main performs the various steps to get the bot running
 func main() {
+	// the admin subcommands log errors too
+	initializeErrorLogger()
+
+	// admin subcommands run instead of the bot
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "apikey":
+			runAPIKeyCommand(os.Args[2:])
+			return
+		case "analytics":
+			runAnalyticsCommand(os.Args[2:])
+			return
+		case "guesses":
+			runGuessesCommand(os.Args[2:])
+			return
+		}
+	}
+
 	createRandomSeed()
 	listenForShutdown()
-	initializeErrorLogger()
+	startEventWriter()
+	reconcileSessions() // before anything can log people in
 	startHttpServer()
 	findInitialVideo()
+	loadMilesRules()
+	loadTrivia()
+	loadCustomCommands()
+	syncHelpAnnouncements()
 	users.InitLeaderboard()
+	users.InitRoles()
 	startCron()
 	setUpTwitchClient() // required for the below
 	updateSubscribers()
 	getCurrentUsers()
-	updateWebhookSubscriptions()
+	updateEventSubSubscriptions()
 	connectToTwitch()
 }
 
@@ -62,6 +91,11 @@ func initializeErrorLogger() {
 	terrors.Initialize(c.Conf)
 }
 
+// startEventWriter starts writing login/logout events to the DB in batches
+func startEventWriter() {
+	events.StartWriter()
+}
+
 // startHttpServer starts a webserver, which is
 // used for admin tools and receiving webhooks
 func startHttpServer() {
@@ -80,6 +114,58 @@ func findInitialVideo() {
 	}
 }
 
+// loadMilesRules loads the rules used to give out bonus miles
+func loadMilesRules() {
+	err := miles.LoadRules(c.Conf.MilesRulesFile)
+	if err != nil {
+		terrors.Log(err, "error loading miles rules, using defaults")
+	}
+	// the rules need to know the time of day in the footage,
+	// but the miles package can't import video
+	miles.FootageTime = func() (time.Time, error) {
+		vid := video.CurrentlyPlaying
+		if vid.Flagged {
+			vid = vid.Next()
+		}
+		lat, lng, err := vid.Location()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return helpers.ActualDate(vid.DateFilmed, lat, lng), nil
+	}
+}
+
+// loadTrivia loads the trivia question bank
+func loadTrivia() {
+	err := trivia.LoadBank(c.Conf.TriviaFile)
+	if err != nil {
+		terrors.Log(err, "error loading trivia, only using generated questions")
+	}
+}
+
+// loadCustomCommands loads the commands that were added in chat
+func loadCustomCommands() {
+	err := commands.Load()
+	if err != nil {
+		terrors.Log(err, "error loading custom commands")
+	}
+}
+
+// syncHelpAnnouncements posts the help messages as announcements,
+// one of them goes out every few hours if chat is active
+func syncHelpAnnouncements() {
+	err := announcements.SyncBuiltin(c.HelpMessages, 3*time.Hour, 5)
+	if err != nil {
+		terrors.Log(err, "error syncing help announcements")
+	}
+}
+
+// reconcileSessions cleans up sessions left over from a crash,
+// it has to run before anyone is logged in
+func reconcileSessions() {
+	users.ReconcileSessions()
+}
+
 // startCron starts the background workers
 func startCron() {
 	// start cron and attach cronjobs
@@ -97,7 +183,7 @@ func setUpTwitchClient() {
 // updateSubscribers gets the list of current subscribers
 func updateSubscribers() {
 	// update subscribers list
-	mytwitch.GetSubscribers()
+	users.UpdateSubscribers()
 }
 
 // getCurrentUsers gets the users watching the stream
@@ -107,10 +193,10 @@ func getCurrentUsers() {
 	users.PrintCurrentSession()
 }
 
-//updateWebhookSubscriptions makes sure webhooks are being sent to the bot
-func updateWebhookSubscriptions() {
-	// create webhook subscriptions
-	mytwitch.UpdateWebhookSubscriptions()
+// updateEventSubSubscriptions makes sure EventSub notifications are being sent to the bot
+func updateEventSubSubscriptions() {
+	// create eventsub subscriptions
+	mytwitch.UpdateEventSubSubscriptions()
 }
 
 // connectToTwitch joins Twitch chat and starts listening
@@ -145,6 +231,8 @@ func gracefulShutdown() {
 	//TODO: print different message if CurrentlyPlaying is ""
 	log.Printf("Last played video: %s", aurora.Yellow(video.CurrentlyPlaying.File()))
 	users.Shutdown()
+	// write any events that are still buffered
+	events.StopWriter()
 	err := database.Connection().Close()
 	if err != nil {
 		terrors.Log(err, "error closing DB connection")
@@ -160,16 +248,24 @@ func gracefulShutdown() {
 func scheduleBackgroundJobs() {
 	var err error
 
+	// the monthly rollover congratulates the winners in chat,
+	// and the scheduled announcements are posted with it too
+	background.Announce = chatbot.Say
+
 	// schedule these functions
 	err = background.Cron.AddFunc("@every 60s", video.GetCurrentlyPlaying)
 	err = background.Cron.AddFunc("@every 61s", users.UpdateSession)
 	err = background.Cron.AddFunc("@every 62s", users.UpdateLeaderboard)
+	err = background.Cron.AddFunc("@every 1m", background.PostAnnouncements)
+	err = background.Cron.AddFunc("@every 2m", users.CheckpointSession)
 	err = background.Cron.AddFunc("@every 5m", onscreensClient.ShowGuessLeaderboard)
 	err = background.Cron.AddFunc("@every 5m", users.PrintCurrentSession)
-	err = background.Cron.AddFunc("@every 5m", mytwitch.GetSubscribers)
-	err = background.Cron.AddFunc("@every 1h", mytwitch.RefreshUserAccessToken)
-	err = background.Cron.AddFunc("@every 2h57m30s", chatbot.Chatter)
-	err = background.Cron.AddFunc("@every 12h", mytwitch.UpdateWebhookSubscriptions)
+	err = background.Cron.AddFunc("@every 5m", users.UpdateSubscribers)
+	err = background.Cron.AddFunc("@every 5m", mytwitch.RefreshUserAccessTokenIfNecessary)
+	err = background.Cron.AddFunc("@every 1h", mytwitch.ValidateUserAccessToken)
+	err = background.Cron.AddFunc("@every 1h", background.MonthlyRollover)
+	err = background.Cron.AddFunc("@every 23m", chatbot.AskTrivia)
+	err = background.Cron.AddFunc("@every 12h", mytwitch.UpdateEventSubSubscriptions)
 	if !helpers.RunningOnWindows() {
 		err = background.Cron.AddFunc("@every 12h", mytwitch.SetStreamTags)
 	}
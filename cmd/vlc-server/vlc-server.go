@@ -59,6 +59,7 @@ func createOnscreens() {
 	onscreensServer.InitMiddleText()
 	onscreensServer.InitTimewarp()
 	onscreensServer.InitLeaderboard()
+	onscreensServer.InitGeoGuess()
 	onscreensServer.InitFlagImage()
 }
 
@@ -0,0 +1,8 @@
+CREATE TABLE miles_ledger (
+  id            SERIAL PRIMARY KEY,
+  user_id       INTEGER NOT NULL REFERENCES users(id),
+  amount        REAL NOT NULL, /* positive when earned, negative when spent */
+  reason        VARCHAR(64) NOT NULL,
+  date_created  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX miles_ledger_user_id_idx ON miles_ledger (user_id);
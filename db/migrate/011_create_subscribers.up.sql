@@ -0,0 +1,10 @@
+CREATE TABLE subscribers (
+  id                SERIAL PRIMARY KEY,
+  user_id           INTEGER UNIQUE NOT NULL REFERENCES users(id),
+  tier              INTEGER NOT NULL DEFAULT 1,
+  is_gift           BOOLEAN NOT NULL DEFAULT FALSE,
+  gifter            VARCHAR(64),
+  cumulative_months INTEGER NOT NULL DEFAULT 0,
+  date_created      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_updated      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+CREATE TABLE twitch_tokens (
+  id             SERIAL PRIMARY KEY,
+  scopes         VARCHAR(512) UNIQUE NOT NULL,
+  access_token   TEXT NOT NULL, /* encrypted */
+  refresh_token  TEXT NOT NULL, /* encrypted */
+  expires_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+  date_created   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_updated   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
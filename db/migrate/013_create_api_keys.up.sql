@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+  id           SERIAL PRIMARY KEY,
+  name         VARCHAR(64) UNIQUE NOT NULL,
+  key_hash     VARCHAR(64) UNIQUE NOT NULL, /* sha256 of the key */
+  permissions  VARCHAR(256) NOT NULL DEFAULT '',
+  revoked      BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used    TIMESTAMP WITH TIME ZONE,
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
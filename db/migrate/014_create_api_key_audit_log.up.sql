@@ -0,0 +1,9 @@
+CREATE TABLE api_key_audit_log (
+  id           SERIAL PRIMARY KEY,
+  api_key_id   INTEGER REFERENCES api_keys(id),
+  permission   VARCHAR(64) NOT NULL,
+  path         VARCHAR(256) NOT NULL,
+  remote_addr  VARCHAR(64) NOT NULL,
+  allowed      BOOLEAN NOT NULL,
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
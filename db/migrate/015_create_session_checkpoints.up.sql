@@ -0,0 +1,9 @@
+CREATE TABLE session_checkpoints (
+  id           SERIAL PRIMARY KEY,
+  user_id      INTEGER UNIQUE NOT NULL REFERENCES users(id),
+  username     VARCHAR(64) NOT NULL,
+  logged_in_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  miles        REAL NOT NULL DEFAULT 0.0, /* session miles saved so far */
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS events_event_date_created_idx;
+ALTER TABLE events DROP COLUMN IF EXISTS payload;
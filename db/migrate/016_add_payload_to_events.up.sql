@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN payload JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX events_event_date_created_idx ON events (event, date_created);
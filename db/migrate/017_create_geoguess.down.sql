@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS geoguess_guesses;
+DROP TABLE IF EXISTS geoguess_rounds;
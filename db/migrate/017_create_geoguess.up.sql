@@ -0,0 +1,19 @@
+CREATE TABLE geoguess_rounds (
+  id           SERIAL PRIMARY KEY,
+  video_slug   VARCHAR(64) NOT NULL,
+  lat          DOUBLE PRECISION NOT NULL,
+  lng          DOUBLE PRECISION NOT NULL,
+  date_started TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_ended   TIMESTAMP WITH TIME ZONE
+);
+CREATE TABLE geoguess_guesses (
+  id           SERIAL PRIMARY KEY,
+  round_id     INTEGER NOT NULL REFERENCES geoguess_rounds(id),
+  username     VARCHAR(64) NOT NULL,
+  lat          DOUBLE PRECISION NOT NULL,
+  lng          DOUBLE PRECISION NOT NULL,
+  distance     DOUBLE PRECISION NOT NULL, /* in miles */
+  points       REAL NOT NULL DEFAULT 0.0,
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (round_id, username)
+);
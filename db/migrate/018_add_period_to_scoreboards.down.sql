@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS scoreboards_kind_period_idx;
+ALTER TABLE scoreboards
+  DROP COLUMN IF EXISTS kind,
+  DROP COLUMN IF EXISTS period,
+  DROP COLUMN IF EXISTS period_start;
@@ -0,0 +1,16 @@
+ALTER TABLE scoreboards
+  ADD COLUMN kind VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN period VARCHAR(16) NOT NULL DEFAULT 'all-time',
+  ADD COLUMN period_start DATE;
+
+/* existing boards have the period in the name (ex: miles_2024_05) */
+UPDATE scoreboards SET
+  kind = substring(name from '^(.*)_\d{4}_\d{2}$'),
+  period = 'monthly',
+  period_start = to_date(substring(name from '(\d{4}_\d{2})$'), 'YYYY_MM')
+  WHERE name ~ '_\d{4}_\d{2}$';
+UPDATE scoreboards SET kind = substring(name from '^(.*)_total$')
+  WHERE name ~ '_total$';
+UPDATE scoreboards SET kind = name WHERE kind = '';
+
+CREATE INDEX scoreboards_kind_period_idx ON scoreboards (kind, period, period_start);
@@ -0,0 +1 @@
+ALTER TABLE scores DROP CONSTRAINT IF EXISTS scores_user_id_scoreboard_id_key;
@@ -0,0 +1,13 @@
+/* merge any duplicate scores into the oldest row before adding the constraint */
+UPDATE scores SET value = dupes.total
+  FROM (
+    SELECT MIN(id) AS id, SUM(value) AS total FROM scores
+    GROUP BY user_id, scoreboard_id HAVING COUNT(*) > 1
+  ) dupes
+  WHERE scores.id = dupes.id;
+DELETE FROM scores USING scores oldest
+  WHERE scores.user_id = oldest.user_id
+  AND scores.scoreboard_id = oldest.scoreboard_id
+  AND scores.id > oldest.id;
+
+ALTER TABLE scores ADD CONSTRAINT scores_user_id_scoreboard_id_key UNIQUE (user_id, scoreboard_id);
@@ -0,0 +1,15 @@
+CREATE TABLE leaderboard_winners (
+  id              SERIAL PRIMARY KEY,
+  scoreboard_id   INTEGER NOT NULL REFERENCES scoreboards(id),
+  scoreboard_name VARCHAR(64) NOT NULL,
+  kind            VARCHAR(64) NOT NULL,
+  period_start    DATE,
+  rank            INTEGER NOT NULL,
+  user_id         INTEGER NOT NULL REFERENCES users(id),
+  username        VARCHAR(64) NOT NULL,
+  value           REAL NOT NULL,
+  bonus_miles     REAL NOT NULL DEFAULT 0.0,
+  date_created    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (scoreboard_id, user_id)
+);
+CREATE INDEX leaderboard_winners_kind_idx ON leaderboard_winners (kind, period_start);
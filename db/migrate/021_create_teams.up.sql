@@ -0,0 +1,24 @@
+CREATE TABLE teams (
+  id           SERIAL PRIMARY KEY,
+  name         VARCHAR(64) NOT NULL UNIQUE,
+  title        VARCHAR(64) NOT NULL,
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO teams (name, title) VALUES ('east', 'East Coast'), ('west', 'West Coast');
+CREATE TABLE team_seasons (
+  id             SERIAL PRIMARY KEY,
+  starts_at      TIMESTAMP WITH TIME ZONE NOT NULL UNIQUE,
+  ends_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  winner_team_id INTEGER REFERENCES teams(id),
+  date_ended     TIMESTAMP WITH TIME ZONE,
+  date_created   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE team_members (
+  id           SERIAL PRIMARY KEY,
+  season_id    INTEGER NOT NULL REFERENCES team_seasons(id),
+  team_id      INTEGER NOT NULL REFERENCES teams(id),
+  user_id      INTEGER NOT NULL REFERENCES users(id),
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (season_id, user_id)
+);
+CREATE INDEX team_members_team_idx ON team_members (season_id, team_id);
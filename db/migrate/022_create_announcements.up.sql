@@ -0,0 +1,10 @@
+CREATE TABLE announcements (
+  id                SERIAL PRIMARY KEY,
+  message           TEXT NOT NULL,
+  schedule          VARCHAR(64) NOT NULL, /* cron expression or @every interval */
+  min_chat_messages INTEGER NOT NULL DEFAULT 0,
+  enabled           BOOLEAN NOT NULL DEFAULT true,
+  created_by        VARCHAR(64) NOT NULL,
+  last_posted_at    TIMESTAMP WITH TIME ZONE,
+  date_created      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
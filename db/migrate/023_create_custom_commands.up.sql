@@ -0,0 +1,10 @@
+CREATE TABLE custom_commands (
+  id               SERIAL PRIMARY KEY,
+  name             VARCHAR(64) NOT NULL UNIQUE, /* without the ! */
+  response         TEXT NOT NULL,
+  cooldown_seconds INTEGER NOT NULL DEFAULT 30,
+  created_by       VARCHAR(64) NOT NULL,
+  updated_by       VARCHAR(64) NOT NULL,
+  date_created     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  date_updated     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
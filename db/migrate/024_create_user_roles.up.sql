@@ -0,0 +1,7 @@
+CREATE TABLE user_roles (
+  id           SERIAL PRIMARY KEY,
+  user_id      INTEGER NOT NULL UNIQUE REFERENCES users(id),
+  role         VARCHAR(16) NOT NULL,
+  granted_by   VARCHAR(64) NOT NULL,
+  date_created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+ALTER TABLE team_members
+  DROP COLUMN IF EXISTS miles_at_join,
+  DROP COLUMN IF EXISTS guess_points_at_join;
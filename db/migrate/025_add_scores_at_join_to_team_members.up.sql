@@ -0,0 +1,4 @@
+/* the members' scores when they joined, so only what they earn afterwards counts for the team */
+ALTER TABLE team_members
+  ADD COLUMN miles_at_join REAL NOT NULL DEFAULT 0.0,
+  ADD COLUMN guess_points_at_join REAL NOT NULL DEFAULT 0.0;
@@ -0,0 +1,2 @@
+ALTER TABLE miles_ledger
+  ALTER COLUMN amount TYPE REAL;
@@ -0,0 +1,3 @@
+/* REAL amounts drift when they're summed, so store exact hundredths of a mile */
+ALTER TABLE miles_ledger
+  ALTER COLUMN amount TYPE NUMERIC(12,2) USING ROUND(amount::NUMERIC, 2);
@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/events"
+)
+
+// guessReportSize is how many states are included in each list
+const guessReportSize = 10
+
+// GuessReport shows which states people have the most trouble guessing
+type GuessReport struct {
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	MostMissed []events.ValueCount `json:"most_missed"`
+	Confused   []events.StatePair  `json:"confused"`
+}
+
+// GenerateGuessReport creates a guess report for the given time range
+func GenerateGuessReport(from, to time.Time) (GuessReport, error) {
+	report := GuessReport{From: from, To: to}
+	var err error
+	report.MostMissed, err = events.MostMissedStates(from, guessReportSize)
+	if err != nil {
+		return report, err
+	}
+	report.Confused, err = events.ConfusedStates(from, guessReportSize)
+	return report, err
+}
+
+// String returns the report in a human-readable format
+func (r GuessReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Guess report from %s to %s\n", r.From.Format("2006-01-02"), r.To.Format("2006-01-02"))
+	fmt.Fprintln(&b, "  most missed states:")
+	for _, missed := range r.MostMissed {
+		fmt.Fprintf(&b, "    %s: %d\n", missed.Value, missed.Count)
+	}
+	fmt.Fprintln(&b, "  most confused (guess -> actual):")
+	for _, pair := range r.Confused {
+		fmt.Fprintf(&b, "    %s -> %s: %d\n", pair.Guess, pair.Actual, pair.Count)
+	}
+	return b.String()
+}
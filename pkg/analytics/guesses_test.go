@@ -0,0 +1,25 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/adanalife/tripbot/pkg/events"
+)
+
+func TestGuessReportString(t *testing.T) {
+	report := GuessReport{
+		From:       at(0),
+		To:         at(7 * 24 * 60),
+		MostMissed: []events.ValueCount{{Value: "Iowa", Count: 5}},
+		Confused:   []events.StatePair{{Guess: "Iowa", Actual: "Nebraska", Count: 3}},
+	}
+	expected := `Guess report from 2021-03-01 to 2021-03-08
+  most missed states:
+    Iowa: 5
+  most confused (guess -> actual):
+    Iowa -> Nebraska: 3
+`
+	if got := report.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
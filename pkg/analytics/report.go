@@ -0,0 +1,200 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+)
+
+// Report contains the viewer stats for a period of time
+type Report struct {
+	From                     time.Time         `json:"from"`
+	To                       time.Time         `json:"to"`
+	Sessions                 int               `json:"sessions"`
+	UniqueViewers            int               `json:"unique_viewers"`
+	AverageConcurrentViewers float64           `json:"average_concurrent_viewers"`
+	MedianSessionSeconds     float64           `json:"median_session_seconds"`
+	Retention                []WeeklyRetention `json:"retention"`
+	PeakHours                []HourlyViewers   `json:"peak_hours"`
+}
+
+// WeeklyRetention is how many of a week's viewers had been seen before
+type WeeklyRetention struct {
+	WeekStart time.Time `json:"week_start"`
+	Viewers   int       `json:"viewers"`
+	Returning int       `json:"returning"`
+	Rate      float64   `json:"rate"`
+}
+
+// HourlyViewers is the average number of concurrent viewers
+// during an hour of the day (in UTC)
+type HourlyViewers struct {
+	Hour           int     `json:"hour_utc"`
+	AverageViewers float64 `json:"average_viewers"`
+}
+
+// Generate creates a report for the given time range
+func Generate(from, to time.Time) (Report, error) {
+	sessions, err := LoadSessions(from, to)
+	if err != nil {
+		return Report{}, err
+	}
+	return NewReport(sessions, from, to), nil
+}
+
+// NewReport calculates the stats for the given sessions
+func NewReport(sessions []Session, from, to time.Time) Report {
+	return Report{
+		From:                     from,
+		To:                       to,
+		Sessions:                 len(sessions),
+		UniqueViewers:            UniqueViewers(sessions),
+		AverageConcurrentViewers: AverageConcurrentViewers(sessions, from, to),
+		MedianSessionSeconds:     MedianSessionLength(sessions).Seconds(),
+		Retention:                Retention(sessions),
+		PeakHours:                PeakHours(sessions, from, to),
+	}
+}
+
+// String returns the report in a human-readable format
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Viewer report from %s to %s\n", r.From.Format("2006-01-02"), r.To.Format("2006-01-02"))
+	fmt.Fprintf(&b, "  sessions: %d\n", r.Sessions)
+	fmt.Fprintf(&b, "  unique viewers: %d\n", r.UniqueViewers)
+	fmt.Fprintf(&b, "  average concurrent viewers: %.2f\n", r.AverageConcurrentViewers)
+	median := time.Duration(r.MedianSessionSeconds) * time.Second
+	fmt.Fprintf(&b, "  median session length: %s\n", durafmt.ParseShort(median))
+
+	fmt.Fprintln(&b, "  retention:")
+	for _, week := range r.Retention {
+		fmt.Fprintf(&b, "    week of %s: %d/%d returning (%.0f%%)\n",
+			week.WeekStart.Format("2006-01-02"), week.Returning, week.Viewers, week.Rate*100)
+	}
+
+	fmt.Fprintln(&b, "  peak hours (UTC):")
+	peaks := make([]HourlyViewers, len(r.PeakHours))
+	copy(peaks, r.PeakHours)
+	sort.SliceStable(peaks, func(i, j int) bool {
+		return peaks[i].AverageViewers > peaks[j].AverageViewers
+	})
+	for i := 0; i < len(peaks) && i < 5; i++ {
+		fmt.Fprintf(&b, "    %02d:00: %.2f viewers\n", peaks[i].Hour, peaks[i].AverageViewers)
+	}
+	return b.String()
+}
+
+// UniqueViewers counts the different users in the sessions
+func UniqueViewers(sessions []Session) int {
+	viewers := make(map[string]struct{})
+	for _, s := range sessions {
+		viewers[s.Username] = struct{}{}
+	}
+	return len(viewers)
+}
+
+// AverageConcurrentViewers is the total time watched divided by the length of the range
+func AverageConcurrentViewers(sessions []Session, from, to time.Time) float64 {
+	if !to.After(from) {
+		return 0.0
+	}
+	var watched time.Duration
+	for _, s := range sessions {
+		watched += s.overlap(from, to)
+	}
+	return watched.Seconds() / to.Sub(from).Seconds()
+}
+
+// MedianSessionLength returns the length of the typical session
+func MedianSessionLength(sessions []Session) time.Duration {
+	if len(sessions) == 0 {
+		return 0
+	}
+	durations := make([]time.Duration, 0, len(sessions))
+	for _, s := range sessions {
+		durations = append(durations, s.Duration())
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2
+	}
+	return durations[mid]
+}
+
+// Retention returns, for each week (starting Monday), how many of the
+// viewers were seen in an earlier week. The first week has nobody to
+// compare against so everyone counts as new
+func Retention(sessions []Session) []WeeklyRetention {
+	weeks := make(map[time.Time]map[string]struct{})
+	for _, s := range sessions {
+		week := weekStart(s.Start)
+		if weeks[week] == nil {
+			weeks[week] = make(map[string]struct{})
+		}
+		weeks[week][s.Username] = struct{}{}
+	}
+
+	var weekStarts []time.Time
+	for week := range weeks {
+		weekStarts = append(weekStarts, week)
+	}
+	sort.Slice(weekStarts, func(i, j int) bool {
+		return weekStarts[i].Before(weekStarts[j])
+	})
+
+	seen := make(map[string]struct{})
+	var retention []WeeklyRetention
+	for _, week := range weekStarts {
+		r := WeeklyRetention{WeekStart: week, Viewers: len(weeks[week])}
+		for username := range weeks[week] {
+			if _, ok := seen[username]; ok {
+				r.Returning++
+			}
+		}
+		if r.Viewers > 0 {
+			r.Rate = float64(r.Returning) / float64(r.Viewers)
+		}
+		retention = append(retention, r)
+		for username := range weeks[week] {
+			seen[username] = struct{}{}
+		}
+	}
+	return retention
+}
+
+// PeakHours returns the average concurrent viewers for each hour of the day
+func PeakHours(sessions []Session, from, to time.Time) []HourlyViewers {
+	var watched [24]time.Duration
+	var hoursInRange [24]int
+
+	// walk through the range an hour at a time
+	for hour := from.UTC().Truncate(time.Hour); hour.Before(to); hour = hour.Add(time.Hour) {
+		next := hour.Add(time.Hour)
+		hoursInRange[hour.Hour()]++
+		for _, s := range sessions {
+			watched[hour.Hour()] += s.overlap(hour, next)
+		}
+	}
+
+	peaks := make([]HourlyViewers, 24)
+	for h := 0; h < 24; h++ {
+		peaks[h].Hour = h
+		if hoursInRange[h] > 0 {
+			peaks[h].AverageViewers = watched[h].Hours() / float64(hoursInRange[h])
+		}
+	}
+	return peaks
+}
+
+// weekStart returns midnight (UTC) on the Monday of the given week
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
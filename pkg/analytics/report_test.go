@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// session creates a session that runs between the given minutes
+func session(username string, from, to int) Session {
+	return Session{Username: username, Start: at(from), End: at(to)}
+}
+
+func TestUniqueViewers(t *testing.T) {
+	tests := []struct {
+		sessions []Session
+		expected int
+	}{
+		{nil, 0},
+		{[]Session{session("alice", 0, 10)}, 1},
+		{[]Session{session("alice", 0, 10), session("alice", 20, 30), session("bob", 0, 10)}, 2},
+	}
+	for _, tt := range tests {
+		if got := UniqueViewers(tt.sessions); got != tt.expected {
+			t.Errorf("UniqueViewers(%v): expected %d, got %d", tt.sessions, tt.expected, got)
+		}
+	}
+}
+
+func TestAverageConcurrentViewers(t *testing.T) {
+	tests := []struct {
+		sessions []Session
+		from, to int
+		expected float64
+	}{
+		{nil, 0, 60, 0},
+		{[]Session{session("alice", 0, 60)}, 0, 60, 1},
+		{[]Session{session("alice", 0, 60), session("bob", 0, 30)}, 0, 60, 1.5},
+		// only the part inside the range counts
+		{[]Session{session("alice", 30, 90)}, 0, 60, 0.5},
+		{[]Session{session("alice", 0, 60)}, 60, 60, 0},
+	}
+	for _, tt := range tests {
+		if got := AverageConcurrentViewers(tt.sessions, at(tt.from), at(tt.to)); got != tt.expected {
+			t.Errorf("AverageConcurrentViewers(%v, %d, %d): expected %v, got %v", tt.sessions, tt.from, tt.to, tt.expected, got)
+		}
+	}
+}
+
+func TestMedianSessionLength(t *testing.T) {
+	tests := []struct {
+		sessions []Session
+		expected time.Duration
+	}{
+		{nil, 0},
+		{[]Session{session("alice", 0, 10)}, 10 * time.Minute},
+		{[]Session{session("alice", 0, 30), session("bob", 0, 10), session("carol", 0, 20)}, 20 * time.Minute},
+		{[]Session{session("alice", 0, 10), session("bob", 0, 20)}, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := MedianSessionLength(tt.sessions); got != tt.expected {
+			t.Errorf("MedianSessionLength(%v): expected %s, got %s", tt.sessions, tt.expected, got)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	// start is a Monday
+	week := 7 * 24 * 60
+	sessions := []Session{
+		session("alice", 0, 10),
+		session("bob", 0, 10),
+		session("alice", week, week+10),
+		session("carol", week, week+10),
+		session("bob", 2*week+60, 2*week+70),
+	}
+	expected := []WeeklyRetention{
+		{WeekStart: at(0), Viewers: 2, Returning: 0, Rate: 0},
+		{WeekStart: at(week), Viewers: 2, Returning: 1, Rate: 0.5},
+		{WeekStart: at(2 * week), Viewers: 1, Returning: 1, Rate: 1},
+	}
+	if got := Retention(sessions); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPeakHours(t *testing.T) {
+	// two days, alice watches 1am-2am on both and bob only on the first
+	day := 24 * 60
+	sessions := []Session{
+		session("alice", 60, 120),
+		session("alice", day+60, day+120),
+		session("bob", 60, 120),
+	}
+	peaks := PeakHours(sessions, at(0), at(2*day))
+	if len(peaks) != 24 {
+		t.Fatalf("expected 24 hours, got %d", len(peaks))
+	}
+	for _, peak := range peaks {
+		expected := 0.0
+		if peak.Hour == 1 {
+			expected = 1.5
+		}
+		if peak.AverageViewers != expected {
+			t.Errorf("hour %d: expected %v viewers, got %v", peak.Hour, expected, peak.AverageViewers)
+		}
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	monday := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		t        time.Time
+		expected time.Time
+	}{
+		{monday, monday},
+		{monday.Add(36 * time.Hour), monday},
+		{monday.AddDate(0, 0, 6).Add(23 * time.Hour), monday},
+		{monday.AddDate(0, 0, 7), monday.AddDate(0, 0, 7)},
+		// times are converted to UTC first
+		{time.Date(2021, time.February, 28, 20, 0, 0, 0, time.FixedZone("EST", -5*60*60)), monday},
+	}
+	for _, tt := range tests {
+		if got := weekStart(tt.t); !got.Equal(tt.expected) {
+			t.Errorf("weekStart(%s): expected %s, got %s", tt.t, tt.expected, got)
+		}
+	}
+}
+
+func TestReportString(t *testing.T) {
+	sessions := []Session{session("alice", 0, 60)}
+	report := NewReport(sessions, at(0), at(60))
+	expected := `Viewer report from 2021-03-01 to 2021-03-01
+  sessions: 1
+  unique viewers: 1
+  average concurrent viewers: 1.00
+  median session length: 1 hour
+  retention:
+    week of 2021-03-01: 0/1 returning (0%)
+  peak hours (UTC):
+    00:00: 1.00 viewers
+    01:00: 0.00 viewers
+    02:00: 0.00 viewers
+    03:00: 0.00 viewers
+    04:00: 0.00 viewers
+`
+	if got := report.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,106 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+)
+
+// Session is a single visit to the stream, from login to logout
+type Session struct {
+	Username string
+	Start    time.Time
+	End      time.Time
+}
+
+// Duration returns how long the session lasted
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// overlap returns how much of the session happened between from and to
+func (s Session) overlap(from, to time.Time) time.Duration {
+	start := s.Start
+	if from.After(start) {
+		start = from
+	}
+	end := s.End
+	if to.Before(end) {
+		end = to
+	}
+	if end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// LoadSessions reads the login/logout events between from and to and
+// turns them into sessions. Bots and ignored users are left out
+func LoadSessions(from, to time.Time) ([]Session, error) {
+	var evts []events.Event
+	query := `SELECT * FROM events
+		WHERE event IN ('login', 'logout') AND date_created >= $1 AND date_created < $2
+		ORDER BY username, date_created`
+	err := database.Connection().Select(&evts, query, from, to)
+	if err != nil {
+		terrors.Log(err, "error loading events")
+		return nil, err
+	}
+	return BuildSessions(evts, to), nil
+}
+
+// BuildSessions pairs up login and logout events for each user. The
+// events must be sorted by username and then date. A login without a
+// matching logout is either still going (if it's the user's last event,
+// it ends at the end time) or was interrupted by a crash (if another
+// login comes first), in which case it's thrown away because we don't
+// know how long it lasted
+func BuildSessions(evts []events.Event, end time.Time) []Session {
+	var sessions []Session
+	var open *Session
+
+	closeOpen := func() {
+		if open != nil {
+			open.End = end
+			sessions = append(sessions, *open)
+			open = nil
+		}
+	}
+
+	for _, evt := range evts {
+		username := strings.ToLower(evt.Username)
+		if c.UserIsIgnored(username) || username == strings.ToLower(c.Conf.ChannelName) {
+			continue
+		}
+		// we've moved on to the next user
+		if open != nil && open.Username != username {
+			closeOpen()
+		}
+
+		switch evt.Event {
+		case "login":
+			// the previous login never logged out
+			open = &Session{Username: username, Start: evt.DateCreated}
+		case "logout":
+			if open == nil {
+				// the login happened before the time range
+				continue
+			}
+			open.End = evt.DateCreated
+			sessions = append(sessions, *open)
+			open = nil
+		}
+	}
+	// the last user's session may still be going
+	closeOpen()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+)
+
+func TestMain(m *testing.M) {
+	terrors.Initialize(c.Conf)
+	os.Exit(m.Run())
+}
+
+// start is used as the beginning of the time range in the tests
+var start = time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns the time the given number of minutes after start
+func at(minutes int) time.Time {
+	return start.Add(time.Duration(minutes) * time.Minute)
+}
+
+// evt creates a login or logout event
+func evt(username, event string, minutes int) events.Event {
+	return events.Event{Username: username, Event: event, DateCreated: at(minutes)}
+}
+
+func TestBuildSessions(t *testing.T) {
+	end := at(100)
+	tests := []struct {
+		name     string
+		evts     []events.Event
+		expected []Session
+	}{
+		{
+			name: "login and logout",
+			evts: []events.Event{evt("alice", "login", 0), evt("alice", "logout", 10)},
+			expected: []Session{
+				{Username: "alice", Start: at(0), End: at(10)},
+			},
+		},
+		{
+			name: "still logged in at the end",
+			evts: []events.Event{evt("alice", "login", 90)},
+			expected: []Session{
+				{Username: "alice", Start: at(90), End: end},
+			},
+		},
+		{
+			name: "a crash throws away the interrupted session",
+			evts: []events.Event{evt("alice", "login", 0), evt("alice", "login", 20), evt("alice", "logout", 30)},
+			expected: []Session{
+				{Username: "alice", Start: at(20), End: at(30)},
+			},
+		},
+		{
+			name:     "logged in before the range",
+			evts:     []events.Event{evt("alice", "logout", 5)},
+			expected: nil,
+		},
+		{
+			name: "usernames are lowercased and sorted by start",
+			evts: []events.Event{evt("Bob", "login", 0), evt("bob", "logout", 10), evt("carol", "login", 5)},
+			expected: []Session{
+				{Username: "bob", Start: at(0), End: at(10)},
+				{Username: "carol", Start: at(5), End: end},
+			},
+		},
+		{
+			name:     "the channel and bots are left out",
+			evts:     []events.Event{evt(c.Conf.ChannelName, "login", 0), evt("nightbot", "login", 0)},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		got := BuildSessions(tt.evts, end)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	s := Session{Username: "alice", Start: at(10), End: at(20)}
+	tests := []struct {
+		from, to int
+		expected time.Duration
+	}{
+		{0, 30, 10 * time.Minute},
+		{15, 30, 5 * time.Minute},
+		{0, 15, 5 * time.Minute},
+		{12, 18, 6 * time.Minute},
+		{30, 40, 0},
+	}
+	for _, tt := range tests {
+		if got := s.overlap(at(tt.from), at(tt.to)); got != tt.expected {
+			t.Errorf("overlap(%d, %d): expected %s, got %s", tt.from, tt.to, tt.expected, got)
+		}
+	}
+}
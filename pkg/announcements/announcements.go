@@ -0,0 +1,237 @@
+package announcements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/lib/pq"
+	"github.com/robfig/cron"
+)
+
+// MinInterval is the most often an announcement can be posted,
+// so a typo doesn't end up spamming chat
+var MinInterval = 5 * time.Minute
+
+// ErrTooFrequent is returned for schedules that run more often than MinInterval
+var ErrTooFrequent = errors.New("announcement schedule is too frequent")
+
+// ErrNotFound is returned when there's no announcement with the given ID
+var ErrNotFound = errors.New("no such announcement")
+
+// Announcement is a message that gets posted in chat on a schedule
+type Announcement struct {
+	ID      int    `db:"id" json:"id"`
+	Message string `db:"message" json:"message"`
+	// Schedule is a cron expression (ex: "0 18 * * *") or an interval (ex: "@every 30m")
+	Schedule string `db:"schedule" json:"schedule"`
+	// MinChatMessages is how many chat messages there have to be since
+	// it was last posted, so we don't talk to an empty room
+	MinChatMessages int          `db:"min_chat_messages" json:"min_chat_messages"`
+	Enabled         bool         `db:"enabled" json:"enabled"`
+	CreatedBy       string       `db:"created_by" json:"created_by"`
+	LastPostedAt    sql.NullTime `db:"last_posted_at" json:"last_posted_at"`
+	DateCreated     time.Time    `db:"date_created" json:"date_created"`
+}
+
+// chatMessages counts the messages we've seen since starting up
+var chatMessages uint64
+
+// chatMessagesAtPost is the value of chatMessages when each
+// announcement was last posted, keyed by ID
+var chatMessagesAtPost = make(map[int]uint64)
+var chatMessagesMutex sync.Mutex
+
+// RecordChatMessage counts a chat message, it's used
+// to figure out if chat is active enough to post
+func RecordChatMessage() {
+	atomic.AddUint64(&chatMessages, 1)
+}
+
+// ChatMessages returns how many chat messages we've seen since starting
+// up, compare two calls to see how active chat has been in between
+func ChatMessages() uint64 {
+	return atomic.LoadUint64(&chatMessages)
+}
+
+// ParseSchedule checks that a schedule is valid and returns it in the
+// form we save, intervals can be given on their own (ex: "30m")
+func ParseSchedule(spec string) (string, error) {
+	if _, err := time.ParseDuration(spec); err == nil {
+		spec = "@every " + spec
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "", err
+	}
+	// compare two runs in a row to see how often it goes
+	next := schedule.Next(time.Now())
+	if schedule.Next(next).Sub(next) < MinInterval {
+		return "", ErrTooFrequent
+	}
+	return spec, nil
+}
+
+// Create saves a new announcement, it's enabled right away
+func Create(message, schedule string, minChatMessages int, createdBy string) (Announcement, error) {
+	var a Announcement
+	if c.Conf.ReadOnly {
+		return a, &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	schedule, err := ParseSchedule(schedule)
+	if err != nil {
+		return a, err
+	}
+	query := `INSERT INTO announcements (message, schedule, min_chat_messages, created_by)
+		VALUES ($1, $2, $3, $4) RETURNING *`
+	err = database.Connection().Get(&a, query, message, schedule, minChatMessages, createdBy)
+	if err != nil {
+		terrors.Log(err, "error creating announcement")
+	}
+	return a, err
+}
+
+// All returns every announcement, oldest first
+func All() ([]Announcement, error) {
+	var all []Announcement
+	err := database.Connection().Select(&all, "SELECT * FROM announcements ORDER BY id")
+	if err != nil {
+		terrors.Log(err, "error getting announcements")
+	}
+	return all, err
+}
+
+// Remove deletes an announcement
+func Remove(id int) error {
+	return exec("DELETE FROM announcements WHERE id=$1", id)
+}
+
+// SetEnabled turns an announcement on or off
+func SetEnabled(id int, enabled bool) error {
+	return exec("UPDATE announcements SET enabled=$2 WHERE id=$1", id, enabled)
+}
+
+// exec runs a query that changes a single announcement
+func exec(query string, id int, args ...interface{}) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	res, err := database.Connection().Exec(query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		terrors.Log(err, "error updating announcement")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// botCreator is the created_by for the announcements the bot
+// makes itself (ex: the help messages)
+const botCreator = "tripbot"
+
+// SyncBuiltin makes sure the bot's own announcements match the messages,
+// missing ones are added and ones that aren't in the list anymore are
+// removed. They each repeat every spacing*len(messages), and new ones are
+// staggered so one goes out every spacing. Disable them to turn them off,
+// removing them doesn't work since they'll be added back
+func SyncBuiltin(messages []string, spacing time.Duration, minChatMessages int) error {
+	// there's nothing to post in read-only mode anyway
+	if c.Conf.ReadOnly {
+		return nil
+	}
+	// the same message can be in the list more than once
+	var unique []string
+	seen := make(map[string]bool)
+	for _, message := range messages {
+		if !seen[message] {
+			seen[message] = true
+			unique = append(unique, message)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+
+	db := database.Connection()
+	_, err := db.Exec("DELETE FROM announcements WHERE created_by = $1 AND NOT (message = ANY($2))", botCreator, pq.Array(unique))
+	if err != nil {
+		terrors.Log(err, "error removing old announcements")
+		return err
+	}
+
+	schedule := fmt.Sprintf("@every %s", spacing*time.Duration(len(unique)))
+	now := time.Now()
+	query := `INSERT INTO announcements (message, schedule, min_chat_messages, created_by, last_posted_at)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (SELECT 1 FROM announcements WHERE created_by = $4 AND message = $1)`
+	for i, message := range unique {
+		// pretend they were posted one after another so they don't all go out at once
+		lastPosted := now.Add(-time.Duration(i) * spacing)
+		_, err = db.Exec(query, message, schedule, minChatMessages, botCreator, lastPosted)
+		if err != nil {
+			terrors.Log(err, "error adding announcement")
+			return err
+		}
+	}
+	return nil
+}
+
+// Due returns the enabled announcements that should be posted now
+func Due(now time.Time) ([]Announcement, error) {
+	var enabled []Announcement
+	err := database.Connection().Select(&enabled, "SELECT * FROM announcements WHERE enabled = true ORDER BY id")
+	if err != nil {
+		terrors.Log(err, "error getting enabled announcements")
+		return nil, err
+	}
+
+	var due []Announcement
+	for _, a := range enabled {
+		schedule, err := cron.ParseStandard(a.Schedule)
+		if err != nil {
+			terrors.Log(err, "error parsing announcement schedule")
+			continue
+		}
+		last := a.DateCreated
+		if a.LastPostedAt.Valid {
+			last = a.LastPostedAt.Time
+		}
+		if now.Before(schedule.Next(last)) {
+			continue
+		}
+		if a.chatMessagesSincePost() < a.MinChatMessages {
+			continue
+		}
+		due = append(due, a)
+	}
+	return due, nil
+}
+
+// MarkPosted records that the announcement was just posted
+func MarkPosted(a Announcement) error {
+	chatMessagesMutex.Lock()
+	chatMessagesAtPost[a.ID] = atomic.LoadUint64(&chatMessages)
+	chatMessagesMutex.Unlock()
+
+	_, err := database.Connection().Exec("UPDATE announcements SET last_posted_at=$2 WHERE id=$1", a.ID, time.Now())
+	if err != nil {
+		terrors.Log(err, "error marking announcement as posted")
+	}
+	return err
+}
+
+// chatMessagesSincePost is how many chat messages there have been since
+// the announcement was last posted (or since we started up)
+func (a Announcement) chatMessagesSincePost() int {
+	chatMessagesMutex.Lock()
+	defer chatMessagesMutex.Unlock()
+	return int(atomic.LoadUint64(&chatMessages) - chatMessagesAtPost[a.ID])
+}
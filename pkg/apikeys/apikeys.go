@@ -0,0 +1,262 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/logrusorgru/aurora"
+)
+
+// these are the permissions that can be given to a key
+const (
+	PermissionReadTokens      = "tokens:read"
+	PermissionControlPlayback = "playback:control"
+	PermissionPostToChat      = "chat:write"
+	PermissionReadAnalytics   = "analytics:read"
+)
+
+// Permissions contains all of the valid permissions
+var Permissions = []string{
+	PermissionReadTokens,
+	PermissionControlPlayback,
+	PermissionPostToChat,
+	PermissionReadAnalytics,
+}
+
+// keyPrefix makes it easier to spot a leaked key
+const keyPrefix = "tb_"
+
+// APIKey is used by supporting scripts to authenticate to the server.
+// Only a hash of the key is stored, so a key can't be recovered after
+// it's created (rotate it instead)
+type APIKey struct {
+	ID          int          `db:"id"`
+	Name        string       `db:"name"`
+	KeyHash     string       `db:"key_hash"`
+	Permissions string       `db:"permissions"`
+	Revoked     bool         `db:"revoked"`
+	LastUsed    sql.NullTime `db:"last_used"`
+	DateCreated time.Time    `db:"date_created"`
+	DateUpdated time.Time    `db:"date_updated"`
+}
+
+// Can returns true if the key has been given the permission
+func (k APIKey) Can(permission string) bool {
+	if k.Revoked {
+		return false
+	}
+	for _, p := range k.PermissionList() {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionList returns the key's permissions as a slice
+func (k APIKey) PermissionList() []string {
+	if k.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(k.Permissions, ",")
+}
+
+// String returns a description of the key (but not the key itself)
+func (k APIKey) String() string {
+	lastUsed := "never"
+	if k.LastUsed.Valid {
+		lastUsed = k.LastUsed.Time.Format(time.RFC3339)
+	}
+	status := "active"
+	if k.Revoked {
+		status = "revoked"
+	}
+	return fmt.Sprintf("%s [%s] (%s, last used %s)", k.Name, k.Permissions, status, lastUsed)
+}
+
+// Create makes a new key with the given permissions. The plaintext
+// key is returned and never stored anywhere, so save it somewhere
+func Create(name string, permissions []string) (string, error) {
+	if c.Conf.ReadOnly {
+		return "", &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	perms, err := normalizePermissions(permissions)
+	if err != nil {
+		return "", err
+	}
+	key, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO api_keys (name, key_hash, permissions) VALUES ($1, $2, $3)`
+	_, err = database.Connection().Exec(query, name, hashKey(key), perms)
+	if err != nil {
+		terrors.Log(err, "error creating api key")
+		return "", err
+	}
+	log.Println("created api key", aurora.Cyan(name), "with permissions", perms)
+	return key, nil
+}
+
+// Rotate replaces the named key with a new one, keeping the same
+// permissions. The old key stops working immediately
+func Rotate(name string) (string, error) {
+	if c.Conf.ReadOnly {
+		return "", &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	key, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+
+	query := `UPDATE api_keys SET key_hash=$1, revoked=FALSE, date_updated=CURRENT_TIMESTAMP WHERE name=$2`
+	res, err := database.Connection().Exec(query, hashKey(key), name)
+	if err != nil {
+		terrors.Log(err, "error rotating api key")
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", fmt.Errorf("no api key named %s", name)
+	}
+	log.Println("rotated api key", aurora.Cyan(name))
+	return key, nil
+}
+
+// Revoke disables the named key
+func Revoke(name string) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	query := `UPDATE api_keys SET revoked=TRUE, date_updated=CURRENT_TIMESTAMP WHERE name=$1`
+	res, err := database.Connection().Exec(query, name)
+	if err != nil {
+		terrors.Log(err, "error revoking api key")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no api key named %s", name)
+	}
+	log.Println("revoked api key", aurora.Cyan(name))
+	return nil
+}
+
+// List returns all of the keys
+func List() ([]APIKey, error) {
+	var keys []APIKey
+	err := database.Connection().Select(&keys, `SELECT * FROM api_keys ORDER BY name`)
+	if err != nil {
+		terrors.Log(err, "error listing api keys")
+	}
+	return keys, err
+}
+
+// Find looks up a key from its plaintext value,
+// it returns nil if the key doesn't exist or has been revoked
+func Find(key string) *APIKey {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil
+	}
+	var apiKey APIKey
+	query := `SELECT * FROM api_keys WHERE key_hash=$1 AND revoked=FALSE`
+	err := database.Connection().Get(&apiKey, query, hashKey(key))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		terrors.Log(err, "error finding api key")
+		return nil
+	}
+	return &apiKey
+}
+
+// Audit records that a key tried to use a permission. Requests without
+// a valid key aren't audited, since anyone can send those
+func Audit(apiKey *APIKey, permission, path, remoteAddr string, allowed bool) {
+	name := apiKey.Name
+
+	if allowed {
+		log.Printf("api key %s used %s on %s from %s", aurora.Cyan(name), permission, path, remoteAddr)
+	} else {
+		log.Printf("api key %s was denied %s on %s from %s", aurora.Red(name), permission, path, remoteAddr)
+	}
+
+	if c.Conf.ReadOnly {
+		return
+	}
+	query := `INSERT INTO api_key_audit_log (api_key_id, permission, path, remote_addr, allowed)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := database.Connection().Exec(query, apiKey.ID, permission, path, remoteAddr, allowed)
+	if err != nil {
+		terrors.Log(err, "error writing api key audit log")
+	}
+	if allowed {
+		_, err = database.Connection().Exec(`UPDATE api_keys SET last_used=CURRENT_TIMESTAMP WHERE id=$1`, apiKey.ID)
+		if err != nil {
+			terrors.Log(err, "error updating api key last used")
+		}
+	}
+}
+
+// generateKey creates a random key
+func generateKey() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		terrors.Log(err, "error generating api key")
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(b), nil
+}
+
+// hashKey returns the hash we store in the DB. The keys are long and
+// random so a plain SHA-256 is enough (unlike with passwords)
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizePermissions makes sure the permissions are valid
+// and returns them in the format they're stored in
+func normalizePermissions(permissions []string) (string, error) {
+	seen := make(map[string]bool)
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !validPermission(p) {
+			return "", fmt.Errorf("unknown permission %s (valid: %s)", p, strings.Join(Permissions, ", "))
+		}
+		seen[p] = true
+	}
+	if len(seen) == 0 {
+		return "", fmt.Errorf("api keys need at least one permission")
+	}
+	var perms []string
+	for p := range seen {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return strings.Join(perms, ","), nil
+}
+
+// validPermission returns true if the permission exists
+func validPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package apikeys
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePermissions(t *testing.T) {
+	tests := []struct {
+		permissions []string
+		expected    string
+		valid       bool
+	}{
+		{[]string{"chat:write"}, "chat:write", true},
+		{[]string{"tokens:read", "chat:write"}, "chat:write,tokens:read", true},
+		{[]string{" chat:write ", "chat:write", ""}, "chat:write", true},
+		{[]string{"chat:write", "chat:delete"}, "", false},
+		{[]string{"CHAT:WRITE"}, "", false},
+		{[]string{}, "", false},
+		{[]string{"", " "}, "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizePermissions(tt.permissions)
+		if (err == nil) != tt.valid {
+			t.Errorf("normalizePermissions(%q): expected valid=%v, got error %v", tt.permissions, tt.valid, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("normalizePermissions(%q): expected %q, got %q", tt.permissions, tt.expected, got)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	key := APIKey{Permissions: "analytics:read,chat:write"}
+	if !key.Can(PermissionPostToChat) || !key.Can(PermissionReadAnalytics) {
+		t.Error("the key should have its permissions")
+	}
+	if key.Can(PermissionReadTokens) {
+		t.Error("the key shouldn't have permissions it wasn't given")
+	}
+	key.Revoked = true
+	if key.Can(PermissionPostToChat) {
+		t.Error("a revoked key shouldn't have any permissions")
+	}
+	if got := (APIKey{}).PermissionList(); !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("expected no permissions, got %v", got)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	key, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, keyPrefix) {
+		t.Errorf("expected the key to start with %s, got %s", keyPrefix, key)
+	}
+	if hashKey(key) != hashKey(key) {
+		t.Error("hashing the same key twice gave different hashes")
+	}
+	other, _ := generateKey()
+	if hashKey(key) == hashKey(other) {
+		t.Error("two keys had the same hash")
+	}
+}
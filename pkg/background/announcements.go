@@ -0,0 +1,27 @@
+package background
+
+import (
+	"log"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/announcements"
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/logrusorgru/aurora"
+)
+
+// PostAnnouncements posts any scheduled announcements that are due,
+// it runs every minute so the schedules are accurate to the minute
+func PostAnnouncements() {
+	if c.Conf.ReadOnly || Announce == nil {
+		return
+	}
+	due, err := announcements.Due(time.Now())
+	if err != nil {
+		return
+	}
+	for _, a := range due {
+		log.Println("posting announcement", aurora.Cyan(a.ID))
+		Announce(a.Message)
+		announcements.MarkPosted(a)
+	}
+}
@@ -0,0 +1,126 @@
+package background
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/adanalife/tripbot/pkg/teams"
+	"github.com/logrusorgru/aurora"
+)
+
+// rolloverBoard is a kind of monthly board that gets winners
+type rolloverBoard struct {
+	kind  string
+	title string
+	// format is used to show the values (ex: "%.1fmi")
+	format string
+}
+
+var rolloverBoards = []rolloverBoard{
+	{kind: scoreboards.KindMiles, title: "Miles", format: "%.1fmi"},
+	{kind: scoreboards.KindGuessPoints, title: "Guess Points", format: "%.1f"},
+}
+
+// WinnerBonusMiles are the spendable miles given to the
+// first, second, and third place finishers
+var WinnerBonusMiles = []float32{100, 50, 25}
+
+// Announce is used to congratulate the winners in chat, it's set
+// by the caller since the chatbot package depends on this one
+var Announce func(msg string)
+
+// MonthlyRollover archives the winners from last month's boards and
+// announces them. Boards are only archived once, so this runs often
+// in case the bot was down when the month ended
+func MonthlyRollover() {
+	if c.Conf.ReadOnly {
+		return
+	}
+	// the last day of the previous month
+	lastMonth := scoreboards.PeriodStart(scoreboards.Monthly, time.Now()).AddDate(0, 0, -1)
+
+	for _, rb := range rolloverBoards {
+		board, err := scoreboards.Find(rb.kind, scoreboards.Monthly, lastMonth)
+		if err == sql.ErrNoRows {
+			// nobody scored last month
+			continue
+		}
+		if err != nil {
+			terrors.Log(err, "error finding last month's scoreboard")
+			continue
+		}
+		winners, err := scoreboards.ArchiveWinners(board, WinnerBonusMiles)
+		if err != nil || len(winners) == 0 {
+			continue
+		}
+		log.Println("archived", aurora.Cyan(len(winners)), "winners for", board.Name)
+		announceWinners(rb, lastMonth, winners)
+	}
+
+	endTeamSeasons()
+}
+
+// endTeamSeasons picks the winners of any team seasons that are over
+func endTeamSeasons() {
+	ended, err := teams.EndSeasons()
+	if err != nil {
+		terrors.Log(err, "error ending team seasons")
+	}
+	for _, final := range ended {
+		leaders := final.Leaders()
+		if len(leaders) == 0 {
+			continue
+		}
+		month := final.Season.StartsAt.Local().Format("January")
+
+		var pairs [][]string
+		for _, standing := range final.Standings {
+			pairs = append(pairs, []string{standing.Title, fmt.Sprintf("%.0f", standing.Score())})
+		}
+		onscreensClient.ShowLeaderboard(month+" Team Season", pairs)
+
+		var msg string
+		if len(leaders) == 1 {
+			winner := leaders[0]
+			log.Println(aurora.Cyan(winner.Title), "won the team season starting", final.Season.StartsAt.Local().Format("2006-01-02"))
+			msg = fmt.Sprintf("Team %s won the %s season with %.0f points!", winner.Title, month, winner.Score())
+		} else {
+			var titles []string
+			for _, leader := range leaders {
+				titles = append(titles, leader.Title)
+			}
+			log.Println("the team season starting", final.Season.StartsAt.Local().Format("2006-01-02"), "was a tie")
+			msg = fmt.Sprintf("The %s season was a tie between %s with %.0f points each!", month, strings.Join(titles, " and "), leaders[0].Score())
+		}
+		if Announce != nil {
+			Announce(msg + " Pick a team for the new season with !join")
+		}
+	}
+}
+
+// announceWinners shows the winners onscreen and in chat
+func announceWinners(rb rolloverBoard, month time.Time, winners []scoreboards.Winner) {
+	title := fmt.Sprintf("%s %s Winners", month.Format("January"), rb.title)
+
+	var pairs [][]string
+	var places []string
+	for _, winner := range winners {
+		value := fmt.Sprintf(rb.format, winner.Value)
+		pairs = append(pairs, []string{winner.Username, value})
+		places = append(places, fmt.Sprintf("%d. %s (%s, +%.0f bonus miles)", winner.Rank, winner.Username, value, winner.BonusMiles))
+		events.Miles(winner.Username, winner.BonusMiles, "leaderboard")
+	}
+
+	onscreensClient.ShowLeaderboard(title, pairs)
+	if Announce != nil {
+		Announce(fmt.Sprintf("Congrats to the %s! %s", title, strings.Join(places, ", ")))
+	}
+}
@@ -0,0 +1,130 @@
+package chatbot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/adanalife/tripbot/pkg/announcements"
+	"github.com/adanalife/tripbot/pkg/users"
+)
+
+const announceUsage = "Usage: !announce add <schedule> [min=<chat messages>] | <message>, !announce list, !announce remove|enable|disable <id>"
+
+// announceCmd lets admins manage the scheduled announcements,
+// rawParams are used for the message so it keeps its capitalization
+func announceCmd(user *users.User, params, rawParams []string) {
+	log.Println(user.Username, "ran !announce")
+	// only mods can run this
+	if !user.IsModerator() {
+		return
+	}
+	if len(params) == 0 {
+		Say(announceUsage)
+		return
+	}
+
+	switch params[0] {
+	case "add":
+		announceAddCmd(user, rawParams[1:])
+	case "list":
+		announceListCmd()
+	case "remove", "delete", "enable", "disable":
+		if len(params) < 2 {
+			Say(announceUsage)
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(params[1], "#"))
+		if err != nil {
+			Say(announceUsage)
+			return
+		}
+		switch params[0] {
+		case "remove", "delete":
+			err = announcements.Remove(id)
+		default:
+			err = announcements.SetEnabled(id, params[0] == "enable")
+		}
+		if err == announcements.ErrNotFound {
+			Say(fmt.Sprintf("There's no announcement #%d", id))
+			return
+		}
+		if err != nil {
+			return
+		}
+		Say(fmt.Sprintf("Got it! Announcement #%d is %sd", id, strings.TrimSuffix(params[0], "e")))
+	default:
+		Say(announceUsage)
+	}
+}
+
+// announceAddCmd creates an announcement, the schedule comes before
+// the message (ex: "30m | Follow us!" or "0 18 * * * min=10 | Hello!")
+func announceAddCmd(user *users.User, params []string) {
+	var spec []string
+	var message string
+	text := strings.Join(params, " ")
+	if i := strings.Index(text, "|"); i >= 0 {
+		spec = strings.Fields(text[:i])
+		message = strings.TrimSpace(text[i+1:])
+	} else if len(params) > 1 {
+		// a single-word schedule doesn't need the separator
+		spec = params[:1]
+		message = strings.Join(params[1:], " ")
+	}
+
+	var schedule []string
+	var minChatMessages int
+	for _, field := range spec {
+		if strings.HasPrefix(field, "min=") {
+			minChatMessages, _ = strconv.Atoi(strings.TrimPrefix(field, "min="))
+			continue
+		}
+		schedule = append(schedule, field)
+	}
+	if len(schedule) == 0 || message == "" {
+		Say(announceUsage)
+		return
+	}
+	if isChatCommand(message) {
+		Say(fmt.Sprintf("I couldn't add that announcement, %s", errChatCommandResponse))
+		return
+	}
+
+	a, err := announcements.Create(message, strings.Join(schedule, " "), minChatMessages, user.Username)
+	if err == announcements.ErrTooFrequent {
+		Say(fmt.Sprintf("That's too often, announcements can only go out every %s", announcements.MinInterval))
+		return
+	}
+	if err != nil {
+		Say(fmt.Sprintf("I couldn't add that announcement: %s", err))
+		return
+	}
+	Say(fmt.Sprintf("Added announcement #%d (%s)", a.ID, a.Schedule))
+}
+
+// announceListCmd shows the announcements in chat
+func announceListCmd() {
+	all, err := announcements.All()
+	if err != nil {
+		return
+	}
+	if len(all) == 0 {
+		Say("There aren't any announcements, add one with !announce add")
+		return
+	}
+	var lines []string
+	for _, a := range all {
+		status := "on"
+		if !a.Enabled {
+			status = "off"
+		}
+		message := a.Message
+		if runes := []rune(message); len(runes) > 30 {
+			message = string(runes[:30]) + "..."
+		}
+		lines = append(lines, fmt.Sprintf("#%d (%s, %s): %s", a.ID, a.Schedule, status, message))
+	}
+	Say(strings.Join(lines, " | "))
+}
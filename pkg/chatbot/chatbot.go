@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
 	"time"
 
 	mylog "github.com/adanalife/tripbot/pkg/chatbot/log"
@@ -12,11 +13,9 @@ import (
 	"github.com/adanalife/tripbot/pkg/helpers"
 	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
 	"github.com/adanalife/tripbot/pkg/users"
-	"github.com/davecgh/go-spew/spew"
 	"github.com/gempir/go-twitch-irc/v2"
 	"github.com/kelvins/geocoder"
 	"github.com/logrusorgru/aurora"
-	"github.com/nicklaw5/helix"
 )
 
 var googleMapsAPIKey string
@@ -39,19 +38,14 @@ func Initialize() *twitch.Client {
 	geocoder.ApiKey = c.Conf.GoogleMapsAPIKey
 
 	// initialize the twitch API client
-	myClient, err := mytwitch.Client()
+	_, err = mytwitch.Client()
 	if err != nil {
 		terrors.Fatal(err, "unable to create twitch API client")
 	}
 
-	if !c.Conf.DisableTwitchWebhooks {
-		//TODO: actually use the security features provided here
-		authURL := myClient.GetAuthorizationURL(&helix.AuthorizationURLParams{
-			//TODO: move to configs lib
-			//TODO: revisit that we need all of these
-			Scopes:       []string{"openid", "user:edit:broadcast", "channel:read:subscriptions"},
-			ResponseType: "code",
-		})
+	// try to use the token from last time before making someone log in
+	if !mytwitch.LoadUserAccessToken() && !c.Conf.DisableTwitchWebhooks {
+		authURL := mytwitch.AuthorizationURL()
 		log.Println("if your browser doesn't open automatically:")
 		log.Println(aurora.Blue(authURL).Underline())
 		helpers.OpenInBrowser(authURL)
@@ -62,7 +56,10 @@ func Initialize() *twitch.Client {
 	// attach handlers
 	client.OnUserJoinMessage(UserJoin)
 	client.OnUserPartMessage(UserPart)
-	// client.OnUserNoticeMessage(chatbot.UserNotice)
+	// subs come through EventSub unless webhooks are disabled
+	if c.Conf.DisableTwitchWebhooks {
+		client.OnUserNoticeMessage(UserNotice)
+	}
 	client.OnWhisperMessage(GetWhisper)
 	client.OnPrivateMessage(PrivateMessage)
 
@@ -92,13 +89,6 @@ func Whisper(username, msg string) {
 	client.Whisper(username, msg)
 }
 
-// Chatter is designed to post a randomized message on a timer.
-// Right now it just posts random "help messages."
-func Chatter() {
-	// use twitch emote feature to add some color
-	Say("/me " + help())
-}
-
 func help() string {
 	text := c.HelpMessages[helpIndex]
 	// bump the index
@@ -113,14 +103,77 @@ func AnnounceNewFollower(username string) {
 }
 
 // AnnounceSubscriber makes a post in chat that a user has subscribed
-func AnnounceSubscriber(sub helix.Subscription) {
-	//TODO: do more with the Subscription... IsGift, Tier, PlanName, etc.
-	spew.Dump(sub)
-	username := sub.UserName
-	msg := fmt.Sprintf("Thank you for the sub, @%s; enjoy your !bonusmiles bleedPurple", username)
+func AnnounceSubscriber(sub mytwitch.Subscriber) {
+	var msg string
+	switch {
+	case sub.CumulativeMonths > 1:
+		msg = fmt.Sprintf("Thank you for resubscribing for %d months, @%s; enjoy your !bonusmiles bleedPurple", sub.CumulativeMonths, sub.Username)
+	case sub.Tier > 1:
+		msg = fmt.Sprintf("Thank you for the tier %d sub, @%s; enjoy your !bonusmiles bleedPurple", sub.Tier, sub.Username)
+	default:
+		msg = fmt.Sprintf("Thank you for the sub, @%s; enjoy your !bonusmiles bleedPurple", sub.Username)
+	}
+	Say(msg)
+	giveEveryoneBonusMile()
+}
+
+// AnnounceGiftSubscriber makes a post in chat that a user was gifted a sub
+func AnnounceGiftSubscriber(sub mytwitch.Subscriber) {
+	gifter := "an anonymous gifter"
+	if sub.Gifter != "" {
+		gifter = "@" + sub.Gifter
+	}
+	msg := fmt.Sprintf("Thank you %s for gifting a sub to @%s! bleedPurple", gifter, sub.Username)
+	Say(msg)
+	giveEveryoneBonusMile()
+}
+
+// AnnounceCommunityGift makes a post in chat that a user gifted
+// subs to the community
+func AnnounceCommunityGift(gifter string, count int) {
+	if gifter == "" {
+		gifter = "an anonymous gifter"
+	} else {
+		gifter = "@" + gifter
+	}
+	msg := fmt.Sprintf("Thank you %s for gifting %d subs to the community! bleedPurple", gifter, count)
+	if count == 1 {
+		msg = fmt.Sprintf("Thank you %s for gifting a sub! bleedPurple", gifter)
+	}
 	Say(msg)
-	// give everyone a bonus mile
+	giveEveryoneBonusMile()
+}
+
+// AnnounceCheer makes a post in chat that a user cheered
+func AnnounceCheer(username string, bits int) {
+	msg := fmt.Sprintf("Thank you for the %d bits, @%s! bleedPurple", bits, username)
+	if username == "" {
+		msg = fmt.Sprintf("Thank you for the %d bits, mysterious stranger! bleedPurple", bits)
+	}
+	Say(msg)
+}
+
+// AnnounceRaid makes a post in chat welcoming raiders
+func AnnounceRaid(username string, viewers int) {
+	msg := fmt.Sprintf("Welcome raiders! Thank you for bringing %d friends along for the ride, @%s HolidayPresent", viewers, username)
+	Say(msg)
+}
+
+// HandleRedemption is run when a user redeems channel points
+func HandleRedemption(username, reward, input string) {
+	log.Println(username, "redeemed", aurora.Cyan(reward))
+	// rewards with timewarp in the title trigger a timewarp
+	if strings.Contains(strings.ToLower(reward), "timewarp") {
+		Say(fmt.Sprintf("@%s redeemed a timewarp, here we go...!", username))
+		timewarp(username, "redemption")
+		return
+	}
+	Say(fmt.Sprintf("Thank you for redeeming %s, @%s!", reward, username))
+}
+
+// giveEveryoneBonusMile gives all of the current viewers a mile
+func giveEveryoneBonusMile() {
 	users.GiveEveryoneMiles(1.0)
-	msg = fmt.Sprintf("The %d current viewers have been given a bonus mile, too HolidayPresent", len(users.LoggedIn))
+	msg := fmt.Sprintf("The %d current viewers have been given a bonus mile, too HolidayPresent", users.Session.Len())
 	Say(msg)
 }
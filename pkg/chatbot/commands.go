@@ -8,16 +8,20 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
 	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/adanalife/tripbot/pkg/teams"
 
 	"github.com/adanalife/tripbot/pkg/background"
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
+	"github.com/adanalife/tripbot/pkg/events"
 	"github.com/adanalife/tripbot/pkg/helpers"
 	"github.com/adanalife/tripbot/pkg/users"
 	"github.com/adanalife/tripbot/pkg/video"
@@ -30,10 +34,8 @@ var lastHelloTime time.Time = time.Now()
 
 var currentVersion string
 
-// this is the scoreboard name used for counting correct guesses
-const guessScoreboard = "guess_state_total"
-
-//TODO: incorrect guess scoreboard?
+// this is the scoreboard name used for counting incorrect guesses
+const incorrectGuessScoreboard = "incorrect_guess_state_total"
 
 func helpCmd(user *users.User) {
 	log.Println(user.Username, "ran !help")
@@ -132,6 +134,7 @@ func milesCmd(user *users.User, params []string) {
 
 	msg := "@%s has %.2fmi this month"
 	msg = fmt.Sprintf(msg, username, monthlyMiles)
+	msg += monthlyStanding(username)
 
 	// add total miles if they have been around for more than one month
 	if lifetimeMiles > monthlyMiles {
@@ -201,16 +204,38 @@ func locationCmd(user *users.User) {
 	Say(msg)
 }
 
+// monthlyStanding describes where a user is on this month's
+// miles leaderboard (ex: " (#14, 2.3mi behind #13)")
+func monthlyStanding(username string) string {
+	board, err := scoreboards.Current(scoreboards.KindMiles, scoreboards.Monthly)
+	if err != nil {
+		return ""
+	}
+	standing, err := board.Standing(username)
+	if err != nil {
+		return ""
+	}
+	if standing.Ahead == nil {
+		return fmt.Sprintf(" (#%d)", standing.Rank)
+	}
+	return fmt.Sprintf(" (#%d, %.1fmi behind #%d)", standing.Rank, standing.Behind(), standing.Ahead.Rank)
+}
+
 func monthlyMilesLeaderboardCmd(user *users.User) {
 	log.Println(user.Username, "ran !leaderboard")
 
 	// select users to show in leaderboard
 	size := 10
-	leaderboard := scoreboards.TopUsers(scoreboards.CurrentMilesScoreboard(), size)
-	if size > len(leaderboard) {
-		size = len(leaderboard)
+	board, err := scoreboards.Current(scoreboards.KindMiles, scoreboards.Monthly)
+	if err != nil {
+		return
 	}
-	leaderboard = leaderboard[:size]
+	entries, err := board.Top(size)
+	if err != nil {
+		return
+	}
+	size = len(entries)
+	leaderboard := scoreboards.Pairs(entries, "%.1f")
 
 	// display leaderboard on screen
 	onscreensClient.ShowLeaderboard("Monthly Miles", leaderboard)
@@ -226,27 +251,49 @@ func monthlyMilesLeaderboardCmd(user *users.User) {
 	Say(msg)
 }
 
-func lifetimeMilesLeaderboardCmd(user *users.User) {
+func lifetimeMilesLeaderboardCmd(user *users.User, params []string) {
 	log.Println(user.Username, "ran !totalleaderboard")
 
-	// select users to show in leaderboard
-	size := 10
-	if size > len(users.LifetimeMilesLeaderboard) {
-		size = len(users.LifetimeMilesLeaderboard)
+	// an optional page number can be given (ex: !tlb 2)
+	page := 1
+	if len(params) > 0 {
+		if p, err := strconv.Atoi(params[0]); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	leaderboard, err := users.LifetimeLeaderboard(page, 10)
+	if err != nil {
+		return
+	}
+	if len(leaderboard) == 0 {
+		Say(fmt.Sprintf("There's nobody on page %d of the leaderboard", page))
+		return
 	}
-	leaderboard := users.LifetimeMilesLeaderboard[:size]
 
 	// display leaderboard on screen
-	onscreensClient.ShowLeaderboard("Total Miles", leaderboard)
+	var pairs [][]string
+	for _, entry := range leaderboard {
+		pairs = append(pairs, []string{entry.Username, fmt.Sprintf("%.1f", entry.Miles)})
+	}
+	onscreensClient.ShowLeaderboard("Total Miles", pairs)
 
 	// build a message to send to chat
-	msg := fmt.Sprintf("Top %d lifetime miles: ", size)
-	for i, leaderPair := range leaderboard {
-		msg += fmt.Sprintf("%d. %s (%smi)", i+1, leaderPair[0], leaderPair[1])
+	msg := "Top lifetime miles: "
+	if page > 1 {
+		msg = fmt.Sprintf("Lifetime miles (page %d): ", page)
+	}
+	for i, entry := range leaderboard {
+		msg += fmt.Sprintf("%d. %s (%.1fmi)", entry.Rank, entry.Username, entry.Miles)
 		if i+1 != len(leaderboard) {
 			msg += ", "
 		}
 	}
+
+	// let the user know where they are
+	if entry, ok, err := users.LifetimeRank(user.Username); err == nil && ok {
+		msg += fmt.Sprintf(" (you're #%d with %.1fmi)", entry.Rank, entry.Miles)
+	}
 	Say(msg)
 }
 
@@ -255,41 +302,132 @@ func monthlyGuessLeaderboardCmd(user *users.User) {
 
 	// select users to show in leaderboard
 	size := 10
-	leaderboard := scoreboards.TopUsers(scoreboards.CurrentGuessScoreboard(), size)
+	board, err := scoreboards.Current(scoreboards.KindGuessPoints, scoreboards.Monthly)
+	if err != nil {
+		return
+	}
+	entries, err := board.Top(size)
+	if err != nil {
+		return
+	}
 
 	// special message if the leaderboard is empty
-	if len(leaderboard) == 0 {
+	if len(entries) == 0 {
 		Say("No one is on that leaderboard yet!")
 		return
 	}
+	size = len(entries)
 
-	// truncate the leaderboard if necessary
-	if size > len(leaderboard) {
-		size = len(leaderboard)
-	}
-	leaderboard = leaderboard[:size]
-
-	var intLeaderboard [][]string
-	for _, leaderPair := range leaderboard {
-		// guesses are ints not floats, so remove the decimal place
-		intVersion := strings.Split(leaderPair[1], ".")[0]
-		intLeaderboard = append(intLeaderboard, []string{leaderPair[0], intVersion})
-	}
+	// hints and bonus guesses give out partial points
+	pointsLeaderboard := scoreboards.Pairs(entries, "%.1f")
 
 	// display leaderboard on screen
-	onscreensClient.ShowLeaderboard("Correct Guesses This Month", intLeaderboard)
+	onscreensClient.ShowLeaderboard("Guess Points This Month", pointsLeaderboard)
 
 	// build a message to send to chat
-	msg := fmt.Sprintf("Top %d correct guesses this month: ", size)
-	for i, leaderPair := range intLeaderboard {
+	msg := fmt.Sprintf("Top %d guess points this month: ", size)
+	for i, leaderPair := range pointsLeaderboard {
 		msg += fmt.Sprintf("%d. %s (%s)", i+1, leaderPair[0], leaderPair[1])
-		if i+1 != len(intLeaderboard) {
+		if i+1 != len(pointsLeaderboard) {
 			msg += ", "
 		}
 	}
 	Say(msg)
 }
 
+// hallOfFameCmd lists the past monthly winners
+func hallOfFameCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !halloffame")
+
+	kind, unit := scoreboards.KindMiles, "mi"
+	if len(params) > 0 && strings.HasPrefix(params[0], "guess") {
+		kind, unit = scoreboards.KindGuessPoints, " points"
+	}
+
+	winners, err := scoreboards.HallOfFame(kind, 6)
+	if err != nil {
+		return
+	}
+	if len(winners) == 0 {
+		Say("Nobody is in the hall of fame yet, it could be you!")
+		return
+	}
+
+	var months []string
+	for _, winner := range winners {
+		months = append(months, fmt.Sprintf("%s: %s (%.0f%s)", winner.PeriodStart.Time.Format("Jan 2006"), winner.Username, winner.Value, unit))
+	}
+	Say("Hall of fame: " + strings.Join(months, ", "))
+}
+
+func joinCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !join")
+
+	if len(params) == 0 {
+		all, err := teams.All()
+		if err != nil {
+			return
+		}
+		var names []string
+		for _, team := range all {
+			names = append(names, fmt.Sprintf("%s (!join %s)", team.Title, team.Name))
+		}
+		Say("Pick a team for this season: " + strings.Join(names, ", "))
+		return
+	}
+
+	team, err := teams.Find(strings.Join(params, ""))
+	if err == teams.ErrNoSuchTeam {
+		Say("I don't know that team, try !join to see them all")
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	err = teams.Join(user.Username, team)
+	if err == teams.ErrAlreadyJoined {
+		if current, err := teams.TeamOf(user.Username); err == nil {
+			Say(fmt.Sprintf("@%s you're already on team %s this season", user.Username, current.Title))
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	Say(fmt.Sprintf("@%s joined team %s! Your miles and guess points count for the team this season", user.Username, team.Title))
+}
+
+func teamsCmd(user *users.User) {
+	log.Println(user.Username, "ran !teams")
+
+	season, err := teams.CurrentSeason()
+	if err != nil {
+		return
+	}
+	standings, err := season.Standings()
+	if err != nil || len(standings) == 0 {
+		return
+	}
+
+	// display the standings on screen
+	var pairs [][]string
+	var places []string
+	for _, standing := range standings {
+		pairs = append(pairs, []string{standing.Title, fmt.Sprintf("%.0f", standing.Score())})
+		places = append(places, fmt.Sprintf("%d. %s (%.0f points, %d members)", standing.Rank, standing.Title, standing.Score(), standing.Members))
+	}
+	onscreensClient.ShowLeaderboard("Team Standings", pairs)
+
+	msg := fmt.Sprintf("Team standings until %s: %s", season.EndsAt.Local().Format("Jan 2"), strings.Join(places, ", "))
+	if team, err := teams.TeamOf(user.Username); err == nil {
+		msg += fmt.Sprintf(" (you're on team %s)", team.Title)
+	} else {
+		msg += " (pick a team with !join)"
+	}
+	Say(msg)
+}
+
 func timeCmd(user *users.User) {
 	log.Println(user.Username, "ran !time")
 	var err error
@@ -340,7 +478,7 @@ func guessCmd(user *users.User, params []string) {
 	var msg string
 
 	if len(params) == 0 {
-		msg = "Try and guess what state we're in! For example: !guess CA"
+		msg = "Try and guess what state we're in! For example: !guess CA (or try !guess city and !guess county for bonus points)"
 		Say(msg)
 		return
 	}
@@ -354,6 +492,19 @@ func guessCmd(user *users.User, params []string) {
 		return
 	}
 
+	// get the currently-playing video
+	vid := currentGuessVideo()
+
+	// the harder guesses are worth more points
+	switch strings.ToLower(params[0]) {
+	case "city", "town":
+		guessCityCmd(user, vid, params[1:])
+		return
+	case "county", "parish":
+		guessCountyCmd(user, vid, params[1:])
+		return
+	}
+
 	// get the arg from the command
 	guess := strings.Join(params, " ")
 
@@ -363,24 +514,59 @@ func guessCmd(user *users.User, params []string) {
 		guess = helpers.StateAbbrevToState(guess)
 	}
 
-	// get the currently-playing video
-	vid := video.CurrentlyPlaying
-	if vid.Flagged {
-		Say("I couldn't figure out current GPS coords, using next closest...")
-		vid = vid.Next()
+	// don't record chatter that isn't a guess
+	if helpers.StateToStateAbbrev(guess) == "" {
+		Say("I don't know that state! Try something like: !guess CA or !guess California")
+		return
 	}
 
-	if strings.ToLower(guess) == strings.ToLower(vid.State) {
-		msg = fmt.Sprintf("@%s got it! We're in %s", user.Username, vid.State)
-		// show the flag for the state
-		onscreensClient.ShowFlag(10 * time.Second)
-		// increase their guess score
-		user.AddToScore(guessScoreboard, 1.0)
-		user.AddToScore(scoreboards.CurrentGuessScoreboard(), 1.0)
-		// do a timewarp
-		timewarp()
-	} else {
-		msg = "Try again! EarthDay"
+	correct := strings.ToLower(guess) == strings.ToLower(vid.State)
+	if !correct {
+		// record the guess so we can see which states people get wrong
+		events.Guess(user.Username, helpers.TitlecaseState(guess), vid.State, false)
+		user.AddToScore(incorrectGuessScoreboard, 1.0)
+		Say("Try again! EarthDay")
+		return
+	}
+
+	// only the first right answer wins the round (and the guess points)
+	points, won := claimWin(user, vid, roundStarted(vid), statePoints)
+	events.Guess(user.Username, helpers.TitlecaseState(guess), vid.State, won)
+	if !won {
+		Say(fmt.Sprintf("@%s someone beat you to it!", user.Username))
+		return
+	}
+	msg = fmt.Sprintf("@%s got it! We're in %s (+%.2f points)", user.Username, vid.State, points)
+	// show the flag for the state
+	onscreensClient.ShowFlag(10 * time.Second)
+	// do a timewarp
+	timewarp(user.Username, "guess")
+	Say(msg)
+}
+
+// guessStatsCmd shows how good someone is at !guess
+func guessStatsCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !guessstats")
+
+	// they can look up someone else too
+	username := user.Username
+	if len(params) > 0 {
+		username = strings.ToLower(strings.TrimPrefix(params[0], "@"))
+	}
+
+	stats, err := events.UserGuessStats(username)
+	if err != nil {
+		return
+	}
+	if stats.Total == 0 {
+		Say(fmt.Sprintf("@%s hasn't made any guesses yet, try !guess", username))
+		return
+	}
+
+	msg := fmt.Sprintf("@%s has guessed %d of %d correctly (%.0f%%)", username, stats.Correct, stats.Total, stats.Accuracy())
+	missed, err := events.UserMostMissedState(username)
+	if err == nil && missed != "" {
+		msg = fmt.Sprintf("%s, and has the most trouble with %s", msg, missed)
 	}
 	Say(msg)
 }
@@ -408,6 +594,7 @@ func stateCmd(user *users.User) {
 func reportCmd(user *users.User, params []string) {
 	log.Println(user.Username, "ran !report")
 	message := strings.Join(params, " ")
+	events.Report(user.Username, message, video.CurrentlyPlaying.String())
 	message = fmt.Sprintf("Report from Twitch Chat: %s", message)
 	helpers.SendSMS(message)
 	Say("Thank you, I will look into this ASAP!")
@@ -415,14 +602,25 @@ func reportCmd(user *users.User, params []string) {
 
 func bonusMilesCmd(user *users.User) {
 	log.Println(user.Username, "ran !bonusmiles")
+	rules := user.ActiveMilesRules()
+	if len(rules) == 0 {
+		msg := fmt.Sprintf("@%s doesn't have any bonus multipliers right now", user.Username)
+		Say(msg)
+		return
+	}
+
+	var descriptions []string
+	for _, rule := range rules {
+		descriptions = append(descriptions, rule.String())
+	}
 	bonus := user.BonusMiles()
-	msg := fmt.Sprintf("%s has earned %.4f bonus miles this session", user.Username, bonus)
+	msg := fmt.Sprintf("@%s has earned %.4f bonus miles this session from: %s", user.Username, bonus, strings.Join(descriptions, ", "))
 	Say(msg)
 }
 
 func secretInfoCmd(user *users.User) {
 	log.Println(user.Username, "ran !secretinfo")
-	if !c.UserIsAdmin(user.Username) {
+	if !user.IsBroadcaster() {
 		return
 	}
 	vid := video.CurrentlyPlaying
@@ -439,7 +637,7 @@ func secretInfoCmd(user *users.User) {
 
 func shutdownCmd(user *users.User) {
 	log.Println(user.Username, "ran !shutdown")
-	if !c.UserIsAdmin(user.Username) {
+	if !user.IsBroadcaster() {
 		Say("Nice try bucko")
 		return
 	}
@@ -447,6 +645,8 @@ func shutdownCmd(user *users.User) {
 	log.Printf("currently playing: %s", video.CurrentlyPlaying)
 	background.StopCron()
 	users.Shutdown()
+	// write any events that are still buffered
+	events.StopWriter()
 	err := database.Connection().Close()
 	if err != nil {
 		log.Println(err)
@@ -455,12 +655,54 @@ func shutdownCmd(user *users.User) {
 	os.Exit(0)
 }
 
+// roleCmd shows someone's role, and lets the broadcaster
+// change it (ex: !role someone mod, or !role someone reset)
+func roleCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !role")
+
+	if len(params) == 0 {
+		Say(fmt.Sprintf("@%s you're a %s", user.Username, user.Role()))
+		return
+	}
+
+	username := helpers.StripAtSign(params[0])
+	if len(params) == 1 {
+		if !user.IsModerator() {
+			return
+		}
+		other := users.User{Username: username}
+		Say(fmt.Sprintf("%s is a %s", username, other.Role()))
+		return
+	}
+
+	// only the broadcaster can hand out roles
+	if !user.IsBroadcaster() {
+		return
+	}
+	if params[1] == "reset" {
+		if users.ResetRole(username) == nil {
+			Say(fmt.Sprintf("Got it! %s's role comes from their badges again", username))
+		}
+		return
+	}
+	role, err := users.ParseRole(params[1])
+	if err != nil {
+		Say("Usage: !role <user> [viewer|subscriber|vip|mod|reset]")
+		return
+	}
+	// the role is saved against their user
+	users.FindOrCreate(username)
+	if users.SetRole(username, role, user.Username) == nil {
+		Say(fmt.Sprintf("Got it! %s is a %s now", username, role))
+	}
+}
+
 //TODO: this will always be lower case, find out why
 // middleCmd sets the text at the bottom-middle of the stream
 func middleCmd(user *users.User, params []string) {
 	log.Println(user.Username, "ran !middle")
-	// don't let strangers run this
-	if !c.UserIsAdmin(user.Username) {
+	// only mods can run this
+	if !user.IsModerator() {
 		return
 	}
 
@@ -473,7 +715,7 @@ func middleCmd(user *users.User, params []string) {
 	// if the arg was "hide", hide the text from view
 	if len(params) == 1 && strings.ToLower(params[0]) == "hide" {
 		Say("Got it! Hiding the message.")
-		onscreensClient.HideMiddleText()
+		hideMiddleText()
 		return
 	}
 
@@ -483,5 +725,38 @@ func middleCmd(user *users.User, params []string) {
 	// just to help debug
 	log.Printf("setting middle text to: %s", text)
 
-	onscreensClient.ShowMiddleText(text)
+	showMiddleText(text)
+}
+
+// middleTextID changes every time the middle text does, it's used
+// so we only hide text if it hasn't been replaced since we showed it
+var middleTextID uint64
+var middleTextMutex sync.Mutex
+
+// showMiddleText sets the middle text and returns its ID
+func showMiddleText(text string) (uint64, error) {
+	middleTextMutex.Lock()
+	defer middleTextMutex.Unlock()
+	middleTextID++
+	return middleTextID, onscreensClient.ShowMiddleText(text)
+}
+
+// hideMiddleText hides whatever middle text is showing
+func hideMiddleText() {
+	middleTextMutex.Lock()
+	defer middleTextMutex.Unlock()
+	middleTextID++
+	onscreensClient.HideMiddleText()
+}
+
+// hideMiddleTextIfShowing hides the middle text, but only
+// if it's still the text with the given ID
+func hideMiddleTextIfShowing(id uint64) {
+	middleTextMutex.Lock()
+	defer middleTextMutex.Unlock()
+	if middleTextID != id {
+		return
+	}
+	middleTextID++
+	onscreensClient.HideMiddleText()
 }
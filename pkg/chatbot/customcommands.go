@@ -0,0 +1,185 @@
+package chatbot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/commands"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/users"
+	"github.com/hako/durafmt"
+)
+
+const addCmdUsage = "Usage: %s !name [cooldown=<seconds>] <response> (you can use {user}, {state}, {city}, {miles}, and {uptime})"
+
+// command names are a single word
+var commandName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// errCustomCommandUsage is returned when !addcmd or !editcmd is missing something
+var errCustomCommandUsage = errors.New("invalid custom command")
+
+// errBuiltinCommand is returned when a custom command uses a built-in name
+var errBuiltinCommand = errors.New("that name is used by a built-in command")
+
+// errChatCommandResponse is returned for responses that would run a chat command
+var errChatCommandResponse = errors.New("it can't start with / or .")
+
+// isChatCommand returns true if Twitch would treat the text as a
+// chat command (ex: "/ban" or ".timeout") instead of posting it
+func isChatCommand(text string) bool {
+	return strings.HasPrefix(text, "/") || strings.HasPrefix(text, ".")
+}
+
+// canManageCommands returns true if the user can add and remove custom commands
+func canManageCommands(user *users.User) bool {
+	return user.IsModerator()
+}
+
+// customCmd runs a custom command, it returns false if there isn't one
+func customCmd(user *users.User, command string) bool {
+	cmd, ok := commands.Find(command)
+	if !ok {
+		return false
+	}
+	log.Println(user.Username, "ran custom command", command)
+	// quietly ignore commands that are on cooldown
+	if !commands.Use(cmd) {
+		return true
+	}
+	Say(commands.Render(cmd.Response, templateVars(user)))
+	return true
+}
+
+// templateVars are the variables that can be used in custom commands
+func templateVars(user *users.User) map[string]func() string {
+	return map[string]func() string{
+		"user": func() string {
+			return user.Username
+		},
+		"state": func() string {
+			return currentGuessVideo().State
+		},
+		"city": func() string {
+			lat, lng, err := currentGuessVideo().Location()
+			if err != nil {
+				return "somewhere"
+			}
+			city, err := helpers.CityFromCoords(lat, lng)
+			if err != nil {
+				return "somewhere"
+			}
+			return city
+		},
+		"miles": func() string {
+			return fmt.Sprintf("%.1f", user.CurrentMiles())
+		},
+		"uptime": func() string {
+			return durafmt.ParseShort(time.Since(Uptime)).String()
+		},
+	}
+}
+
+// parseCustomCommand splits the params for !addcmd and !editcmd into
+// the name, cooldown (zero if not given), and response
+func parseCustomCommand(rawParams []string) (string, int, string, error) {
+	if len(rawParams) < 2 {
+		return "", 0, "", errCustomCommandUsage
+	}
+	name := commands.Normalize(rawParams[0])
+	if !commandName.MatchString(name) {
+		return "", 0, "", errCustomCommandUsage
+	}
+	if builtinCommands["!"+name] || builtinCommands[name] {
+		return "", 0, "", errBuiltinCommand
+	}
+	rest := rawParams[1:]
+	var cooldown int
+	if strings.HasPrefix(strings.ToLower(rest[0]), "cooldown=") {
+		cooldown, _ = strconv.Atoi(rest[0][len("cooldown="):])
+		rest = rest[1:]
+	}
+	response := strings.TrimSpace(strings.Join(rest, " "))
+	if response == "" {
+		return "", 0, "", errCustomCommandUsage
+	}
+	if isChatCommand(response) {
+		return "", 0, "", errChatCommandResponse
+	}
+	return name, cooldown, response, nil
+}
+
+func addCmdCmd(user *users.User, rawParams []string) {
+	log.Println(user.Username, "ran !addcmd")
+	if !canManageCommands(user) {
+		return
+	}
+	name, cooldown, response, err := parseCustomCommand(rawParams)
+	if err == errCustomCommandUsage {
+		Say(fmt.Sprintf(addCmdUsage, "!addcmd"))
+		return
+	}
+	if err != nil {
+		Say(fmt.Sprintf("I can't save that command, %s", err))
+		return
+	}
+	cmd, err := commands.Add(name, response, cooldown, user.Username)
+	if err == commands.ErrExists {
+		Say(fmt.Sprintf("!%s already exists, try !editcmd instead", name))
+		return
+	}
+	if err != nil {
+		return
+	}
+	Say(fmt.Sprintf("Added !%s (%ds cooldown)", cmd.Name, cmd.CooldownSeconds))
+}
+
+func editCmdCmd(user *users.User, rawParams []string) {
+	log.Println(user.Username, "ran !editcmd")
+	if !canManageCommands(user) {
+		return
+	}
+	name, cooldown, response, err := parseCustomCommand(rawParams)
+	if err == errCustomCommandUsage {
+		Say(fmt.Sprintf(addCmdUsage, "!editcmd"))
+		return
+	}
+	if err != nil {
+		Say(fmt.Sprintf("I can't save that command, %s", err))
+		return
+	}
+	cmd, err := commands.Edit(name, response, cooldown, user.Username)
+	if err == commands.ErrNotFound {
+		Say(fmt.Sprintf("There's no !%s, try !addcmd instead", name))
+		return
+	}
+	if err != nil {
+		return
+	}
+	Say(fmt.Sprintf("Updated !%s (%ds cooldown)", cmd.Name, cmd.CooldownSeconds))
+}
+
+func delCmdCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !delcmd")
+	if !canManageCommands(user) {
+		return
+	}
+	if len(params) == 0 {
+		Say("Usage: !delcmd !name")
+		return
+	}
+	name := commands.Normalize(params[0])
+	err := commands.Delete(name)
+	if err == commands.ErrNotFound {
+		Say(fmt.Sprintf("There's no !%s", name))
+		return
+	}
+	if err != nil {
+		return
+	}
+	Say(fmt.Sprintf("Removed !%s", name))
+}
@@ -0,0 +1,113 @@
+package chatbot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/users"
+)
+
+// these are the things users can spend their miles on
+var spendPrices = map[string]float32{
+	"timewarp": 5.0,
+	"middle":   10.0,
+	"jump":     10.0,
+}
+
+// paid middle text is hidden after this long
+var paidMiddleTextDuration = 30 * time.Second
+
+// paid middle text can't be longer than this
+var maxPaidMiddleTextLength = 60
+
+func balanceCmd(user *users.User) {
+	log.Println(user.Username, "ran !balance")
+	msg := fmt.Sprintf("@%s has %.2fmi to spend. Try !spend to see what you can buy", user.Username, user.SpendableMiles())
+	Say(msg)
+}
+
+func spendCmd(user *users.User, params []string) {
+	log.Println(user.Username, "ran !spend")
+
+	// list the prices if they didn't say what to buy
+	if len(params) == 0 {
+		msg := fmt.Sprintf("Spend your miles on: !spend timewarp (%.0fmi), !spend jump [state] (%.0fmi), !spend middle [message] (%.0fmi)",
+			spendPrices["timewarp"], spendPrices["jump"], spendPrices["middle"],
+		)
+		Say(msg)
+		return
+	}
+
+	// exit early if we're on OS X
+	if helpers.RunningOnDarwin() {
+		Say("Sorry, that isn't available right now")
+		return
+	}
+
+	item := strings.ToLower(params[0])
+	args := params[1:]
+
+	price, ok := spendPrices[item]
+	if !ok {
+		Say("Usage: !spend [timewarp|jump|middle]")
+		return
+	}
+
+	// validate the args before taking any miles
+	switch item {
+	case "jump":
+		if len(args) == 0 || len(args) > 2 {
+			Say("Usage: !spend jump [state]")
+			return
+		}
+	case "middle":
+		if len(args) == 0 {
+			Say("Usage: !spend middle [message]")
+			return
+		}
+		if len(strings.Join(args, " ")) > maxPaidMiddleTextLength {
+			Say(fmt.Sprintf("That message is too long, keep it under %d characters", maxPaidMiddleTextLength))
+			return
+		}
+	}
+
+	err := user.SpendMiles(price, item)
+	if _, ok := err.(*terrors.InsufficientMilesError); ok {
+		msg := fmt.Sprintf("@%s that costs %.0fmi, but you only have %.2fmi", user.Username, price, user.SpendableMiles())
+		Say(msg)
+		return
+	}
+	if err != nil {
+		terrors.Log(err, "error spending miles")
+		Say("Something went wrong, try again later")
+		return
+	}
+
+	switch item {
+	case "timewarp":
+		Say(fmt.Sprintf("@%s spent %.0fmi on a timewarp, here we go...!", user.Username, price))
+		timewarp(user.Username, "spend")
+	case "jump":
+		// give them their miles back if the jump didn't work
+		if !jumpToState(user.Username, args) {
+			user.RefundMiles(price, item)
+		}
+	case "middle":
+		text := strings.Join(args, " ")
+		log.Printf("setting paid middle text to: %s", text)
+		id, err := showMiddleText(fmt.Sprintf("%s: %s", user.Username, text))
+		if err != nil {
+			user.RefundMiles(price, item)
+			Say("Something went wrong, your miles have been refunded")
+			return
+		}
+		// don't hide it if someone else changed it in the meantime
+		time.AfterFunc(paidMiddleTextDuration, func() {
+			hideMiddleTextIfShowing(id)
+		})
+	}
+}
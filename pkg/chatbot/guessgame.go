@@ -0,0 +1,376 @@
+package chatbot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/adanalife/tripbot/pkg/users"
+	"github.com/adanalife/tripbot/pkg/video"
+	"github.com/hako/durafmt"
+	"github.com/kelvins/geocoder"
+)
+
+// how many points each kind of guess is worth, before any hints
+const (
+	statePoints   = 1.0
+	countyPoints  = 3.0
+	cityMaxPoints = 5.0
+	// each hint takes this much off of the reward
+	hintPenalty  = 0.25
+	maxHints     = 3
+	hintCooldown = 20 * time.Second
+	// city guesses this close get full points,
+	// and guesses this far away get nothing
+	cityFullPointsMiles = 5.0
+	cityNoPointsMiles   = 50.0
+	// people have to wait this long after a wrong city or county
+	// guess, since city guesses use the (paid) geocoding API
+	wrongGuessCooldown = 15 * time.Second
+	// this many geocoded cities are cached before we start over
+	maxCachedCities = 1000
+)
+
+// guessRound keeps track of the hints that have been given since the
+// last timewarp. Hints lower the reward for everyone guessing
+type guessRound struct {
+	started  time.Time
+	state    string
+	hints    int
+	lastHint time.Time
+	// won is set once someone gets it right, so two people
+	// can't win the same round before the timewarp
+	won bool
+
+	// address is looked up the first time someone guesses
+	// a city or county, and cached for that video
+	address     *geocoder.Address
+	addressSlug string
+}
+
+var round guessRound
+var roundMutex sync.Mutex
+
+// currentRound returns the round for the video, and starts a new
+// one if there's been a timewarp (or we've crossed into a new state)
+// it must be called with roundMutex held
+func currentRound(vid video.Video) *guessRound {
+	if round.started.Before(lastTimewarpTime) || round.state != vid.State {
+		round = guessRound{started: time.Now(), state: vid.State}
+	}
+	return &round
+}
+
+// multiplier is how much of the full reward a correct guess is worth
+func (r *guessRound) multiplier() float32 {
+	return 1.0 - hintPenalty*float32(r.hints)
+}
+
+// roundAddress returns the address of the video, it's looked up once
+// per video. The lookup is done without holding roundMutex
+func roundAddress(vid video.Video) (geocoder.Address, error) {
+	roundMutex.Lock()
+	r := currentRound(vid)
+	if r.address != nil && r.addressSlug == vid.Slug {
+		address := *r.address
+		roundMutex.Unlock()
+		return address, nil
+	}
+	roundMutex.Unlock()
+
+	address, err := helpers.AddressFromCoords(vid.Lat, vid.Lng)
+	if err != nil {
+		return address, err
+	}
+
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	r = currentRound(vid)
+	r.address = &address
+	r.addressSlug = vid.Slug
+	return address, nil
+}
+
+// roundStarted returns when the current round started
+func roundStarted(vid video.Video) time.Time {
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	return currentRound(vid).started
+}
+
+// claimWin awards the points (minus any hints) to the user if nobody else
+// has won the round that started at the given time. It returns the points
+// they got, or false if someone beat them to it
+func claimWin(user *users.User, vid video.Video, started time.Time, points float32) (float32, bool) {
+	roundMutex.Lock()
+	r := currentRound(vid)
+	if r.won || !r.started.Equal(started) {
+		roundMutex.Unlock()
+		return 0, false
+	}
+	r.won = true
+	points = points * r.multiplier()
+	roundMutex.Unlock()
+
+	awardGuessPoints(user, points)
+	return points, true
+}
+
+// wrongGuesses is when each user last made a wrong city or county guess
+var wrongGuesses = make(map[string]time.Time)
+var wrongGuessesMutex sync.Mutex
+
+// wrongGuessCooldownRemaining returns how long the user has to
+// wait before they can guess a city or county again
+func wrongGuessCooldownRemaining(username string) time.Duration {
+	wrongGuessesMutex.Lock()
+	defer wrongGuessesMutex.Unlock()
+	remaining := wrongGuessCooldown - time.Since(wrongGuesses[username])
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// recordWrongGuess starts the user's wrong guess cooldown
+func recordWrongGuess(username string) {
+	wrongGuessesMutex.Lock()
+	defer wrongGuessesMutex.Unlock()
+	// forget about the old ones while we're here
+	for name, guessedAt := range wrongGuesses {
+		if time.Since(guessedAt) > wrongGuessCooldown {
+			delete(wrongGuesses, name)
+		}
+	}
+	wrongGuesses[username] = time.Now()
+}
+
+// cityLocation is the result of geocoding a city
+type cityLocation struct {
+	lat, lng float64
+	err      error
+}
+
+// cityLocations caches geocoded cities, keyed by city and state
+var cityLocations = make(map[string]cityLocation)
+var cityLocationsMutex sync.Mutex
+
+// coordsFromCity is helpers.CoordsFromCity, but cached so
+// people guessing the same city don't cost us anything
+func coordsFromCity(city, state string) (float64, float64, error) {
+	key := strings.ToLower(city + ", " + state)
+	cityLocationsMutex.Lock()
+	loc, ok := cityLocations[key]
+	cityLocationsMutex.Unlock()
+	if ok {
+		return loc.lat, loc.lng, loc.err
+	}
+
+	lat, lng, err := helpers.CoordsFromCity(city, state)
+	// cache cities that don't exist too, but not other errors
+	// (ex: timeouts) since those might work next time
+	if err == nil || err.Error() == "No results found." {
+		cityLocationsMutex.Lock()
+		if len(cityLocations) >= maxCachedCities {
+			cityLocations = make(map[string]cityLocation)
+		}
+		cityLocations[key] = cityLocation{lat: lat, lng: lng, err: err}
+		cityLocationsMutex.Unlock()
+	}
+	return lat, lng, err
+}
+
+// nextHint returns the next hint for the round
+func (r *guessRound) nextHint(vid video.Video) string {
+	var hint string
+	switch r.hints {
+	case 0:
+		if tz := helpers.TimeZoneName(vid.Lat, vid.Lng); tz != "" {
+			hint = fmt.Sprintf("We're in the %s time zone", tz)
+			break
+		}
+		fallthrough
+	case 1:
+		if region := helpers.StateRegion(vid.State); region != "" {
+			hint = fmt.Sprintf("We're somewhere in the %s", region)
+			break
+		}
+		fallthrough
+	default:
+		hint = fmt.Sprintf("The state starts with %s", strings.ToUpper(vid.State[:1]))
+	}
+	r.hints++
+	r.lastHint = time.Now()
+	return hint
+}
+
+// currentGuessVideo returns the video people are guessing about
+func currentGuessVideo() video.Video {
+	vid := video.CurrentlyPlaying
+	if vid.Flagged {
+		Say("I couldn't figure out current GPS coords, using next closest...")
+		vid = vid.Next()
+	}
+	return vid
+}
+
+// awardGuessPoints adds to the user's guess points
+func awardGuessPoints(user *users.User, points float32) {
+	err := scoreboards.AddToPeriods(user.Username, scoreboards.KindGuessPoints, points, scoreboards.Monthly, scoreboards.AllTime)
+	if err != nil {
+		terrors.Log(err, "error adding guess points")
+	}
+}
+
+func hintCmd(user *users.User) {
+	log.Println(user.Username, "ran !hint")
+
+	vid := currentGuessVideo()
+	if vid.State == "" {
+		Say("I don't have any hints right now, sorry!")
+		return
+	}
+
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	r := currentRound(vid)
+
+	if r.hints >= maxHints {
+		Say("That's all the hints I've got! Try !guess")
+		return
+	}
+	if time.Now().Sub(r.lastHint) < hintCooldown {
+		Say("Not yet, give people a chance to guess!")
+		return
+	}
+
+	hint := r.nextHint(vid)
+	msg := fmt.Sprintf("Hint %d of %d: %s (guesses are now worth %.0f%%)", r.hints, maxHints, hint, 100*r.multiplier())
+	Say(msg)
+}
+
+// guessCountyCmd is used when people run !guess county
+func guessCountyCmd(user *users.User, vid video.Video, params []string) {
+	if len(params) == 0 {
+		Say("Guess what county we're in for bonus points! For example: !guess county Boulder")
+		return
+	}
+	if waitForWrongGuessCooldown(user) {
+		return
+	}
+	guess := strings.Join(params, " ")
+	started := roundStarted(vid)
+
+	address, err := roundAddress(vid)
+	if err != nil || address.County == "" {
+		if err != nil {
+			terrors.Log(err, "error looking up county")
+		}
+		Say("I couldn't figure out what county we're in, sorry!")
+		return
+	}
+
+	if helpers.NormalizeCounty(guess) != helpers.NormalizeCounty(address.County) {
+		recordWrongGuess(user.Username)
+		Say("Try again! EarthDay")
+		return
+	}
+
+	points, ok := claimWin(user, vid, started, countyPoints)
+	if !ok {
+		Say(fmt.Sprintf("@%s someone beat you to it!", user.Username))
+		return
+	}
+	Say(fmt.Sprintf("@%s got it! We're in %s, %s (+%.2f points)", user.Username, address.County, vid.State, points))
+	onscreensClient.ShowFlag(10 * time.Second)
+	timewarp(user.Username, "guess")
+}
+
+// guessCityCmd is used when people run !guess city, the closer
+// the city is to where we actually are the more points it's worth
+func guessCityCmd(user *users.User, vid video.Video, params []string) {
+	if len(params) == 0 {
+		Say("Guess what city we're near for bonus points! For example: !guess city Denver (or Denver, CO)")
+		return
+	}
+	if waitForWrongGuessCooldown(user) {
+		return
+	}
+	guess := strings.Title(strings.Join(params, " "))
+	started := roundStarted(vid)
+
+	address, err := roundAddress(vid)
+	if err != nil {
+		terrors.Log(err, "error looking up city")
+		Say("I couldn't figure out what city we're near, sorry!")
+		return
+	}
+
+	// people can say which state they mean (ex: "Springfield, IL"), we
+	// never fill in the real state since that would give it away
+	city, state := guess, ""
+	if i := strings.LastIndex(guess, ","); i >= 0 {
+		city, state = strings.TrimSpace(guess[:i]), strings.TrimSpace(guess[i+1:])
+	}
+
+	var distance float64
+	if !strings.EqualFold(city, address.City) {
+		lat, lng, err := coordsFromCity(city, state)
+		if err != nil {
+			recordWrongGuess(user.Username)
+			Say(fmt.Sprintf("I couldn't find %s, try again!", guess))
+			return
+		}
+		distance = helpers.DistanceInMiles(vid.Lat, vid.Lng, lat, lng)
+	}
+
+	points := cityPoints(distance)
+	if points <= 0 {
+		recordWrongGuess(user.Username)
+		Say(fmt.Sprintf("Not quite! %s is %.0f miles away", guess, distance))
+		return
+	}
+
+	points, ok := claimWin(user, vid, started, points)
+	if !ok {
+		Say(fmt.Sprintf("@%s someone beat you to it!", user.Username))
+		return
+	}
+	where := address.City
+	if where == "" {
+		where = fmt.Sprintf("somewhere in %s", vid.State)
+	}
+	msg := fmt.Sprintf("@%s guessed %s, %.0f miles away! We're near %s (+%.2f points)", user.Username, guess, distance, where, points)
+	Say(msg)
+	onscreensClient.ShowFlag(10 * time.Second)
+	timewarp(user.Username, "guess")
+}
+
+// waitForWrongGuessCooldown tells the user to wait if they made a wrong
+// city or county guess recently, it returns true if they have to wait
+func waitForWrongGuessCooldown(user *users.User) bool {
+	remaining := wrongGuessCooldownRemaining(user.Username)
+	if remaining <= 0 {
+		return false
+	}
+	Say(fmt.Sprintf("@%s slow down! Try again in %s", user.Username, durafmt.ParseShort(remaining)))
+	return true
+}
+
+// cityPoints returns the points for guessing a city the given distance
+// away, it goes down the further away the guess is
+func cityPoints(distance float64) float32 {
+	if distance <= cityFullPointsMiles {
+		return cityMaxPoints
+	}
+	if distance >= cityNoPointsMiles {
+		return 0
+	}
+	return float32(cityMaxPoints * (cityNoPointsMiles - distance) / (cityNoPointsMiles - cityFullPointsMiles))
+}
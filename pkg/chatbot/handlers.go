@@ -3,12 +3,16 @@ package chatbot
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
+	"github.com/adanalife/tripbot/pkg/announcements"
 	mylog "github.com/adanalife/tripbot/pkg/chatbot/log"
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
 	"github.com/adanalife/tripbot/pkg/instrumentation"
+	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
 	"github.com/adanalife/tripbot/pkg/users"
 	"github.com/gempir/go-twitch-irc/v2"
 )
@@ -19,11 +23,9 @@ func incChatCommandCounter(command string) {
 	}
 }
 
-func runCommand(user *users.User, message string) {
-	var err error
+// splitCommand splits a chat message into the command and its params
+func splitCommand(msg string) (string, []string) {
 	var params []string
-
-	msg := strings.TrimSpace(message)
 	split := strings.Split(msg, " ")
 
 	// the command is the first part
@@ -41,11 +43,52 @@ func runCommand(user *users.User, message string) {
 	}
 
 	// handle case where people add a space (like "! location")
-	if command == "!" {
+	if command == "!" && len(params) > 0 {
 		command = command + params[0]
 		// remove the first element from the params
 		params = params[1:]
 	}
+	return command, params
+}
+
+// builtinCommands are the messages handled by runCommand (including the
+// typos), custom commands can't use these names. TestBuiltinCommands
+// checks that every case in runCommand is in here
+var builtinCommands = map[string]bool{
+	"!help": true, "hello": true, "hi": true, "hey": true, "hallo": true, "!bot": true, "!flag": true,
+	"!version": true, "!uptime": true, "!timewarp": true, "!timewrap": true, "!timeskip": true,
+	"!tw": true, "!timewqrp": true, "!warp": true, "!goto": true, "!jump": true, "!skip": true,
+	"!back": true, "!shutdown": true, "!socialmedia": true, "!social": true, "!socials": true,
+	"!commands": true, "!command": true, "¡command": true, "¡commands": true, "!commads": true,
+	"!controls": true, "!commande": true, "!bonusmiles": true, "!balance": true, "!wallet": true,
+	"!spend": true, "!buy": true, "!sunset": true, "!sunet": true, "!time": true, "!timr": true,
+	"!date": true, "!datw": true, "!guess": true, "!guss": true, "guess": true, "!gusss": true,
+	"!guees": true, "!gues": true, "!quess": true, "!guis": true, "!mapguess": true,
+	"!geoguess": true, "!map": true, "!hint": true, "!clue": true, "!guessstats": true, "!gs": true,
+	"!guessstat": true, "!state": true, "!secretinfo": true, "!gas": true, "!fuel": true,
+	"!petrol": true, "!middle": true, "!announce": true, "!announcement": true,
+	"!announcements": true, "!role": true, "!addcmd": true, "!addcommand": true, "!editcmd": true,
+	"!editcommand": true, "!delcmd": true, "!delcommand": true, "!deletecommand": true,
+	"!miles": true, "!points": true, "!km": true, "!kilometres": true, "!kilometers": true,
+	"!tripbot": true, "!location": true, "!city": true, "!town": true, "!where": true,
+	"!loacation": true, "!loation": true, "!loc": true, "!locatioin": true, "!locatoion": true,
+	"!locaton": true, "!loclistion": true, "!locton": true, "1location": true, "¡location": true,
+	"!locatiom": true, "!location!": true, "!locatio": true, "!lcoation": true, "!leaderboard": true,
+	"!monthlyleaderboard": true, "!lb": true, "!mlb": true, "!leaderbord": true, "!ldb": true,
+	"!ldbd": true, "!totalleaderboard": true, "!lifetimeleaderboard": true, "!tlb": true,
+	"!llb": true, "!join": true, "!teams": true, "!team": true, "!halloffame": true, "!hof": true,
+	"!winners": true, "!guessleaderboard": true, "!glb": true, "!report": true, "no audio": true,
+	"no sound": true, "no music": true, "frozen": true, "!trivia": true,
+}
+
+func runCommand(user *users.User, original string) {
+	var err error
+
+	//TODO: we lose capitalization here, is that okay?
+	msg := strings.TrimSpace(strings.ToLower(original))
+	command, params := splitCommand(msg)
+	// some commands save what people type, so they need the original capitalization
+	_, rawParams := splitCommand(strings.TrimSpace(original))
 
 	switch command {
 	case "!help":
@@ -93,10 +136,22 @@ func runCommand(user *users.User, message string) {
 	case "!commands", "!command", "¡command", "¡commands", "!commads", "!controls", "!commande":
 		Say("You can try: !location, !guess, !date, !state, !sunset, !timewarp, !miles, !leaderboard, and many other hidden commands!")
 	case "!bonusmiles":
-		if user.IsSubscriber() {
+		if user.HasCommandAvailable() {
 			bonusMilesCmd(user)
 		} else {
-			Say(subscriberMsg)
+			Say(followerMsg)
+		}
+	case "!balance", "!wallet":
+		if user.HasCommandAvailable() {
+			balanceCmd(user)
+		} else {
+			Say(followerMsg)
+		}
+	case "!spend", "!buy":
+		if user.HasCommandAvailable() {
+			spendCmd(user, params)
+		} else {
+			Say(followerMsg)
 		}
 	case "!sunset", "!sunet":
 		if user.HasCommandAvailable() {
@@ -122,6 +177,20 @@ func runCommand(user *users.User, message string) {
 		} else {
 			Say(followerMsg)
 		}
+	case "!mapguess", "!geoguess", "!map":
+		Say(fmt.Sprintf("Drop a pin where you think we are: %s/geoguess", c.Conf.ExternalURL))
+	case "!hint", "!clue":
+		if user.HasCommandAvailable() {
+			hintCmd(user)
+		} else {
+			Say(followerMsg)
+		}
+	case "!guessstats", "!gs", "!guessstat":
+		if user.HasCommandAvailable() {
+			guessStatsCmd(user, params)
+		} else {
+			Say(followerMsg)
+		}
 	case "!state":
 		if user.HasCommandAvailable() {
 			stateCmd(user)
@@ -134,6 +203,16 @@ func runCommand(user *users.User, message string) {
 		Say("About full, thanks for asking")
 	case "!middle":
 		middleCmd(user, params)
+	case "!announce", "!announcement", "!announcements":
+		announceCmd(user, params, rawParams)
+	case "!role":
+		roleCmd(user, params)
+	case "!addcmd", "!addcommand":
+		addCmdCmd(user, rawParams)
+	case "!editcmd", "!editcommand":
+		editCmdCmd(user, rawParams)
+	case "!delcmd", "!delcommand", "!deletecommand":
+		delCmdCmd(user, params)
 		// any of these should trigger the miles command
 	case "!miles", "!points":
 		if user.HasCommandAvailable() {
@@ -170,12 +249,30 @@ func runCommand(user *users.User, message string) {
 		// trigger the lifetime leaderboard command
 	case "!totalleaderboard", "!lifetimeleaderboard", "!tlb", "!llb":
 		if user.HasCommandAvailable() {
-			lifetimeMilesLeaderboardCmd(user)
+			lifetimeMilesLeaderboardCmd(user, params)
 		} else {
 			Say(followerMsg)
 		}
 
 		// trigger the lifetime leaderboard command
+	case "!join":
+		if user.HasCommandAvailable() {
+			joinCmd(user, params)
+		} else {
+			Say(followerMsg)
+		}
+	case "!teams", "!team":
+		if user.HasCommandAvailable() {
+			teamsCmd(user)
+		} else {
+			Say(followerMsg)
+		}
+	case "!halloffame", "!hof", "!winners":
+		if user.HasCommandAvailable() {
+			hallOfFameCmd(user, params)
+		} else {
+			Say(followerMsg)
+		}
 	case "!guessleaderboard", "!glb":
 		if user.HasCommandAvailable() {
 			monthlyGuessLeaderboardCmd(user)
@@ -192,14 +289,30 @@ func runCommand(user *users.User, message string) {
 		} else {
 			Say(followerMsg)
 		}
+	case "!trivia":
+		if user.HasCommandAvailable() {
+			triviaCmd(user)
+		} else {
+			Say(followerMsg)
+		}
 	default:
 		if strings.HasPrefix(command, "!") {
-			// log the command as an error so we can implement it in the future
-			err = fmt.Errorf("command %s not found", command)
+			// the built-in commands come first, then the ones added in chat
+			if !customCmd(user, command) {
+				// log the command as an error so we can implement it in the future
+				err = fmt.Errorf("command %s not found", command)
+			}
+		} else {
+			// it might be an answer to a trivia question
+			triviaAnswer(user, msg)
 		}
 	}
 	if err != nil {
 		terrors.Log(err, "error running command")
+		return
+	}
+	if strings.HasPrefix(command, "!") {
+		events.Command(user.Username, command, params)
 	}
 }
 
@@ -210,35 +323,89 @@ func PrivateMessage(msg twitch.PrivateMessage) {
 	// increment the Prometheus counter
 	instrumentation.ChatMessages.Inc()
 
-	//TODO: we lose capitalization here, is that okay?
-	message := strings.ToLower(msg.Message)
-
 	// log to stackdriver
 	mylog.ChatMsg(username, msg.Message)
 
+	// the announcements only go out if chat is active
+	announcements.RecordChatMessage()
+
+	// the badges tell us if they're a mod or subscriber
+	users.UpdateBadges(username, msg.User.Badges)
+
 	// check to see if the message is a command
 	//TODO: also include ones prefixed with whitespace?
 	// log in the user
 	user := users.LoginIfNecessary(username)
 
-	runCommand(user, message)
+	runCommand(user, msg.Message)
 }
 
 // this event fires when a user joins the channel
 func UserJoin(joinMessage twitch.UserJoinMessage) {
+	mytwitch.IRC.Join(joinMessage.User)
 	users.LoginIfNecessary(joinMessage.User)
 }
 
 // this event fires when a user leaves the channel
 func UserPart(partMessage twitch.UserPartMessage) {
+	mytwitch.IRC.Part(partMessage.User)
 	users.LogoutIfNecessary(partMessage.User)
 }
 
-// send message to chat if someone subs
-// func UserNotice(message twitch.UserNoticeMessage) {
-// 	// update the internal subscriber list
-// 	mytwitch.GetSubscribers()
-// }
+// communityGifts keeps track of how many of the upcoming gift subs
+// were part of a community gift, so we don't announce each one
+var communityGifts = make(map[string]int)
+
+// UserNotice handles subs, resubs and gift subs. It's only used
+// when webhooks are disabled, otherwise these come from EventSub
+func UserNotice(message twitch.UserNoticeMessage) {
+	params := message.MsgParams
+	gifter := strings.ToLower(message.User.Name)
+
+	switch message.MsgID {
+	case "sub", "resub":
+		months, _ := strconv.Atoi(params["msg-param-cumulative-months"])
+		sub := mytwitch.Subscriber{
+			Username:         gifter,
+			Tier:             mytwitch.TierFromPlan(params["msg-param-sub-plan"]),
+			CumulativeMonths: months,
+		}
+		log.Println("got user notice for new sub:", sub.Username)
+		saveSubscriber(sub)
+		AnnounceSubscriber(sub)
+
+	case "subgift", "anonsubgift":
+		if message.MsgID == "anonsubgift" {
+			gifter = ""
+		}
+		sub := mytwitch.Subscriber{
+			Username: strings.ToLower(params["msg-param-recipient-user-name"]),
+			Tier:     mytwitch.TierFromPlan(params["msg-param-sub-plan"]),
+			IsGift:   true,
+			Gifter:   gifter,
+		}
+		log.Println("got user notice for gift sub:", sub.Username)
+		saveSubscriber(sub)
+		// don't announce gifts that were part of a community gift
+		if communityGifts[gifter] > 0 {
+			communityGifts[gifter]--
+			return
+		}
+		AnnounceGiftSubscriber(sub)
+
+	case "submysterygift":
+		count, _ := strconv.Atoi(params["msg-param-mass-gift-count"])
+		log.Println("got user notice for community gift from:", gifter)
+		communityGifts[gifter] += count
+		AnnounceCommunityGift(gifter, count)
+	}
+}
+
+// saveSubscriber updates the internal subscriber list and the DB
+func saveSubscriber(sub mytwitch.Subscriber) {
+	users.LoginIfNecessary(sub.Username)
+	users.NewSubscription(sub)
+}
 
 // if the message comes from me, then post the message to chat
 //TODO: log to stackdriver
@@ -0,0 +1,72 @@
+package chatbot
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// TestBuiltinCommands makes sure custom commands can't
+// shadow anything that runCommand handles
+func TestBuiltinCommands(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "handlers.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var labels int
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "runCommand" {
+			continue
+		}
+		ast.Inspect(fn, func(n ast.Node) bool {
+			clause, ok := n.(*ast.CaseClause)
+			if !ok {
+				return true
+			}
+			for _, expr := range clause.List {
+				lit, ok := expr.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				name, _ := strconv.Unquote(lit.Value)
+				labels++
+				if !builtinCommands[name] {
+					t.Errorf("%s is handled by runCommand but isn't in builtinCommands", name)
+				}
+			}
+			return true
+		})
+	}
+	if labels == 0 {
+		t.Fatal("didn't find any commands in runCommand")
+	}
+}
+
+func TestParseCustomCommand(t *testing.T) {
+	tests := []struct {
+		params []string
+		name   string
+		err    error
+	}{
+		{[]string{"!discord", "Join", "us!"}, "discord", nil},
+		{[]string{"!discord", "cooldown=60", "Join", "us!"}, "discord", nil},
+		{[]string{"!discord"}, "", errCustomCommandUsage},
+		{[]string{"!two", "words!", "here"}, "two", nil},
+		{[]string{"!not-a-word", "hi"}, "", errCustomCommandUsage},
+		{[]string{"!location", "hi"}, "", errBuiltinCommand},
+		{[]string{"!1location", "hi"}, "", errBuiltinCommand},
+		{[]string{"!ban", "/ban", "someone"}, "", errChatCommandResponse},
+		{[]string{"!timeout", ".timeout", "someone"}, "", errChatCommandResponse},
+	}
+	for _, tt := range tests {
+		name, _, _, err := parseCustomCommand(tt.params)
+		if name != tt.name || err != tt.err {
+			t.Errorf("parseCustomCommand(%v) = %q, %v; expected %q, %v", tt.params, name, err, tt.name, tt.err)
+		}
+	}
+}
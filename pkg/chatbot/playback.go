@@ -10,6 +10,7 @@ import (
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/events"
 	"github.com/adanalife/tripbot/pkg/helpers"
 	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
 	"github.com/adanalife/tripbot/pkg/users"
@@ -22,8 +23,11 @@ import (
 // plus it's also used to reset peoples lastLocation time
 var lastTimewarpTime time.Time
 
-// timewarp jumps the playhead to a random video in the loop
-func timewarp() {
+// timewarp jumps the playhead to a random video in the loop,
+// the username and reason are recorded in the events table
+func timewarp(username, reason string) {
+	events.Timewarp(username, reason)
+
 	// show timewarp onscreen
 	onscreensClient.ShowTimewarp()
 
@@ -47,8 +51,8 @@ func timewarpCmd(user *users.User) {
 		return
 	}
 
-	// rate-limit the number of times this can run
-	if !c.UserIsAdmin(user.Username) {
+	// rate-limit the number of times this can run (mods skip the cooldown)
+	if !user.IsModerator() {
 		if time.Now().Sub(lastTimewarpTime) < 20*time.Second {
 			Say("Not yet; enjoy the moment!")
 			return
@@ -61,11 +65,10 @@ func timewarpCmd(user *users.User) {
 	}
 
 	// do the timewarp
-	timewarp()
+	timewarp(user.Username, "command")
 }
 
 func jumpCmd(user *users.User, params []string) {
-	var err error
 	log.Println(user.Username, "ran !jump")
 
 	// exit early if we're on OS X
@@ -74,8 +77,8 @@ func jumpCmd(user *users.User, params []string) {
 		return
 	}
 
-	// rate-limit the number of times this can run
-	if !c.UserIsAdmin(user.Username) {
+	// rate-limit the number of times this can run (mods skip the cooldown)
+	if !user.IsModerator() {
 		if time.Now().Sub(lastTimewarpTime) < 20*time.Second {
 			Say("Not yet; enjoy the moment!")
 			return
@@ -88,6 +91,14 @@ func jumpCmd(user *users.User, params []string) {
 		return
 	}
 
+	jumpToState(user.Username, params)
+}
+
+// jumpToState plays a random video from the given state,
+// returning false if it was unable to
+func jumpToState(username string, params []string) bool {
+	var err error
+
 	// skip to a video from the given state
 	state := strings.Join(params, " ")
 	// sanitize the input
@@ -98,28 +109,30 @@ func jumpCmd(user *users.User, params []string) {
 	if _, ok := err.(*terrors.NoFootageForStateError); ok {
 		msg := fmt.Sprintf("No footage for %s... yet! ;)", titlecaseState)
 		Say(msg)
-		return
+		return false
 	}
 	// check to see if there was an error finding a candidate video
 	if err != nil {
 		terrors.Log(err, "error from finding random video for state")
 		Say("Usage: !jump [state]")
-		return
+		return false
 	}
 	// tell VLC to play it
 	err = vlcClient.PlayFileInPlaylist(randomVid.File())
 	if err != nil {
 		terrors.Log(err, "error from VLC client")
 		Say("Usage: !jump [state]")
-		return
+		return false
 	}
 	Say(fmt.Sprintf("Jumping to %s...!", titlecaseState))
+	events.Jump(username, titlecaseState)
 	// update the currently-playing video
 	video.GetCurrentlyPlaying()
 	// show the flag for the state
 	onscreensClient.ShowFlag(10 * time.Second)
 	// update our record of last time it ran
 	lastTimewarpTime = time.Now()
+	return true
 }
 
 func skipCmd(user *users.User, params []string) {
@@ -133,8 +146,8 @@ func skipCmd(user *users.User, params []string) {
 		return
 	}
 
-	// rate-limit the number of times this can run
-	if !c.UserIsAdmin(user.Username) {
+	// rate-limit the number of times this can run (mods skip the cooldown)
+	if !user.IsModerator() {
 		if time.Now().Sub(lastTimewarpTime) < 20*time.Second {
 			Say("Not yet; enjoy the moment!")
 			return
@@ -178,8 +191,8 @@ func backCmd(user *users.User, params []string) {
 		return
 	}
 
-	// rate-limit the number of times this can run
-	if !c.UserIsAdmin(user.Username) {
+	// rate-limit the number of times this can run (mods skip the cooldown)
+	if !user.IsModerator() {
 		if time.Now().Sub(lastTimewarpTime) < 20*time.Second {
 			Say("Not yet; enjoy the moment!")
 			return
@@ -0,0 +1,77 @@
+package chatbot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/adanalife/tripbot/pkg/announcements"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/adanalife/tripbot/pkg/trivia"
+	"github.com/adanalife/tripbot/pkg/users"
+)
+
+// minTriviaChatMessages is how many chat messages there have to be
+// since the last question, so we don't ask an empty room (or
+// keep asking while the stream is offline)
+const minTriviaChatMessages = 5
+
+// chatMessagesAtTrivia is the chat message count when the last question was asked
+var chatMessagesAtTrivia uint64
+
+// AskTrivia posts a trivia question in chat, it's run on a timer
+func AskTrivia() {
+	chatMessages := announcements.ChatMessages()
+	if chatMessages-atomic.LoadUint64(&chatMessagesAtTrivia) < minTriviaChatMessages {
+		log.Println("not asking trivia: chat has been quiet")
+		return
+	}
+	q, err := trivia.Ask(func(q trivia.Question) {
+		Say(fmt.Sprintf("Time's up! The answer was %s", q.Answers[0]))
+	})
+	if err != nil {
+		log.Println("not asking trivia:", err)
+		return
+	}
+	atomic.StoreUint64(&chatMessagesAtTrivia, chatMessages)
+	Say(fmt.Sprintf("/me Trivia time! %s (answer in chat within %.0fs for %.0f points)", q.Text, trivia.AnswerWindow.Seconds(), q.Points))
+}
+
+// triviaAnswer checks if a chat message answers the open trivia question
+func triviaAnswer(user *users.User, message string) {
+	q, correct := trivia.Answer(user.Username, message)
+	if !correct {
+		return
+	}
+	log.Println(user.Username, "answered a trivia question")
+	Say(fmt.Sprintf("@%s got it! The answer was %s (+%.0f trivia points)", user.Username, q.Answers[0], q.Points))
+}
+
+// triviaCmd repeats the open question, or shows who is best at trivia
+func triviaCmd(user *users.User) {
+	log.Println(user.Username, "ran !trivia")
+
+	if q, open := trivia.Current(); open {
+		Say("Trivia: " + q.Text)
+		return
+	}
+
+	board, err := scoreboards.Current(scoreboards.KindTrivia, scoreboards.Monthly)
+	if err != nil {
+		return
+	}
+	entries, err := board.Top(5)
+	if err != nil {
+		return
+	}
+	if len(entries) == 0 {
+		Say("Nobody has answered any trivia this month, watch for the next question!")
+		return
+	}
+	var places []string
+	for _, entry := range entries {
+		places = append(places, fmt.Sprintf("%d. %s (%.0f)", entry.Rank, entry.Username, entry.Value))
+	}
+	Say("Top trivia players this month: " + strings.Join(places, ", "))
+}
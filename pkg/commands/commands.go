@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/logrusorgru/aurora"
+)
+
+// DefaultCooldown is used for commands that don't set one
+var DefaultCooldown = 30 * time.Second
+
+// ErrExists is returned when adding a command that already exists
+var ErrExists = errors.New("command already exists")
+
+// ErrNotFound is returned when there's no command with the given name
+var ErrNotFound = errors.New("no such command")
+
+// Command is a chat command that replies with some text
+type Command struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	// Response can contain variables like {user} and {state}
+	Response        string    `db:"response" json:"response"`
+	CooldownSeconds int       `db:"cooldown_seconds" json:"cooldown_seconds"`
+	CreatedBy       string    `db:"created_by" json:"created_by"`
+	UpdatedBy       string    `db:"updated_by" json:"updated_by"`
+	DateCreated     time.Time `db:"date_created" json:"date_created"`
+	DateUpdated     time.Time `db:"date_updated" json:"date_updated"`
+}
+
+// the commands are checked on every chat message that
+// starts with a !, so we keep them in memory
+var cache = make(map[string]Command)
+
+// lastUsed is when each command was last run, keyed by name
+var lastUsed = make(map[string]time.Time)
+var cacheMutex sync.Mutex
+
+// Normalize returns the name we save a command under (ex: "!Discord" is "discord")
+func Normalize(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "!")
+}
+
+// Load reads all of the commands from the DB
+func Load() error {
+	var all []Command
+	err := database.Connection().Select(&all, "SELECT * FROM custom_commands")
+	if err != nil {
+		terrors.Log(err, "error loading custom commands")
+		return err
+	}
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cache = make(map[string]Command, len(all))
+	for _, cmd := range all {
+		cache[cmd.Name] = cmd
+	}
+	log.Println("loaded", aurora.Cyan(len(all)), "custom commands")
+	return nil
+}
+
+// Find returns the command with the given name
+func Find(name string) (Command, bool) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cmd, ok := cache[Normalize(name)]
+	return cmd, ok
+}
+
+// All returns every command, sorted by name
+func All() ([]Command, error) {
+	var all []Command
+	err := database.Connection().Select(&all, "SELECT * FROM custom_commands ORDER BY name")
+	if err != nil {
+		terrors.Log(err, "error getting custom commands")
+	}
+	return all, err
+}
+
+// Use returns true if the command is off cooldown,
+// and starts the cooldown again if it is
+func Use(cmd Command) bool {
+	cooldown := DefaultCooldown
+	if cmd.CooldownSeconds > 0 {
+		cooldown = time.Duration(cmd.CooldownSeconds) * time.Second
+	}
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if time.Since(lastUsed[cmd.Name]) < cooldown {
+		return false
+	}
+	lastUsed[cmd.Name] = time.Now()
+	return true
+}
+
+// Add creates a new command, a cooldown of zero uses the default
+func Add(name, response string, cooldownSeconds int, username string) (Command, error) {
+	var cmd Command
+	if c.Conf.ReadOnly {
+		return cmd, &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	if cooldownSeconds <= 0 {
+		cooldownSeconds = int(DefaultCooldown.Seconds())
+	}
+	query := `INSERT INTO custom_commands (name, response, cooldown_seconds, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $4) ON CONFLICT (name) DO NOTHING RETURNING *`
+	err := database.Connection().Get(&cmd, query, Normalize(name), response, cooldownSeconds, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return cmd, ErrExists
+		}
+		terrors.Log(err, "error adding custom command")
+		return cmd, err
+	}
+	store(cmd)
+	return cmd, nil
+}
+
+// Edit changes the response of a command, and the
+// cooldown too if it isn't zero
+func Edit(name, response string, cooldownSeconds int, username string) (Command, error) {
+	var cmd Command
+	if c.Conf.ReadOnly {
+		return cmd, &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	query := `UPDATE custom_commands SET response=$2, updated_by=$3, date_updated=$4,
+		cooldown_seconds = CASE WHEN $5::integer > 0 THEN $5::integer ELSE cooldown_seconds END
+		WHERE name=$1 RETURNING *`
+	err := database.Connection().Get(&cmd, query, Normalize(name), response, username, time.Now(), cooldownSeconds)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return cmd, ErrNotFound
+		}
+		terrors.Log(err, "error editing custom command")
+		return cmd, err
+	}
+	store(cmd)
+	return cmd, nil
+}
+
+// Delete removes a command
+func Delete(name string) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	name = Normalize(name)
+	res, err := database.Connection().Exec("DELETE FROM custom_commands WHERE name=$1", name)
+	if err != nil {
+		terrors.Log(err, "error deleting custom command")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	cacheMutex.Lock()
+	delete(cache, name)
+	delete(lastUsed, name)
+	cacheMutex.Unlock()
+	return nil
+}
+
+// Render fills in the variables in a response (ex: "{user}"), the
+// values are funcs so we only look up the ones that are used
+func Render(response string, vars map[string]func() string) string {
+	for name, value := range vars {
+		placeholder := "{" + name + "}"
+		if strings.Contains(response, placeholder) {
+			response = strings.ReplaceAll(response, placeholder, value())
+		}
+	}
+	return response
+}
+
+// store puts the command in the cache
+func store(cmd Command) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cache[cmd.Name] = cmd
+}
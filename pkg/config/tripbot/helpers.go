@@ -144,20 +144,28 @@ var IgnoredUsers = []string{
 	"zanekyber",
 }
 
-// HelpMessages are all of the different things !help can return
+// HelpMessages are all of the different things !help can return,
+// they are also posted in chat as announcements every few hours
 var HelpMessages = []string{
 	"!commands: List more commands you can use",
 	"!commands: List more commands you can use",
 	"!commands: List more commands you can use",
 	"!guess: Guess which state we are in",
+	"!guess city: Guess the closest city for bonus points",
+	"!guessstats: See how good you are at guessing",
+	"!halloffame: See last month's winners (try !halloffame guess too)",
+	"!hint: Get a hint for !guess (but guesses are worth less)",
+	"!join: Join a team for this season (try !teams to see how they're doing)",
 	"!leaderboard: See who has the most miles",
 	"!location: Get the current location",
+	"!mapguess: Guess where we are on a map",
 	"!miles: See your current miles",
 	"!report: Report a stream issue (frozen, no audio, etc)",
 	"!state: Get the state we are currently in",
 	"!sunset: Get time until sunset (on the day of filming)",
 	"!survey: Fill out a survey and help the stream",
 	"!timewarp: Magically warp to a new moment in time",
+	"!trivia: See who is best at the trivia questions I ask",
 }
 
 var GoogleMapsStyle = []string{
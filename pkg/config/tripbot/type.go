@@ -30,11 +30,28 @@ type TripbotConfig struct {
 	// TripbotPidFile is where the tripbot PID is written
 	TripbotPidFile string `default:"/opt/data/run/tripbot.pid" envconfig:"TRIPBOT_PIDFILE"`
 
+	// TwitchEventSubSecret is used to sign the EventSub notifications Twitch sends us
+	TwitchEventSubSecret string `envconfig:"TWITCH_EVENTSUB_SECRET"`
+
+	// TwitchTokenKey is used to encrypt the Twitch OAuth tokens we save in the DB
+	TwitchTokenKey string `envconfig:"TWITCH_TOKEN_KEY"`
+
+	// ViewerSessionKey is used to encrypt the cookies for viewers who
+	// log in with Twitch (for the map guessing game)
+	ViewerSessionKey string `envconfig:"VIEWER_SESSION_KEY"`
+
+	// MilesRulesFile is a JSON file containing the miles bonus rules
+	MilesRulesFile string `envconfig:"MILES_RULES_FILE"`
+
+	// TriviaFile is a JSON file containing the trivia question bank
+	TriviaFile string `envconfig:"TRIVIA_FILE"`
+
+	// PresenceSource is where we find out who is in chat (helix, irc, or fake)
+	PresenceSource string `default:"helix" envconfig:"PRESENCE_SOURCE"`
+
 	// DisableTwitchWebhooks disables receiving webhooks from Twitch (new followers for instance)
 	DisableTwitchWebhooks bool `default:"false" envconfig:"DISABLE_TWITCH_WEBHOOKS"`
 
-	// TripbotHttpAuth is used to authenticate users to the HTTP server
-	TripbotHttpAuth string `required:"true" envconfig:"TRIPBOT_HTTP_AUTH"`
 	// TripbotServerPort is used to specify the port on which the webserver runs
 	TripbotServerPort string `default:"8080" envconfig:"TRIPBOT_SERVER_PORT"`
 	// VlcServerHost is used to specify the host for the VLC webserver
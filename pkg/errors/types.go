@@ -17,3 +17,11 @@ type ReadOnlyError struct {
 func (e *ReadOnlyError) Error() string {
 	return e.Msg
 }
+
+type InsufficientMilesError struct {
+	Msg string
+}
+
+func (e *InsufficientMilesError) Error() string {
+	return e.Msg
+}
@@ -7,40 +7,70 @@ import (
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx/types"
 	"github.com/logrusorgru/aurora"
 )
 
 type Event struct {
-	ID          int       `db:"id"`
-	Username    string    `db:"username"`
-	Event       string    `db:"event"`
-	DateCreated time.Time `db:"date_created"`
+	ID          int            `db:"id"`
+	Username    string         `db:"username"`
+	Event       string         `db:"event"`
+	Payload     types.JSONText `db:"payload"`
+	DateCreated time.Time      `db:"date_created"`
 }
 
+// Login records a login event, it's written to the DB in the background
 func Login(user string) error {
 	if c.Conf.ReadOnly && c.Conf.Verbose {
 		log.Printf("Not logging in %s because we're in read-only mode", aurora.Magenta(user))
 		return &terrors.ReadOnlyError{Msg: "read-only mode"}
 	}
-	tx := database.Connection().MustBegin()
-	//TODO: do something with result here?
-	_, err := tx.Exec("INSERT INTO events (username, event) VALUES ($1, $2)", user, "login")
-	if err != nil {
-		return err
-	}
-	return tx.Commit()
+	defaultWriter.Add(Event{Username: user, Event: TypeLogin, DateCreated: time.Now()})
+	return nil
 }
 
+// Logout records a logout event, it's written to the DB in the background
 func Logout(user string) error {
 	if c.Conf.ReadOnly && c.Conf.Verbose {
 		log.Printf("Not logging out %s because we're in read-only mode", aurora.Magenta(user))
 		return &terrors.ReadOnlyError{Msg: "read-only mode"}
 	}
-	tx := database.Connection().MustBegin()
-	//TODO: do something with result here?
-	_, err := tx.Exec("INSERT INTO events (username, event) VALUES ($1, $2)", user, "logout")
+	defaultWriter.Add(Event{Username: user, Event: TypeLogout, DateCreated: time.Now()})
+	return nil
+}
+
+// LogoutAt records a logout that happened in the past, it's used
+// for sessions that were interrupted by a crash
+func LogoutAt(user string, at time.Time) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	defaultWriter.Add(Event{Username: user, Event: TypeLogout, DateCreated: at})
+	return nil
+}
+
+// LoginStreak returns the number of consecutive days (ending today)
+// on which the user has logged in. It's called as they log in, so today
+// always counts even if the login event hasn't been written yet
+func LoginStreak(user string) (int, error) {
+	// the days are counted in the DB so they're all in the same time zone
+	var daysAgo []int
+	query := `SELECT DISTINCT CURRENT_DATE - date_created::date AS days_ago FROM events WHERE username=$1 AND event='login' AND date_created > now() - interval '1 year' ORDER BY days_ago`
+	err := database.Connection().Select(&daysAgo, query, user)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	streak := 1
+	for _, days := range daysAgo {
+		if days == 0 {
+			// we already counted today
+			continue
+		}
+		if days != streak {
+			break
+		}
+		streak++
 	}
-	return tx.Commit()
+	return streak, nil
 }
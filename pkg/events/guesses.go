@@ -0,0 +1,73 @@
+package events
+
+import (
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+)
+
+// GuessStats is how many guesses a user has made, and how many were right
+type GuessStats struct {
+	Correct int `db:"correct" json:"correct"`
+	Total   int `db:"total" json:"total"`
+}
+
+// Accuracy returns the percentage of correct guesses
+func (s GuessStats) Accuracy() float64 {
+	if s.Total == 0 {
+		return 0.0
+	}
+	return 100.0 * float64(s.Correct) / float64(s.Total)
+}
+
+// StatePair is a state that was guessed when the answer was another state
+type StatePair struct {
+	Guess  string `db:"guess" json:"guess"`
+	Actual string `db:"actual" json:"actual"`
+	Count  int    `db:"count" json:"count"`
+}
+
+// UserGuessStats returns the guess stats for a user
+func UserGuessStats(user string) (GuessStats, error) {
+	var stats GuessStats
+	query := `SELECT
+			COUNT(*) FILTER (WHERE payload->>'correct' = 'true') AS correct,
+			COUNT(*) AS total
+		FROM events WHERE event=$1 AND username=$2`
+	err := database.Connection().Get(&stats, query, TypeGuess, user)
+	if err != nil {
+		terrors.Log(err, "error getting guess stats")
+	}
+	return stats, err
+}
+
+// UserMostMissedState returns the state the user has guessed wrong
+// the most, or an empty string if they've never guessed wrong
+func UserMostMissedState(user string) (string, error) {
+	q := Query{
+		Event:    TypeGuess,
+		Username: user,
+		Match:    map[string]interface{}{"correct": false},
+	}
+	counts, err := q.CountBy("actual", 1)
+	if err != nil || len(counts) == 0 {
+		return "", err
+	}
+	return counts[0].Value, nil
+}
+
+// ConfusedStates returns the most common incorrect guesses,
+// paired with what the answer actually was
+func ConfusedStates(since time.Time, limit int) ([]StatePair, error) {
+	var pairs []StatePair
+	query := `SELECT payload->>'guess' AS guess, payload->>'actual' AS actual, COUNT(*) AS count
+		FROM events
+		WHERE event=$1 AND date_created >= $2 AND payload @> '{"correct": false}'
+		GROUP BY guess, actual ORDER BY count DESC LIMIT $3`
+	err := database.Connection().Select(&pairs, query, TypeGuess, since, limit)
+	if err != nil {
+		terrors.Log(err, "error getting confused states")
+	}
+	return pairs, err
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+)
+
+// Query finds events of a given type. Match is compared against the
+// payload, so Match{"correct": false} finds the incorrect guesses
+type Query struct {
+	Event    string
+	Username string
+	Since    time.Time
+	Match    map[string]interface{}
+}
+
+// ValueCount is the number of events with a particular payload value
+type ValueCount struct {
+	Value string `db:"value" json:"value"`
+	Count int    `db:"count" json:"count"`
+}
+
+// payload fields can only contain these characters,
+// they can't be passed as a bind parameter
+var validField = regexp.MustCompile(`^[a-z_]+$`)
+
+// Find returns the most recent matching events
+func (q Query) Find(limit int) ([]Event, error) {
+	where, args, err := q.where()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT * FROM events WHERE %s ORDER BY date_created DESC LIMIT $%d`, where, len(args))
+
+	var evts []Event
+	err = database.Connection().Select(&evts, query, args...)
+	if err != nil {
+		terrors.Log(err, "error finding events")
+	}
+	return evts, err
+}
+
+// Count returns the number of matching events
+func (q Query) Count() (int, error) {
+	where, args, err := q.where()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = database.Connection().Get(&count, `SELECT COUNT(*) FROM events WHERE `+where, args...)
+	if err != nil {
+		terrors.Log(err, "error counting events")
+	}
+	return count, err
+}
+
+// CountBy groups the matching events by a payload field, and returns the
+// most common values. For example, the states people guess wrong most:
+//
+//	Query{Event: TypeGuess, Match: map[string]interface{}{"correct": false}}.CountBy("actual", 5)
+func (q Query) CountBy(field string, limit int) ([]ValueCount, error) {
+	if !validField.MatchString(field) {
+		return nil, fmt.Errorf("invalid payload field %s", field)
+	}
+	where, args, err := q.where()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT payload->>'%s' AS value, COUNT(*) AS count FROM events
+		WHERE %s AND payload ? '%s'
+		GROUP BY value ORDER BY count DESC LIMIT $%d`, field, where, field, len(args))
+
+	var counts []ValueCount
+	err = database.Connection().Select(&counts, query, args...)
+	if err != nil {
+		terrors.Log(err, "error counting events")
+	}
+	return counts, err
+}
+
+// where builds the WHERE clause for the query
+func (q Query) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q.Event != "" {
+		add("event = $%d", q.Event)
+	}
+	if q.Username != "" {
+		add("username = $%d", q.Username)
+	}
+	if !q.Since.IsZero() {
+		add("date_created >= $%d", q.Since)
+	}
+	if len(q.Match) > 0 {
+		match, err := json.Marshal(q.Match)
+		if err != nil {
+			return "", nil, err
+		}
+		add("payload @> $%d::jsonb", string(match))
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", args, nil
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// MostMissedStates returns the states people have guessed wrong the most
+func MostMissedStates(since time.Time, limit int) ([]ValueCount, error) {
+	q := Query{
+		Event: TypeGuess,
+		Since: since,
+		Match: map[string]interface{}{"correct": false},
+	}
+	return q.CountBy("actual", limit)
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx/types"
+)
+
+// these are the different kinds of events
+const (
+	TypeLogin     = "login"
+	TypeLogout    = "logout"
+	TypeCommand   = "command"
+	TypeGuess     = "guess"
+	TypeTimewarp  = "timewarp"
+	TypeJump      = "jump"
+	TypeFollow    = "follow"
+	TypeSubscribe = "subscribe"
+	TypeReport    = "report"
+	TypeMiles     = "miles"
+)
+
+// CommandPayload is stored with command events
+type CommandPayload struct {
+	Command string   `json:"command"`
+	Params  []string `json:"params,omitempty"`
+}
+
+// GuessPayload is stored with guess events
+type GuessPayload struct {
+	Guess   string `json:"guess"`
+	Actual  string `json:"actual"`
+	Correct bool   `json:"correct"`
+}
+
+// TimewarpPayload is stored with timewarp events
+type TimewarpPayload struct {
+	// Reason is what triggered it (ex: "command", "guess", "redemption")
+	Reason string `json:"reason"`
+}
+
+// JumpPayload is stored with jump events
+type JumpPayload struct {
+	State string `json:"state"`
+}
+
+// SubscribePayload is stored with subscribe events
+type SubscribePayload struct {
+	Tier             int    `json:"tier"`
+	IsGift           bool   `json:"is_gift"`
+	Gifter           string `json:"gifter,omitempty"`
+	CumulativeMonths int    `json:"cumulative_months,omitempty"`
+}
+
+// ReportPayload is stored with report events
+type ReportPayload struct {
+	Message string `json:"message"`
+	Video   string `json:"video,omitempty"`
+}
+
+// MilesPayload is stored with miles events
+type MilesPayload struct {
+	Amount float32 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// Record saves an event with a payload (which is stored as JSON),
+// it's written to the DB in the background
+func Record(user, eventType string, payload interface{}) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	data := types.JSONText("{}")
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			terrors.Log(err, "error marshalling event payload")
+			return err
+		}
+		data = types.JSONText(b)
+	}
+	defaultWriter.Add(Event{Username: user, Event: eventType, Payload: data, DateCreated: time.Now()})
+	return nil
+}
+
+// Command records that a user ran a command
+func Command(user, command string, params []string) error {
+	return Record(user, TypeCommand, CommandPayload{Command: command, Params: params})
+}
+
+// Guess records a !guess, and whether it was right
+func Guess(user, guess, actual string, correct bool) error {
+	return Record(user, TypeGuess, GuessPayload{Guess: guess, Actual: actual, Correct: correct})
+}
+
+// Timewarp records a timewarp, and what caused it
+func Timewarp(user, reason string) error {
+	return Record(user, TypeTimewarp, TimewarpPayload{Reason: reason})
+}
+
+// Jump records a jump to a state
+func Jump(user, state string) error {
+	return Record(user, TypeJump, JumpPayload{State: state})
+}
+
+// Follow records a new follower
+func Follow(user string) error {
+	return Record(user, TypeFollow, nil)
+}
+
+// Subscribe records a sub, resub, or gift sub
+func Subscribe(user string, payload SubscribePayload) error {
+	return Record(user, TypeSubscribe, payload)
+}
+
+// Report records a !report
+func Report(user, message, video string) error {
+	return Record(user, TypeReport, ReportPayload{Message: message, Video: video})
+}
+
+// Miles records miles being awarded to a user
+func Miles(user string, amount float32, reason string) error {
+	return Record(user, TypeMiles, MilesPayload{Amount: amount, Reason: reason})
+}
+
+// DecodePayload unmarshals the event's payload into v
+func (e Event) DecodePayload(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return nil
+	}
+	return e.Payload.Unmarshal(v)
+}
@@ -0,0 +1,182 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/logrusorgru/aurora"
+)
+
+// Writer buffers events in memory and writes them to the DB in batches.
+// If the DB is unavailable the events stay in the buffer and are
+// retried on the next flush
+type Writer struct {
+	// FlushInterval is how often the buffer is written to the DB
+	FlushInterval time.Duration
+	// FlushSize triggers a flush early once this many events are buffered
+	FlushSize int
+	// MaxBuffered is the most events we'll hold on to during a DB
+	// outage, after this the oldest ones are dropped
+	MaxBuffered int
+
+	mu      sync.Mutex
+	buffer  []Event
+	flushMu sync.Mutex
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// maxRowsPerInsert keeps us well under the postgres parameter limit
+const maxRowsPerInsert = 1000
+
+// writeEvents does the INSERT, it's a var so the tests can run without a DB
+var writeEvents = insertEvents
+
+// defaultWriter is used by Record, Login, Logout, and LogoutAt
+var defaultWriter = NewWriter()
+
+// NewWriter creates a Writer with the default settings
+func NewWriter() *Writer {
+	return &Writer{
+		FlushInterval: 10 * time.Second,
+		FlushSize:     100,
+		MaxBuffered:   50000,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// StartWriter starts flushing the default writer in the background
+func StartWriter() {
+	defaultWriter.Start()
+}
+
+// StopWriter flushes anything left in the default writer, and
+// should be called on shutdown (before the DB is closed)
+func StopWriter() {
+	defaultWriter.Stop()
+}
+
+// Add buffers an event to be written
+func (w *Writer) Add(evt Event) {
+	w.mu.Lock()
+	w.buffer = append(w.buffer, evt)
+	w.trim()
+	full := len(w.buffer) >= w.FlushSize
+	w.mu.Unlock()
+
+	if full {
+		// flush early, but don't block the caller
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start flushes the buffer every FlushInterval (or when it fills up)
+func (w *Writer) Start() {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Flush()
+			case <-w.wake:
+				w.Flush()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background flushing and writes out the buffer
+func (w *Writer) Stop() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+	err := w.Flush()
+	if err != nil {
+		log.Println(aurora.Red("lost"), w.Buffered(), aurora.Red("events on shutdown"))
+	}
+}
+
+// Buffered returns the number of events waiting to be written
+func (w *Writer) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.buffer)
+}
+
+// Flush writes everything in the buffer to the DB. Events that
+// couldn't be written are put back in the buffer
+func (w *Writer) Flush() error {
+	// only one flush at a time, so events stay in order
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	pending := w.buffer
+	w.buffer = nil
+	w.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > maxRowsPerInsert {
+			n = maxRowsPerInsert
+		}
+		err := writeEvents(pending[:n])
+		if err != nil {
+			terrors.Log(err, "error writing events, will retry")
+			// put the unwritten events back in front of any new ones
+			w.mu.Lock()
+			w.buffer = append(pending, w.buffer...)
+			w.trim()
+			w.mu.Unlock()
+			return err
+		}
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// trim drops the oldest events if the buffer is too big,
+// it must be called with mu held
+func (w *Writer) trim() {
+	if w.MaxBuffered <= 0 || len(w.buffer) <= w.MaxBuffered {
+		return
+	}
+	dropped := len(w.buffer) - w.MaxBuffered
+	w.buffer = w.buffer[dropped:]
+	log.Println(aurora.Red("event buffer is full, dropped"), dropped, aurora.Red("events"))
+}
+
+// insertEvents writes the events with a single multi-row INSERT
+func insertEvents(evts []Event) error {
+	placeholders := make([]string, 0, len(evts))
+	args := make([]interface{}, 0, len(evts)*4)
+	for i, evt := range evts {
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4))
+		payload := evt.Payload
+		if len(payload) == 0 {
+			payload = types.JSONText("{}")
+		}
+		args = append(args, evt.Username, evt.Event, payload, evt.DateCreated)
+	}
+	query := "INSERT INTO events (username, event, payload, date_created) VALUES " + strings.Join(placeholders, ", ")
+	_, err := database.Connection().Exec(query, args...)
+	return err
+}
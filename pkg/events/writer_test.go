@@ -0,0 +1,167 @@
+package events
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+	terrors.Initialize(c.Conf)
+	os.Exit(m.Run())
+}
+
+// fakeInsert swaps out the DB insert, the batches that were written are
+// added to the returned slice. fail is called before each insert and
+// the insert fails if it returns true
+func fakeInsert(t *testing.T, fail func() bool) *[][]string {
+	var batches [][]string
+	oldWrite := writeEvents
+	t.Cleanup(func() {
+		writeEvents = oldWrite
+	})
+	writeEvents = func(evts []Event) error {
+		if fail != nil && fail() {
+			return errors.New("the DB is down")
+		}
+		var usernames []string
+		for _, evt := range evts {
+			usernames = append(usernames, evt.Username)
+		}
+		batches = append(batches, usernames)
+		return nil
+	}
+	return &batches
+}
+
+// testEvents creates events for the given usernames
+func testEvents(usernames ...string) []Event {
+	var evts []Event
+	for _, username := range usernames {
+		evts = append(evts, Event{Username: username, Event: TypeLogin, DateCreated: time.Now()})
+	}
+	return evts
+}
+
+func TestFlush(t *testing.T) {
+	batches := fakeInsert(t, nil)
+	w := NewWriter()
+	for _, evt := range testEvents("alice", "bob") {
+		w.Add(evt)
+	}
+
+	err := w.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*batches, [][]string{{"alice", "bob"}}) {
+		t.Errorf("expected one batch with alice and bob, got %v", *batches)
+	}
+	if w.Buffered() != 0 {
+		t.Errorf("expected an empty buffer, got %d events", w.Buffered())
+	}
+}
+
+func TestFlushRetriesInOrder(t *testing.T) {
+	down := true
+	batches := fakeInsert(t, func() bool { return down })
+	w := NewWriter()
+	for _, evt := range testEvents("alice", "bob") {
+		w.Add(evt)
+	}
+
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected an error while the DB is down")
+	}
+	if w.Buffered() != 2 {
+		t.Fatalf("expected the events to be kept, got %d", w.Buffered())
+	}
+
+	// new events go after the ones that failed
+	w.Add(testEvents("carol")[0])
+	down = false
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*batches, [][]string{{"alice", "bob", "carol"}}) {
+		t.Errorf("expected alice, bob, and carol in order, got %v", *batches)
+	}
+}
+
+func TestFlushSplitsBatches(t *testing.T) {
+	// fail the second batch, the first one shouldn't be written again
+	inserts := 0
+	batches := fakeInsert(t, func() bool {
+		inserts++
+		return inserts == 2
+	})
+	w := NewWriter()
+	w.MaxBuffered = 0
+	for i := 0; i < maxRowsPerInsert+5; i++ {
+		w.Add(testEvents("alice")[0])
+	}
+
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected the second batch to fail")
+	}
+	if w.Buffered() != 5 {
+		t.Errorf("expected the 5 unwritten events to be kept, got %d", w.Buffered())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*batches) != 2 || len((*batches)[0]) != maxRowsPerInsert || len((*batches)[1]) != 5 {
+		t.Errorf("expected batches of %d and 5, got %d batches", maxRowsPerInsert, len(*batches))
+	}
+}
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		maxBuffered int
+		added       []string
+		expected    []string
+	}{
+		{0, []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{3, []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{2, []string{"a", "b", "c"}, []string{"b", "c"}},
+		{1, []string{"a", "b", "c"}, []string{"c"}},
+	}
+	for _, tt := range tests {
+		w := NewWriter()
+		w.MaxBuffered = tt.maxBuffered
+		for _, evt := range testEvents(tt.added...) {
+			w.Add(evt)
+		}
+		var buffered []string
+		for _, evt := range w.buffer {
+			buffered = append(buffered, evt.Username)
+		}
+		if !reflect.DeepEqual(buffered, tt.expected) {
+			t.Errorf("MaxBuffered=%d: expected %v, got %v", tt.maxBuffered, tt.expected, buffered)
+		}
+	}
+}
+
+func TestAddWakesWriterWhenFull(t *testing.T) {
+	w := NewWriter()
+	w.FlushSize = 2
+
+	w.Add(testEvents("alice")[0])
+	select {
+	case <-w.wake:
+		t.Error("the writer was woken up before the buffer was full")
+	default:
+	}
+
+	w.Add(testEvents("bob")[0])
+	select {
+	case <-w.wake:
+	default:
+		t.Error("the writer wasn't woken up when the buffer filled up")
+	}
+}
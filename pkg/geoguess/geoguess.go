@@ -0,0 +1,234 @@
+package geoguess
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	onscreensClient "github.com/adanalife/tripbot/pkg/onscreens-client"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/adanalife/tripbot/pkg/users"
+	"github.com/adanalife/tripbot/pkg/video"
+	"github.com/logrusorgru/aurora"
+)
+
+// RoundLength is how long people have to drop a pin,
+// the round starts when the first person guesses
+var RoundLength = 90 * time.Second
+
+// a guess right on top of us is worth maxPoints, and it
+// drops off the further away the guess is
+const (
+	maxPoints     = 5.0
+	falloffMiles  = 250.0
+	resultsToShow = 5
+)
+
+// ErrAlreadyGuessed is returned if someone guesses twice in a round
+var ErrAlreadyGuessed = errors.New("already guessed this round")
+
+// ErrNoLocation is returned if we don't know where the video is
+var ErrNoLocation = errors.New("no location for current video")
+
+// Round is a single round of the game, the answer is the
+// location of the video playing when it started
+type Round struct {
+	ID          int          `db:"id" json:"id"`
+	VideoSlug   string       `db:"video_slug" json:"-"`
+	Lat         float64      `db:"lat" json:"-"`
+	Lng         float64      `db:"lng" json:"-"`
+	DateStarted time.Time    `db:"date_started" json:"date_started"`
+	DateEnded   sql.NullTime `db:"date_ended" json:"-"`
+}
+
+// Guess is where someone dropped their pin
+type Guess struct {
+	ID          int       `db:"id" json:"-"`
+	RoundID     int       `db:"round_id" json:"round_id"`
+	Username    string    `db:"username" json:"username"`
+	Lat         float64   `db:"lat" json:"lat"`
+	Lng         float64   `db:"lng" json:"lng"`
+	Distance    float64   `db:"distance" json:"distance"`
+	Points      float32   `db:"points" json:"points"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// currentRound is the round that's open for guesses (if any)
+var currentRound *Round
+var roundMutex sync.Mutex
+
+// lastRound and lastResults are from the most recent round that ended
+var lastRound *Round
+var lastResults []Guess
+
+// CurrentRound returns the round that's open for guesses,
+// or nil if nobody has guessed recently
+func CurrentRound() *Round {
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	return currentRound
+}
+
+// LastResults returns the last round that ended (or nil),
+// and the guesses from it, best first
+func LastResults() (*Round, []Guess) {
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	return lastRound, lastResults
+}
+
+// EndsAt returns when the round stops taking guesses
+func (r Round) EndsAt() time.Time {
+	return r.DateStarted.Add(RoundLength)
+}
+
+// MakeGuess scores a guess against the current round,
+// starting a new round if there isn't one already
+func MakeGuess(username string, lat, lng float64) (Guess, error) {
+	if c.Conf.ReadOnly {
+		return Guess{}, &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+
+	if currentRound == nil {
+		round, err := startRound()
+		if err != nil {
+			return Guess{}, err
+		}
+		currentRound = round
+	}
+
+	distance := helpers.DistanceInMiles(currentRound.Lat, currentRound.Lng, lat, lng)
+	guess := Guess{
+		RoundID:  currentRound.ID,
+		Username: username,
+		Lat:      lat,
+		Lng:      lng,
+		Distance: distance,
+		Points:   Points(distance),
+	}
+
+	// the unique index means people can only guess once per round
+	query := `INSERT INTO geoguess_guesses (round_id, username, lat, lng, distance, points)
+		VALUES (:round_id, :username, :lat, :lng, :distance, :points)
+		ON CONFLICT (round_id, username) DO NOTHING`
+	res, err := database.Connection().NamedExec(query, guess)
+	if err != nil {
+		terrors.Log(err, "error saving geoguess")
+		return guess, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return guess, ErrAlreadyGuessed
+	}
+
+	// make sure they're in the DB before they get points
+	users.FindOrCreate(username)
+	err = scoreboards.AddToPeriods(username, scoreboards.KindGuessPoints, guess.Points, scoreboards.Monthly, scoreboards.AllTime)
+	if err != nil {
+		terrors.Log(err, "error adding geoguess points")
+	}
+
+	log.Printf("%s guessed %.0f miles away in geoguess round %d", aurora.Cyan(username), distance, guess.RoundID)
+	return guess, nil
+}
+
+// Points returns the points for a guess the given distance away
+func Points(distance float64) float32 {
+	points := maxPoints * math.Exp(-distance/falloffMiles)
+	// round to two decimal places
+	return float32(math.Round(points*100) / 100)
+}
+
+// startRound creates a new round for the current video,
+// it must be called with roundMutex held
+func startRound() (*Round, error) {
+	vid := video.CurrentlyPlaying
+	if vid.Flagged {
+		vid = vid.Next()
+	}
+	lat, lng, err := vid.Location()
+	if err != nil || (lat == 0 && lng == 0) {
+		return nil, ErrNoLocation
+	}
+
+	var round Round
+	query := `INSERT INTO geoguess_rounds (video_slug, lat, lng) VALUES ($1, $2, $3) RETURNING *`
+	err = database.Connection().Get(&round, query, vid.Slug, lat, lng)
+	if err != nil {
+		terrors.Log(err, "error creating geoguess round")
+		return nil, err
+	}
+	log.Println("starting geoguess round", round.ID, "for", aurora.Cyan(vid.Slug))
+
+	time.AfterFunc(RoundLength, func() { endRound(round.ID) })
+	return &round, nil
+}
+
+// endRound closes the round and shows the results onscreen
+func endRound(roundID int) {
+	roundMutex.Lock()
+	if currentRound == nil || currentRound.ID != roundID {
+		roundMutex.Unlock()
+		return
+	}
+	round := currentRound
+	currentRound = nil
+	roundMutex.Unlock()
+
+	_, err := database.Connection().Exec(`UPDATE geoguess_rounds SET date_ended=CURRENT_TIMESTAMP WHERE id=$1`, round.ID)
+	if err != nil {
+		terrors.Log(err, "error ending geoguess round")
+	}
+
+	guesses, err := RoundResults(round.ID)
+	if err != nil {
+		return
+	}
+	roundMutex.Lock()
+	lastRound = round
+	lastResults = guesses
+	roundMutex.Unlock()
+	log.Println("geoguess round", round.ID, "ended with", len(guesses), "guesses")
+
+	if len(guesses) > 0 {
+		onscreensClient.ShowGeoGuessResults(ResultsContent(*round, guesses))
+	}
+}
+
+// RoundResults returns the guesses for a round, best first
+func RoundResults(roundID int) ([]Guess, error) {
+	var guesses []Guess
+	query := `SELECT * FROM geoguess_guesses WHERE round_id=$1 ORDER BY distance ASC`
+	err := database.Connection().Select(&guesses, query, roundID)
+	if err != nil {
+		terrors.Log(err, "error getting geoguess results")
+	}
+	return guesses, err
+}
+
+// ResultsContent formats the results of a round to be shown onscreen
+func ResultsContent(round Round, guesses []Guess) string {
+	title := "Map Guess Results"
+	if answer, err := helpers.CityFromCoords(round.Lat, round.Lng); err == nil {
+		title = "We were in " + answer
+	}
+	output := title + "\n"
+
+	for i, guess := range guesses {
+		if i >= resultsToShow {
+			break
+		}
+		output = output + fmt.Sprintf("%.0fmi (%s)\n", guess.Distance, guess.Username)
+	}
+	return output
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []string{"", "hello", "alice|1614556800", "a much longer token value with spaces and ünïcode"}
+	for _, plaintext := range tests {
+		encrypted, err := Encrypt(plaintext, "passphrase")
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		decrypted, err := Decrypt(encrypted, "passphrase")
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", plaintext, err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("expected %q, got %q", plaintext, decrypted)
+		}
+	}
+}
+
+func TestEncryptUsesANewNonce(t *testing.T) {
+	first, _ := Encrypt("hello", "passphrase")
+	second, _ := Encrypt("hello", "passphrase")
+	if first == second {
+		t.Error("encrypting the same text twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	encrypted, err := Encrypt("hello", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(encrypted)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name       string
+		encoded    string
+		passphrase string
+	}{
+		{"wrong passphrase", encrypted, "something else"},
+		{"no passphrase", encrypted, ""},
+		{"tampered ciphertext", tampered, "passphrase"},
+		{"not base64", "not base64!", "passphrase"},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("short")), "passphrase"},
+	}
+	for _, tt := range tests {
+		if _, err := Decrypt(tt.encoded, tt.passphrase); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestEncryptNeedsAPassphrase(t *testing.T) {
+	if _, err := Encrypt("hello", ""); err == nil {
+		t.Error("expected an error without a passphrase")
+	}
+}
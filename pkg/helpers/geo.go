@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/latlong"
+	"github.com/kelvins/geocoder"
+)
+
+// earthRadiusMiles is used to calculate distances between coordinates
+const earthRadiusMiles = 3958.8
+
+// AddressFromCoords returns the closest address to the given coordinates
+func AddressFromCoords(lat, lon float64) (geocoder.Address, error) {
+	location := geocoder.Location{Latitude: lat, Longitude: lon}
+
+	addresses, err := geocoder.GeocodingReverse(location)
+	if err != nil {
+		return geocoder.Address{}, err
+	}
+	if len(addresses) == 0 {
+		return geocoder.Address{}, errors.New("no addresses found")
+	}
+	return addresses[0], nil
+}
+
+// CoordsFromCity looks up the coordinates of a city in a given state
+func CoordsFromCity(city, state string) (float64, float64, error) {
+	address := geocoder.Address{
+		City:    city,
+		State:   state,
+		Country: "United States",
+	}
+	location, err := geocoder.Geocoding(address)
+	if err != nil {
+		return 0, 0, err
+	}
+	return location.Latitude, location.Longitude, nil
+}
+
+// DistanceInMiles returns the great-circle distance between two points
+func DistanceInMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusMiles * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// TimeZoneName returns a friendly name for the US time zone at the
+// given coordinates (ex: "Mountain"), or an empty string if unknown
+func TimeZoneName(lat, lon float64) string {
+	location, err := time.LoadLocation(latlong.LookupZoneName(lat, lon))
+	if err != nil {
+		return ""
+	}
+	// the abbreviation is something like "MST" or "PDT"
+	abbrev := time.Now().In(location).Format("MST")
+	switch {
+	case strings.HasPrefix(abbrev, "AK"):
+		return "Alaska"
+	case strings.HasPrefix(abbrev, "H"):
+		return "Hawaii"
+	case strings.HasPrefix(abbrev, "E"):
+		return "Eastern"
+	case strings.HasPrefix(abbrev, "C"):
+		return "Central"
+	case strings.HasPrefix(abbrev, "M"):
+		return "Mountain"
+	case strings.HasPrefix(abbrev, "P"):
+		return "Pacific"
+	}
+	return ""
+}
+
+// NormalizeCounty strips the suffix from a county name,
+// so "Boulder County" and "boulder" are the same
+func NormalizeCounty(county string) string {
+	county = strings.ToLower(strings.TrimSpace(county))
+	for _, suffix := range []string{" county", " parish", " borough", " census area"} {
+		county = strings.TrimSuffix(county, suffix)
+	}
+	return county
+}
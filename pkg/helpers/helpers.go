@@ -176,6 +176,13 @@ func SunsetStr(utcDate time.Time, lat, lon float64) string {
 	return fmt.Sprintf("Sunset on this day is in %s", durafmt.ParseShort(dateDiff))
 }
 
+// AfterSunset returns true if the sun had set at the moment of filming
+func AfterSunset(utcDate time.Time, lat, lon float64) bool {
+	realDate := ActualDate(utcDate, lat, lon)
+	_, sunset := sunriseSunset(realDate, lat, lon)
+	return realDate.After(sunset)
+}
+
 func sunriseSunset(utcDate time.Time, lat, long float64) (time.Time, time.Time) {
 	rise, set := sunrise.SunriseSunset(
 		lat, long,
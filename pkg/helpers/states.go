@@ -28,6 +28,20 @@ func TitlecaseState(state string) string {
 	return strings.Title(strings.ToLower(state))
 }
 
+// StateRegion returns the census region a state is in (ex: "Midwest"),
+// or an empty string if it isn't in one
+func StateRegion(state string) string {
+	abbrev := StateToStateAbbrev(TitlecaseState(state))
+	return stateRegions[abbrev]
+}
+
+// StateCapital returns the capital of a state (ex: "Sacramento"),
+// or an empty string if we don't know it
+func StateCapital(state string) string {
+	abbrev := StateToStateAbbrev(TitlecaseState(state))
+	return stateCapitals[abbrev]
+}
+
 // A handy map of US state codes to full names
 var stateAbbrevs = map[string]string{
 	"AL": "Alabama",
@@ -95,3 +109,39 @@ var stateAbbrevs = map[string]string{
 	"AE": "Armed Forces Europe",
 	"AP": "Armed Forces Pacific",
 }
+
+// US census regions for each state
+var stateRegions = map[string]string{
+	"CT": "Northeast", "ME": "Northeast", "MA": "Northeast", "NH": "Northeast",
+	"RI": "Northeast", "VT": "Northeast", "NJ": "Northeast", "NY": "Northeast",
+	"PA": "Northeast",
+	"IL": "Midwest", "IN": "Midwest", "MI": "Midwest", "OH": "Midwest",
+	"WI": "Midwest", "IA": "Midwest", "KS": "Midwest", "MN": "Midwest",
+	"MO": "Midwest", "NE": "Midwest", "ND": "Midwest", "SD": "Midwest",
+	"DE": "South", "DC": "South", "FL": "South", "GA": "South",
+	"MD": "South", "NC": "South", "SC": "South", "VA": "South",
+	"WV": "South", "AL": "South", "KY": "South", "MS": "South",
+	"TN": "South", "AR": "South", "LA": "South", "OK": "South",
+	"TX": "South",
+	"AZ": "West", "CO": "West", "ID": "West", "MT": "West",
+	"NV": "West", "NM": "West", "UT": "West", "WY": "West",
+	"AK": "West", "CA": "West", "HI": "West", "OR": "West",
+	"WA": "West",
+}
+
+// the capital city of each state
+var stateCapitals = map[string]string{
+	"AL": "Montgomery", "AK": "Juneau", "AZ": "Phoenix", "AR": "Little Rock",
+	"CA": "Sacramento", "CO": "Denver", "CT": "Hartford", "DE": "Dover",
+	"FL": "Tallahassee", "GA": "Atlanta", "HI": "Honolulu", "ID": "Boise",
+	"IL": "Springfield", "IN": "Indianapolis", "IA": "Des Moines", "KS": "Topeka",
+	"KY": "Frankfort", "LA": "Baton Rouge", "ME": "Augusta", "MD": "Annapolis",
+	"MA": "Boston", "MI": "Lansing", "MN": "Saint Paul", "MS": "Jackson",
+	"MO": "Jefferson City", "MT": "Helena", "NE": "Lincoln", "NV": "Carson City",
+	"NH": "Concord", "NJ": "Trenton", "NM": "Santa Fe", "NY": "Albany",
+	"NC": "Raleigh", "ND": "Bismarck", "OH": "Columbus", "OK": "Oklahoma City",
+	"OR": "Salem", "PA": "Harrisburg", "RI": "Providence", "SC": "Columbia",
+	"SD": "Pierre", "TN": "Nashville", "TX": "Austin", "UT": "Salt Lake City",
+	"VT": "Montpelier", "VA": "Richmond", "WA": "Olympia", "WV": "Charleston",
+	"WI": "Madison", "WY": "Cheyenne",
+}
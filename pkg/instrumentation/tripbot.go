@@ -15,4 +15,17 @@ var (
 		Help: "The total number of chat commands",
 	}, []string{"command"},
 	)
+	WebhookRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tripbot_webhook_rejections_total",
+		Help: "The total number of webhook requests that were rejected",
+	}, []string{"reason"},
+	)
+	APIAuthFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tripbot_api_auth_failures_total",
+		Help: "The total number of API requests without a valid API key",
+	})
+	WebhookDuplicates = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tripbot_webhook_duplicates_total",
+		Help: "The total number of webhook requests we had already handled",
+	})
 )
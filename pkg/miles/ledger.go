@@ -0,0 +1,186 @@
+package miles
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx"
+)
+
+// LedgerEntry is a single change to a user's spendable miles.
+// The spendable balance is kept separate from users.miles so
+// that spending doesn't affect the leaderboards
+type LedgerEntry struct {
+	ID          int        `db:"id"`
+	UserID      uint16     `db:"user_id"`
+	Amount      Hundredths `db:"amount"`
+	Reason      string     `db:"reason"`
+	DateCreated time.Time  `db:"date_created"`
+}
+
+// Hundredths is an exact number of miles, in hundredths of a mile.
+// It matches the NUMERIC(12,2) amounts in the ledger, so balances
+// don't drift the way summed floats do
+type Hundredths int64
+
+// toHundredths rounds miles to the nearest hundredth
+func toHundredths(miles float32) Hundredths {
+	return Hundredths(math.Round(float64(miles) * 100))
+}
+
+// Miles returns the amount as a number of miles
+func (h Hundredths) Miles() float32 {
+	return float32(h) / 100
+}
+
+// String returns the amount like "12.34"
+func (h Hundredths) String() string {
+	sign := ""
+	if h < 0 {
+		sign = "-"
+		h = -h
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, h/100, h%100)
+}
+
+// Value lets us pass the amount to the DB as a NUMERIC
+func (h Hundredths) Value() (driver.Value, error) {
+	return h.String(), nil
+}
+
+// Scan reads a NUMERIC amount from the DB
+func (h *Hundredths) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*h = Hundredths(v * 100)
+		return nil
+	default:
+		return fmt.Errorf("can't scan %T into Hundredths", src)
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	parts := strings.SplitN(s, ".", 2)
+	whole, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	var frac int64
+	if len(parts) == 2 {
+		// NUMERIC(12,2) always has two decimals, but
+		// be safe if we're given more or fewer
+		digits := (parts[1] + "00")[:2]
+		frac, err = strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	*h = Hundredths(whole*100 + frac)
+	if negative {
+		*h = -*h
+	}
+	return nil
+}
+
+// Balance returns the number of spendable miles a user has
+func Balance(userID uint16) (float32, error) {
+	var balance Hundredths
+	query := `SELECT COALESCE(SUM(amount), 0) FROM miles_ledger WHERE user_id=$1`
+	err := database.Connection().Get(&balance, query, userID)
+	if err != nil {
+		terrors.Log(err, "error getting miles balance")
+	}
+	return balance.Miles(), err
+}
+
+// Credit adds spendable miles to a user's balance
+func Credit(userID uint16, amount float32, reason string) error {
+	if toHundredths(amount) <= 0 {
+		return nil
+	}
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	query := `INSERT INTO miles_ledger (user_id, amount, reason) VALUES ($1, $2, $3)`
+	_, err := database.Connection().Exec(query, userID, toHundredths(amount), reason)
+	if err != nil {
+		terrors.Log(err, "error crediting miles")
+	}
+	return err
+}
+
+// CreditInTx adds spendable miles to a user's balance as
+// part of a larger transaction
+func CreditInTx(tx *sqlx.Tx, userID uint16, amount float32, reason string) error {
+	if toHundredths(amount) <= 0 {
+		return nil
+	}
+	query := `INSERT INTO miles_ledger (user_id, amount, reason) VALUES ($1, $2, $3)`
+	_, err := tx.Exec(query, userID, toHundredths(amount), reason)
+	if err != nil {
+		terrors.Log(err, "error crediting miles")
+	}
+	return err
+}
+
+// Spend removes spendable miles from a user's balance, returning an
+// InsufficientMilesError if they can't afford it. The user's row is
+// locked for the duration of the transaction so two commands racing
+// each other can't spend the same miles twice
+func Spend(userID uint16, amount float32, reason string) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+
+	tx, err := database.Connection().Beginx()
+	if err != nil {
+		terrors.Log(err, "error starting transaction")
+		return err
+	}
+	// rollback is a no-op if the transaction was committed
+	defer tx.Rollback()
+
+	// lock the user so concurrent spends have to wait their turn
+	_, err = tx.Exec(`SELECT id FROM users WHERE id=$1 FOR UPDATE`, userID)
+	if err != nil {
+		terrors.Log(err, "error locking user")
+		return err
+	}
+
+	var balance Hundredths
+	err = tx.Get(&balance, `SELECT COALESCE(SUM(amount), 0) FROM miles_ledger WHERE user_id=$1`, userID)
+	if err != nil {
+		terrors.Log(err, "error getting miles balance")
+		return err
+	}
+
+	cost := toHundredths(amount)
+	if balance < cost {
+		msg := fmt.Sprintf("balance of %s is less than %s", balance, cost)
+		return &terrors.InsufficientMilesError{Msg: msg}
+	}
+
+	_, err = tx.Exec(`INSERT INTO miles_ledger (user_id, amount, reason) VALUES ($1, $2, $3)`, userID, -cost, reason)
+	if err != nil {
+		terrors.Log(err, "error spending miles")
+		return err
+	}
+
+	if c.Conf.Verbose {
+		log.Printf("user_id:%d spent %.2f miles on %s", userID, amount, reason)
+	}
+	return tx.Commit()
+}
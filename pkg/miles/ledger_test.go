@@ -0,0 +1,88 @@
+package miles
+
+import "testing"
+
+func TestToHundredths(t *testing.T) {
+	tests := []struct {
+		miles    float32
+		expected Hundredths
+	}{
+		{miles: 0, expected: 0},
+		{miles: 1, expected: 100},
+		{miles: 0.1, expected: 10},
+		{miles: 12.345, expected: 1235},
+		{miles: 0.004, expected: 0},
+		{miles: -2.5, expected: -250},
+	}
+
+	for _, tt := range tests {
+		got := toHundredths(tt.miles)
+		if got != tt.expected {
+			t.Errorf("toHundredths(%v): expected %d, got %d", tt.miles, tt.expected, got)
+		}
+	}
+}
+
+func TestHundredthsString(t *testing.T) {
+	tests := []struct {
+		amount   Hundredths
+		expected string
+	}{
+		{amount: 0, expected: "0.00"},
+		{amount: 5, expected: "0.05"},
+		{amount: 1234, expected: "12.34"},
+		{amount: -50, expected: "-0.50"},
+		{amount: -1201, expected: "-12.01"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.expected {
+			t.Errorf("String(%d): expected %s, got %s", tt.amount, tt.expected, got)
+		}
+	}
+}
+
+func TestHundredthsScan(t *testing.T) {
+	tests := []struct {
+		src      interface{}
+		expected Hundredths
+	}{
+		{src: []byte("12.34"), expected: 1234},
+		{src: []byte("0"), expected: 0},
+		{src: []byte("-0.50"), expected: -50},
+		{src: "7.5", expected: 750},
+		{src: "1.239", expected: 123},
+		{src: int64(3), expected: 300},
+	}
+
+	for _, tt := range tests {
+		var got Hundredths
+		if err := got.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v): expected no error, got %v", tt.src, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Scan(%v): expected %d, got %d", tt.src, tt.expected, got)
+		}
+	}
+
+	var h Hundredths
+	for _, src := range []interface{}{[]byte("abc"), 1.5, nil} {
+		if err := h.Scan(src); err == nil {
+			t.Errorf("Scan(%v): expected an error, got nil", src)
+		}
+	}
+}
+
+func TestHundredthsRoundTrip(t *testing.T) {
+	for _, amount := range []Hundredths{0, 1, 99, 100, 123456, -1, -250} {
+		value, _ := amount.Value()
+		var got Hundredths
+		if err := got.Scan(value); err != nil {
+			t.Errorf("Scan(%v): expected no error, got %v", value, err)
+		}
+		if got != amount {
+			t.Errorf("round trip of %d: got %d", amount, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package miles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/logrusorgru/aurora"
+)
+
+// these are the different kinds of conditions a Rule can have
+const (
+	ConditionSubscriber = "subscriber"
+	ConditionFollower   = "follower"
+	ConditionStreak     = "streak"
+	ConditionFootageHrs = "footage_hours"
+	ConditionWeekday    = "weekday"
+	ConditionDateRange  = "date_range"
+)
+
+// Rule is a single multiplier that is applied to the miles a user
+// earns, as long as the condition is met
+type Rule struct {
+	// Name is a short description shown to users (in !bonusmiles)
+	Name string `json:"name"`
+	// Condition is one of the Condition* constants
+	Condition string `json:"condition"`
+	// Multiplier is applied to the miles earned (1.05 is a 5% bonus)
+	Multiplier float32 `json:"multiplier"`
+	// Disabled lets us keep a rule in the file without using it
+	Disabled bool `json:"disabled"`
+
+	// Tier is used by subscriber rules, 0 matches any tier
+	Tier int `json:"tier,omitempty"`
+	// MinStreakDays is used by streak rules
+	MinStreakDays int `json:"min_streak_days,omitempty"`
+	// StartHour and EndHour are used by footage_hours rules,
+	// they are in the local time of the footage (0-23)
+	StartHour int `json:"start_hour,omitempty"`
+	EndHour   int `json:"end_hour,omitempty"`
+	// Weekdays are used by weekday rules (ex: "saturday")
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Start and End are used by date_range rules (special events)
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+// Facts are the things we know about a user when deciding which
+// rules apply to them. Some of these are expensive to figure out
+// (like following, which hits the Twitch API) so they're funcs that
+// only get called if a rule needs them
+type Facts struct {
+	IsSubscriber   func() bool
+	SubscriberTier func() int
+	IsFollower     func() bool
+	StreakDays     func() int
+}
+
+// FootageTime returns the local time of the currently-playing footage.
+// It is set in main() because importing video here would cause
+// circular dependencies
+var FootageTime func() (time.Time, error)
+
+// DefaultRules are used if no rules file is configured, they
+// scale the original 5% subscriber bonus by tier
+var DefaultRules = []Rule{
+	{
+		Name:       "tier 1 subscriber bonus",
+		Condition:  ConditionSubscriber,
+		Tier:       1,
+		Multiplier: 1.05,
+	},
+	{
+		Name:       "tier 2 subscriber bonus",
+		Condition:  ConditionSubscriber,
+		Tier:       2,
+		Multiplier: 1.10,
+	},
+	{
+		Name:       "tier 3 subscriber bonus",
+		Condition:  ConditionSubscriber,
+		Tier:       3,
+		Multiplier: 1.20,
+	},
+}
+
+// Rules contains the currently-loaded rules
+var Rules = DefaultRules
+
+// LoadRules reads a JSON file containing a list of rules
+func LoadRules(path string) error {
+	if path == "" {
+		log.Println("no miles rules file configured, using defaults")
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		terrors.Log(err, "error reading miles rules file")
+		return err
+	}
+
+	var rules []Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		terrors.Log(err, "error parsing miles rules file")
+		return err
+	}
+
+	for _, rule := range rules {
+		err = rule.validate()
+		if err != nil {
+			terrors.Log(err, "invalid miles rule")
+			return err
+		}
+	}
+
+	Rules = rules
+	log.Println("loaded", aurora.Cyan(len(Rules)), "miles rules from", path)
+	return nil
+}
+
+// ActiveRules returns the rules that currently apply given the facts
+func ActiveRules(facts Facts) []Rule {
+	var active []Rule
+	for _, rule := range Rules {
+		if rule.Disabled {
+			continue
+		}
+		if rule.applies(facts, time.Now()) {
+			active = append(active, rule)
+		}
+	}
+	return active
+}
+
+// Multiplier returns all of the active multipliers stacked together
+func Multiplier(facts Facts) float32 {
+	var multiplier float32 = 1.0
+	for _, rule := range ActiveRules(facts) {
+		multiplier *= rule.Multiplier
+	}
+	return multiplier
+}
+
+// String returns a description of the rule, like "subscriber bonus (x1.05)"
+func (r Rule) String() string {
+	return fmt.Sprintf("%s (x%.2f)", r.Name, r.Multiplier)
+}
+
+// applies returns true if the condition of the rule is met
+func (r Rule) applies(facts Facts, now time.Time) bool {
+	switch r.Condition {
+	case ConditionSubscriber:
+		if r.Tier == 0 {
+			return facts.IsSubscriber != nil && facts.IsSubscriber()
+		}
+		return facts.SubscriberTier != nil && facts.SubscriberTier() == r.Tier
+	case ConditionFollower:
+		return facts.IsFollower != nil && facts.IsFollower()
+	case ConditionStreak:
+		return facts.StreakDays != nil && facts.StreakDays() >= r.MinStreakDays
+	case ConditionFootageHrs:
+		if FootageTime == nil {
+			return false
+		}
+		footageTime, err := FootageTime()
+		if err != nil {
+			return false
+		}
+		return hourInRange(footageTime.Hour(), r.StartHour, r.EndHour)
+	case ConditionWeekday:
+		today := strings.ToLower(now.Weekday().String())
+		for _, day := range r.Weekdays {
+			if strings.ToLower(day) == today {
+				return true
+			}
+		}
+		return false
+	case ConditionDateRange:
+		return now.After(r.Start) && now.Before(r.End)
+	}
+	return false
+}
+
+// validate makes sure the rule makes sense
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule is missing a name")
+	}
+	if r.Multiplier <= 0 {
+		return fmt.Errorf("rule %s has an invalid multiplier", r.Name)
+	}
+	switch r.Condition {
+	case ConditionSubscriber:
+		if r.Tier < 0 || r.Tier > 3 {
+			return fmt.Errorf("rule %s has an invalid tier", r.Name)
+		}
+	case ConditionFollower:
+		return nil
+	case ConditionStreak:
+		if r.MinStreakDays < 1 {
+			return fmt.Errorf("rule %s needs min_streak_days", r.Name)
+		}
+	case ConditionFootageHrs:
+		if r.StartHour < 0 || r.StartHour > 23 || r.EndHour < 0 || r.EndHour > 23 {
+			return fmt.Errorf("rule %s has an invalid hour range", r.Name)
+		}
+	case ConditionWeekday:
+		if len(r.Weekdays) == 0 {
+			return fmt.Errorf("rule %s needs weekdays", r.Name)
+		}
+	case ConditionDateRange:
+		if !r.End.After(r.Start) {
+			return fmt.Errorf("rule %s has an invalid date range", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %s has unknown condition %s", r.Name, r.Condition)
+	}
+	return nil
+}
+
+// hourInRange returns true if the hour is between start and end,
+// handling ranges that wrap past midnight (ex: 20 to 5)
+func hourInRange(hour, start, end int) bool {
+	if start <= end {
+		return hour >= start && hour <= end
+	}
+	return hour >= start || hour <= end
+}
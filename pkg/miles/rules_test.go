@@ -0,0 +1,245 @@
+package miles
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeFootageTime makes footage_hours rules see the given time
+func fakeFootageTime(t *testing.T, footageTime time.Time, err error) {
+	oldFootageTime := FootageTime
+	FootageTime = func() (time.Time, error) {
+		return footageTime, err
+	}
+	t.Cleanup(func() {
+		FootageTime = oldFootageTime
+	})
+}
+
+func TestHourInRange(t *testing.T) {
+	tests := []struct {
+		hour, start, end int
+		expected         bool
+	}{
+		{hour: 12, start: 9, end: 17, expected: true},
+		{hour: 9, start: 9, end: 17, expected: true},
+		{hour: 17, start: 9, end: 17, expected: true},
+		{hour: 8, start: 9, end: 17, expected: false},
+		{hour: 18, start: 9, end: 17, expected: false},
+		// ranges that wrap past midnight
+		{hour: 22, start: 20, end: 5, expected: true},
+		{hour: 0, start: 20, end: 5, expected: true},
+		{hour: 5, start: 20, end: 5, expected: true},
+		{hour: 12, start: 20, end: 5, expected: false},
+		// a single hour
+		{hour: 3, start: 3, end: 3, expected: true},
+		{hour: 4, start: 3, end: 3, expected: false},
+	}
+
+	for _, tt := range tests {
+		got := hourInRange(tt.hour, tt.start, tt.end)
+		if got != tt.expected {
+			t.Errorf("hourInRange(%d, %d, %d): expected %v, got %v", tt.hour, tt.start, tt.end, tt.expected, got)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	// a saturday
+	now := time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC)
+	yes := func() bool { return true }
+	no := func() bool { return false }
+	num := func(n int) func() int { return func() int { return n } }
+
+	tests := []struct {
+		name     string
+		rule     Rule
+		facts    Facts
+		expected bool
+	}{
+		{
+			name:     "any tier subscriber",
+			rule:     Rule{Condition: ConditionSubscriber},
+			facts:    Facts{IsSubscriber: yes},
+			expected: true,
+		},
+		{
+			name:     "any tier non-subscriber",
+			rule:     Rule{Condition: ConditionSubscriber},
+			facts:    Facts{IsSubscriber: no},
+			expected: false,
+		},
+		{
+			name:     "matching tier",
+			rule:     Rule{Condition: ConditionSubscriber, Tier: 2},
+			facts:    Facts{SubscriberTier: num(2)},
+			expected: true,
+		},
+		{
+			name:     "different tier",
+			rule:     Rule{Condition: ConditionSubscriber, Tier: 2},
+			facts:    Facts{SubscriberTier: num(1)},
+			expected: false,
+		},
+		{
+			name:     "missing subscriber facts",
+			rule:     Rule{Condition: ConditionSubscriber, Tier: 1},
+			facts:    Facts{},
+			expected: false,
+		},
+		{
+			name:     "follower",
+			rule:     Rule{Condition: ConditionFollower},
+			facts:    Facts{IsFollower: yes},
+			expected: true,
+		},
+		{
+			name:     "missing follower facts",
+			rule:     Rule{Condition: ConditionFollower},
+			facts:    Facts{},
+			expected: false,
+		},
+		{
+			name:     "long enough streak",
+			rule:     Rule{Condition: ConditionStreak, MinStreakDays: 3},
+			facts:    Facts{StreakDays: num(3)},
+			expected: true,
+		},
+		{
+			name:     "short streak",
+			rule:     Rule{Condition: ConditionStreak, MinStreakDays: 3},
+			facts:    Facts{StreakDays: num(2)},
+			expected: false,
+		},
+		{
+			name:     "matching weekday",
+			rule:     Rule{Condition: ConditionWeekday, Weekdays: []string{"Saturday", "sunday"}},
+			expected: true,
+		},
+		{
+			name:     "different weekday",
+			rule:     Rule{Condition: ConditionWeekday, Weekdays: []string{"monday"}},
+			expected: false,
+		},
+		{
+			name:     "inside date range",
+			rule:     Rule{Condition: ConditionDateRange, Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+			expected: true,
+		},
+		{
+			name:     "after date range",
+			rule:     Rule{Condition: ConditionDateRange, Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+			expected: false,
+		},
+		{
+			name:     "unknown condition",
+			rule:     Rule{Condition: "moon_phase"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.rule.applies(tt.facts, now)
+		if got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestAppliesFootageHours(t *testing.T) {
+	rule := Rule{Condition: ConditionFootageHrs, StartHour: 20, EndHour: 5}
+	now := time.Now()
+
+	fakeFootageTime(t, time.Date(2018, 6, 1, 23, 0, 0, 0, time.UTC), nil)
+	if !rule.applies(Facts{}, now) {
+		t.Errorf("expected rule to apply to footage at 23:00")
+	}
+
+	fakeFootageTime(t, time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC), nil)
+	if rule.applies(Facts{}, now) {
+		t.Errorf("expected rule not to apply to footage at 12:00")
+	}
+
+	// if we don't know the footage time the rule shouldn't apply
+	fakeFootageTime(t, time.Date(2018, 6, 1, 23, 0, 0, 0, time.UTC), errors.New("no video"))
+	if rule.applies(Facts{}, now) {
+		t.Errorf("expected rule not to apply when the footage time is unknown")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		valid bool
+	}{
+		{
+			name:  "default rules",
+			rule:  DefaultRules[0],
+			valid: true,
+		},
+		{
+			name:  "missing name",
+			rule:  Rule{Condition: ConditionFollower, Multiplier: 1.1},
+			valid: false,
+		},
+		{
+			name:  "zero multiplier",
+			rule:  Rule{Name: "x", Condition: ConditionFollower},
+			valid: false,
+		},
+		{
+			name:  "follower",
+			rule:  Rule{Name: "x", Condition: ConditionFollower, Multiplier: 1.1},
+			valid: true,
+		},
+		{
+			name:  "invalid tier",
+			rule:  Rule{Name: "x", Condition: ConditionSubscriber, Multiplier: 1.1, Tier: 4},
+			valid: false,
+		},
+		{
+			name:  "streak without days",
+			rule:  Rule{Name: "x", Condition: ConditionStreak, Multiplier: 1.1},
+			valid: false,
+		},
+		{
+			name:  "wrapping hour range",
+			rule:  Rule{Name: "x", Condition: ConditionFootageHrs, Multiplier: 1.1, StartHour: 20, EndHour: 5},
+			valid: true,
+		},
+		{
+			name:  "hour out of range",
+			rule:  Rule{Name: "x", Condition: ConditionFootageHrs, Multiplier: 1.1, StartHour: 20, EndHour: 24},
+			valid: false,
+		},
+		{
+			name:  "no weekdays",
+			rule:  Rule{Name: "x", Condition: ConditionWeekday, Multiplier: 1.1},
+			valid: false,
+		},
+		{
+			name:  "backwards date range",
+			rule:  Rule{Name: "x", Condition: ConditionDateRange, Multiplier: 1.1, Start: now, End: now.Add(-time.Hour)},
+			valid: false,
+		},
+		{
+			name:  "unknown condition",
+			rule:  Rule{Name: "x", Condition: "moon_phase", Multiplier: 1.1},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.rule.validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error, got nil", tt.name)
+		}
+	}
+}
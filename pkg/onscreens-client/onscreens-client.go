@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
 	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
@@ -50,25 +49,37 @@ func ShowLeaderboard(title string, leaderboard [][]string) error {
 	return nil
 }
 
+// ShowGeoGuessResults shows the results of a map guessing round
+func ShowGeoGuessResults(content string) error {
+	url := onscreensServerURL + "/onscreens/geoguess/show"
+	url = fmt.Sprintf("%s?content=%s", url, helpers.Base64Encode(content))
+
+	_, err := getUrl(url)
+	if err != nil {
+		terrors.Log(err, "error showing geoguess results onscreen")
+		return err
+	}
+	return nil
+}
+
 //TODO: this is taken right from the !guessleaderboard command, DRY it?
 func ShowGuessLeaderboard() {
 	// select users to show in leaderboard
 	size := 10
-	leaderboard := scoreboards.TopUsers(scoreboards.CurrentGuessScoreboard(), size)
-	if size > len(leaderboard) {
-		size = len(leaderboard)
+	board, err := scoreboards.Current(scoreboards.KindGuessPoints, scoreboards.Monthly)
+	if err != nil {
+		return
 	}
-	leaderboard = leaderboard[:size]
-
-	var intLeaderboard [][]string
-	for _, leaderPair := range leaderboard {
-		// guesses are ints not floats, so remove the decimal place
-		intVersion := strings.Split(leaderPair[1], ".")[0]
-		intLeaderboard = append(intLeaderboard, []string{leaderPair[0], intVersion})
+	entries, err := board.Top(size)
+	if err != nil {
+		return
 	}
 
+	// hints and bonus guesses give out partial points
+	pointsLeaderboard := scoreboards.Pairs(entries, "%.1f")
+
 	// display leaderboard on screen
-	ShowLeaderboard("Correct Guesses This Month", intLeaderboard)
+	ShowLeaderboard("Guess Points This Month", pointsLeaderboard)
 }
 
 func ShowTimewarp() error {
@@ -0,0 +1,24 @@
+package onscreensServer
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/vlc-server"
+)
+
+var geoGuessDuration = time.Duration(20 * time.Second)
+var geoGuessFile = filepath.Join(c.Conf.RunDir, "geoguess.txt")
+
+// GeoGuess shows the results of the map guessing game
+var GeoGuess *Onscreen
+
+func InitGeoGuess() {
+	log.Println("Creating geoguess onscreen")
+	GeoGuess = New(geoGuessFile)
+}
+
+func ShowGeoGuess(content string) {
+	GeoGuess.ShowFor(content, geoGuessDuration)
+}
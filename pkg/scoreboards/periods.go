@@ -0,0 +1,102 @@
+package scoreboards
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Period is how long a scoreboard lasts before a new one starts
+type Period string
+
+// these are the different scoreboard periods
+const (
+	Daily   Period = "daily"
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+	AllTime Period = "all-time"
+)
+
+// these are the kinds of scoreboards we keep,
+// each kind can have a board for every period
+const (
+	KindMiles = "miles"
+	// correct guesses used to be counted here, the old
+	// boards are kept but guesses now score KindGuessPoints
+	KindGuessState          = "guess_state"
+	KindIncorrectGuessState = "incorrect_guess_state"
+	KindGuessPoints         = "guess_points"
+	KindTrivia              = "trivia"
+)
+
+// these are used to figure out the kind and period from a board name
+var (
+	dailyName   = regexp.MustCompile(`^(.+)_(\d{4}_\d{2}_\d{2})$`)
+	weeklyName  = regexp.MustCompile(`^(.+)_(\d{4})_w(\d{2})$`)
+	monthlyName = regexp.MustCompile(`^(.+)_(\d{4}_\d{2})$`)
+	allTimeName = regexp.MustCompile(`^(.+)_total$`)
+)
+
+// Name returns the name of the board for the kind and period containing t
+// ex: miles_2024_05 (monthly), miles_2024_w19 (weekly), miles_total (all-time)
+func Name(kind string, period Period, t time.Time) string {
+	switch period {
+	case Daily:
+		return kind + "_" + t.Format("2006_01_02")
+	case Weekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s_%d_w%02d", kind, year, week)
+	case Monthly:
+		return kind + "_" + t.Format("2006_01")
+	}
+	return kind + "_total"
+}
+
+// PeriodStart returns the start of the period containing t
+func PeriodStart(period Period, t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case Daily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case Weekly:
+		// weeks start on monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case Monthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+// parseName figures out the kind and period of a board from its name,
+// boards that don't follow the naming scheme are treated as all-time
+func parseName(name string) (string, Period, sql.NullTime) {
+	if m := dailyName.FindStringSubmatch(name); m != nil {
+		if t, err := time.Parse("2006_01_02", m[2]); err == nil {
+			return m[1], Daily, sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	if m := weeklyName.FindStringSubmatch(name); m != nil {
+		year, _ := strconv.Atoi(m[2])
+		week, _ := strconv.Atoi(m[3])
+		return m[1], Weekly, sql.NullTime{Time: isoWeekStart(year, week), Valid: true}
+	}
+	if m := monthlyName.FindStringSubmatch(name); m != nil {
+		if t, err := time.Parse("2006_01", m[2]); err == nil {
+			return m[1], Monthly, sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	if m := allTimeName.FindStringSubmatch(name); m != nil {
+		return m[1], AllTime, sql.NullTime{}
+	}
+	return name, AllTime, sql.NullTime{}
+}
+
+// isoWeekStart returns the monday that starts the given ISO week
+func isoWeekStart(year, week int) time.Time {
+	// january 4th is always in the first week
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	return PeriodStart(Weekly, jan4).AddDate(0, 0, (week-1)*7)
+}
@@ -0,0 +1,146 @@
+package scoreboards
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx"
+)
+
+// Entry is a user's place on a scoreboard
+type Entry struct {
+	Rank     int     `db:"rank" json:"rank"`
+	Username string  `db:"username" json:"username"`
+	Value    float32 `db:"value" json:"value"`
+}
+
+// Standing is where a user is on a scoreboard, and how far
+// they are from the person one place ahead of them
+type Standing struct {
+	Entry
+	// Ahead is nil if the user is in first place
+	Ahead *Entry `json:"ahead,omitempty"`
+}
+
+// Behind returns how far the user is from the person ahead of them
+func (s Standing) Behind() float32 {
+	if s.Ahead == nil {
+		return 0
+	}
+	return s.Ahead.Value - s.Value
+}
+
+// ErrNotRanked is returned when a user has no score on a board
+var ErrNotRanked = sql.ErrNoRows
+
+// rankedScores ranks everyone on the board, ties get the same rank
+const rankedScores = `SELECT RANK() OVER (ORDER BY scores.value DESC) AS rank, users.username, scores.value
+	FROM scores JOIN users ON scores.user_id = users.id
+	WHERE scores.scoreboard_id = ? AND users.username NOT IN (?)`
+
+// Top returns the top n entries on the board
+func (s Scoreboard) Top(n int) ([]Entry, error) {
+	return s.selectEntries(`SELECT * FROM (`+rankedScores+`) ranked ORDER BY rank, username LIMIT ?`, n)
+}
+
+// Rank returns the user's place on the board
+func (s Scoreboard) Rank(username string) (Entry, error) {
+	entries, err := s.selectEntries(`SELECT * FROM (`+rankedScores+`) ranked WHERE username = ?`, username)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, ErrNotRanked
+	}
+	return entries[0], nil
+}
+
+// Around returns the user's entry, with up to n entries on either side
+func (s Scoreboard) Around(username string, n int) ([]Entry, error) {
+	query := `WITH ranked AS (SELECT *, ROW_NUMBER() OVER (ORDER BY rank, username) AS position FROM (` + rankedScores + `) r)
+		SELECT rank, username, value FROM ranked
+		WHERE position BETWEEN (SELECT position FROM ranked WHERE username = ?) - ?
+			AND (SELECT position FROM ranked WHERE username = ?) + ?
+		ORDER BY position`
+	entries, err := s.selectEntries(query, username, n, username, n)
+	if err == nil && len(entries) == 0 {
+		return nil, ErrNotRanked
+	}
+	return entries, err
+}
+
+// Standing returns the user's place on the board,
+// and who they need to pass to move up
+func (s Scoreboard) Standing(username string) (Standing, error) {
+	entry, err := s.Rank(username)
+	if err != nil {
+		return Standing{}, err
+	}
+	standing := Standing{Entry: entry}
+	if entry.Rank > 1 {
+		ahead, err := s.selectEntries(`SELECT * FROM (`+rankedScores+`) ranked WHERE rank < ? ORDER BY rank DESC, username LIMIT 1`, entry.Rank)
+		if err != nil {
+			return standing, err
+		}
+		if len(ahead) > 0 {
+			standing.Ahead = &ahead[0]
+		}
+	}
+	return standing, nil
+}
+
+// Add increases the user's score on the board
+func (s Scoreboard) Add(username string, value float32) error {
+	return AddToScoreByName(username, s.Name, value)
+}
+
+// AddToPeriods increases the user's score on the current board for each
+// period (ex: the monthly and all-time boards), creating them if needed
+func AddToPeriods(username, kind string, value float32, periods ...Period) error {
+	now := time.Now()
+	for _, period := range periods {
+		err := AddToScoreByName(username, Name(kind, period, now), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectEntries runs a query built on rankedScores, the first two
+// bindvars are filled in with the board and the ignored users
+func (s Scoreboard) selectEntries(q string, args ...interface{}) ([]Entry, error) {
+	ignoredUsers := append([]string{strings.ToLower(c.Conf.ChannelName)}, c.IgnoredUsers...)
+
+	// we use MySQL-style ? bindvars instead of postgres ones here
+	// because that's what sqlx wants for In()
+	query, args, err := sqlx.In(q, append([]interface{}{s.ID, ignoredUsers}, args...)...)
+	if err != nil {
+		terrors.Log(err, "error generating query")
+		return nil, err
+	}
+	// Rebind will convert the query to postgres syntax
+	query = database.Connection().Rebind(query)
+
+	var entries []Entry
+	err = database.Connection().Select(&entries, query, args...)
+	if err != nil {
+		terrors.Log(err, "error getting scoreboard entries")
+	}
+	return entries, err
+}
+
+// Pairs formats the entries the way the leaderboard onscreen wants them,
+// the format is used for the value (ex: "%.1f")
+func Pairs(entries []Entry, format string) [][]string {
+	var pairs [][]string
+	for _, entry := range entries {
+		pairs = append(pairs, []string{entry.Username, fmt.Sprintf(format, entry.Value)})
+	}
+	return pairs
+}
@@ -2,58 +2,53 @@ package scoreboards
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
-	"strings"
+	"sync"
 	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
-	"github.com/jmoiron/sqlx"
 )
 
-// Scoreboard represents a bucket of scores, and has a name to identify it
+// Scoreboard represents a bucket of scores, and has a name to identify it.
+// Each kind of score (ex: miles) has a board for every period
 type Scoreboard struct {
-	ID          uint16    `db:"id"`
-	Name        string    `db:"name"`
-	DateCreated time.Time `db:"date_created"`
+	ID          uint16       `db:"id"`
+	Name        string       `db:"name"`
+	Kind        string       `db:"kind"`
+	Period      Period       `db:"period"`
+	PeriodStart sql.NullTime `db:"period_start"`
+	DateCreated time.Time    `db:"date_created"`
 }
 
-func TopUsers(scoreboardName string, size int) [][]string {
-	var leaderboard [][]string
+// Current returns the board for the kind and period happening now,
+// creating it if it doesn't exist yet
+func Current(kind string, period Period) (Scoreboard, error) {
+	return For(kind, period, time.Now())
+}
 
-	ignoredUsers := append(c.IgnoredUsers, strings.ToLower(c.Conf.ChannelName))
+// For returns the board for the kind and the period containing t,
+// creating it if it doesn't exist yet
+func For(kind string, period Period, t time.Time) (Scoreboard, error) {
+	return findOrCreateScoreboard(Name(kind, period, t))
+}
 
-	// we use MySQL-style ? bindvars instead of postgres ones here
-	// because that's what sqlx wants for In()
-	q := `SELECT users.username, scores.value FROM scoreboards, scores, users WHERE scoreboards.name = ? AND scores.user_id = users.id AND scores.scoreboard_id = scoreboards.id AND users.username NOT IN (?) ORDER BY scores.value DESC LIMIT ?;`
-	query, args, err := sqlx.In(q, scoreboardName, ignoredUsers, size)
-	if err != nil {
-		terrors.Log(err, "error generating query")
-	}
+// scoreboardIDs caches the IDs of boards we've already looked up,
+// the names never change so they never need to be expired
+var scoreboardIDs sync.Map
 
-	// Rebind will convert the query to postgres syntax
-	query = database.Connection().Rebind(query)
-	rows, err := database.Connection().Query(query, args...)
-	if err != nil {
-		terrors.Log(err, "error running query")
+// scoreboardID returns the ID for the named board, creating it if necessary
+func scoreboardID(name string) (uint16, error) {
+	if id, ok := scoreboardIDs.Load(name); ok {
+		return id.(uint16), nil
 	}
-
-	for rows.Next() {
-		var username string
-		var value float32
-		err = rows.Scan(&username, &value)
-		if err != nil {
-			terrors.Log(err, "error scanning row")
-			continue
-		}
-		valueAsString := fmt.Sprintf("%.1f", value)
-		pair := []string{username, valueAsString}
-		leaderboard = append(leaderboard, pair)
+	scoreboard, err := findOrCreateScoreboard(name)
+	if err != nil {
+		return 0, err
 	}
-
-	return leaderboard
+	scoreboardIDs.Store(name, scoreboard.ID)
+	return scoreboard.ID, nil
 }
 
 // findOrCreateScoreboard will find a Scoreboard in the DB or create one
@@ -85,17 +80,14 @@ func createScoreboard(name string) (Scoreboard, error) {
 	if c.Conf.Verbose {
 		log.Println("creating scoreboard", name)
 	}
-	tx := database.Connection().MustBegin()
-	// create a new scoreboard
-	_, err := tx.Exec("INSERT INTO scoreboards (name) VALUES ($1)", name)
+	// create a new scoreboard, someone else may have beaten us to it
+	kind, period, periodStart := parseName(name)
+	query := `INSERT INTO scoreboards (name, kind, period, period_start) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO NOTHING`
+	_, err := database.Connection().Exec(query, name, kind, period, periodStart)
 	if err != nil {
 		terrors.Log(err, "error inserting scoreboard into db")
 		return scoreboard, err
 	}
-	err = tx.Commit()
-	if err != nil {
-		terrors.Log(err, "error committing new scoreboard in DB")
-		return scoreboard, err
-	}
 	return findScoreboard(name)
 }
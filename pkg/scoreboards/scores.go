@@ -1,13 +1,13 @@
 package scoreboards
 
 import (
-	"database/sql"
-	"log"
+	"fmt"
 	"time"
 
-	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // Score represents a user's score on a scoreboard
@@ -19,115 +19,107 @@ type Score struct {
 	DateCreated  time.Time `db:"date_created"`
 }
 
-// GetScoreByName returns the score value for a given username and scoreboard name
-//TODO: this could be achieved with a single query
+// GetScoreByName returns the score value for a given username and scoreboard name,
+// users who don't have a score yet have a score of zero
 func GetScoreByName(username, scoreboardName string) (float32, error) {
-	var score Score
-	userID, err := getUserIDByName(username)
+	var value float32
+	query := `SELECT COALESCE(scores.value, 0) FROM users
+		LEFT JOIN scoreboards ON scoreboards.name = $2
+		LEFT JOIN scores ON scores.user_id = users.id AND scores.scoreboard_id = scoreboards.id
+		WHERE users.username = $1`
+	err := database.Connection().Get(&value, query, username, scoreboardName)
 	if err != nil {
-		terrors.Log(err, "error getting user ID")
+		terrors.Log(err, "error getting score")
 		return -1.0, err
 	}
-	scoreboard, err := findOrCreateScoreboard(scoreboardName)
-	if err != nil {
-		terrors.Log(err, "error finding or creating scoreboard")
-		return -1.0, err
-	}
-	score, err = findOrCreateScore(userID, scoreboard.ID)
-	if err != nil {
-		terrors.Log(err, "error finding score")
-		return -1.0, err
-	}
-	return score.Value, err
+	return value, nil
 }
 
+// upsertScore adds to a score in a single statement, so concurrent
+// increments can't overwrite each other
+const upsertScore = `ON CONFLICT (user_id, scoreboard_id) DO UPDATE SET value = scores.value + EXCLUDED.value`
+
 // AddToScoreByName increases the score value for a given username and scoreboard name
-//TODO: this could be achieved with less queries
 func AddToScoreByName(username, scoreboardName string, scoreToAdd float32) error {
-	var score Score
-	userID, err := getUserIDByName(username)
-	if err != nil {
-		terrors.Log(err, "error getting userID for user")
-		return err
-	}
-	scoreboard, err := findOrCreateScoreboard(scoreboardName)
+	boardID, err := scoreboardID(scoreboardName)
 	if err != nil {
 		terrors.Log(err, "error finding or creating scoreboard")
 		return err
 	}
-	score, err = findOrCreateScore(userID, scoreboard.ID)
+	query := `INSERT INTO scores (user_id, scoreboard_id, value)
+		SELECT id, $2, $3 FROM users WHERE username = $1 ` + upsertScore
+	res, err := database.Connection().Exec(query, username, boardID, scoreToAdd)
 	if err != nil {
-		terrors.Log(err, "error finding score")
+		terrors.Log(err, "error adding to score")
 		return err
 	}
-	score.Value += scoreToAdd
-	return score.save()
-}
-
-// findOrCreateScore will look up the username in the DB, and return a Score if possible
-func findOrCreateScore(userID, scoreboardID uint16) (Score, error) {
-	score, err := findScore(userID, scoreboardID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			score, err = createScore(userID, scoreboardID)
-		} else {
-			// it was some other error
-			terrors.Log(err, "error getting score from db")
-		}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no user named %s", username)
 	}
-	return score, err
+	return nil
 }
 
-// findScore will look up the username in the DB, and return a Score if possible
-//TODO: this shouldn't be necessary, join the tables instead
-func findScore(userID, scoreboardID uint16) (Score, error) {
-	var score Score
-	query := `SELECT * FROM scores WHERE user_id=$1 AND scoreboard_id=$2`
-	err := database.Connection().Get(&score, query, userID, scoreboardID)
-	return score, err
+// AddToScoreInTx increases the score value for a given user ID and
+// scoreboard name as part of a larger transaction
+func AddToScoreInTx(tx *sqlx.Tx, userID uint16, scoreboardName string, scoreToAdd float32) error {
+	return AddToScoresInTx(tx, scoreboardName, map[uint16]float32{userID: scoreToAdd})
 }
 
-// createScore() will actually create the DB record
-func createScore(userID, scoreboardID uint16) (Score, error) {
-	var score Score
-	log.Printf("creating score user_id:%d, scoreboard_id:%d", userID, scoreboardID)
-	tx := database.Connection().MustBegin()
-	// create a new row using default value
-	_, err := tx.Exec("INSERT INTO scores (user_id, scoreboard_id) VALUES ($1, $2)", userID, scoreboardID)
-	if err != nil {
-		terrors.Log(err, "error inserting score in DB")
-		return score, err
+// AddToScores increases the scores for many users at once,
+// the increments are keyed by username
+func AddToScores(scoreboardName string, increments map[string]float32) error {
+	if len(increments) == 0 {
+		return nil
 	}
-	err = tx.Commit()
+	boardID, err := scoreboardID(scoreboardName)
 	if err != nil {
-		terrors.Log(err, "error committing score change in DB")
-		return score, err
+		terrors.Log(err, "error finding or creating scoreboard")
+		return err
 	}
-	return findScore(userID, scoreboardID)
-}
 
-// User.save() will take the given score and store it in the DB
-func (s Score) save() error {
-	if c.Conf.Verbose {
-		log.Println("saving score", s)
+	usernames := make([]string, 0, len(increments))
+	values := make([]float64, 0, len(increments))
+	for username, value := range increments {
+		usernames = append(usernames, username)
+		values = append(values, float64(value))
 	}
-	query := `UPDATE scores SET value=:value WHERE id = :id`
-	_, err := database.Connection().NamedExec(query, s)
+	query := `INSERT INTO scores (user_id, scoreboard_id, value)
+		SELECT users.id, $1, increments.value
+		FROM unnest($2::text[], $3::real[]) AS increments(username, value)
+		JOIN users ON users.username = increments.username ` + upsertScore
+	_, err = database.Connection().Exec(query, boardID, pq.Array(usernames), pq.Array(values))
 	if err != nil {
-		terrors.Log(err, "error saving score")
+		terrors.Log(err, "error adding to scores")
 	}
 	return err
 }
 
-// getUserIDByName fetches the user ID for a given username
-//TODO: this shouldn't be necessary, join the tables instead
-func getUserIDByName(username string) (uint16, error) {
-	var userID uint16
-	query := `SELECT id FROM users WHERE username=$1`
-	row := database.Connection().QueryRow(query, username)
-	err := row.Scan(&userID)
+// AddToScoresInTx increases the scores for many users at once as part
+// of a larger transaction, the increments are keyed by user ID. The
+// scoreboard is looked up (and created if needed) outside of tx, so
+// an empty board can be left behind if tx is rolled back
+func AddToScoresInTx(tx *sqlx.Tx, scoreboardName string, increments map[uint16]float32) error {
+	if len(increments) == 0 {
+		return nil
+	}
+	boardID, err := scoreboardID(scoreboardName)
 	if err != nil {
-		terrors.Log(err, "error scanning row")
+		terrors.Log(err, "error finding or creating scoreboard")
+		return err
+	}
+
+	userIDs := make([]int64, 0, len(increments))
+	values := make([]float64, 0, len(increments))
+	for userID, value := range increments {
+		userIDs = append(userIDs, int64(userID))
+		values = append(values, float64(value))
 	}
-	return userID, err
+	query := `INSERT INTO scores (user_id, scoreboard_id, value)
+		SELECT increments.user_id, $1, increments.value
+		FROM unnest($2::integer[], $3::real[]) AS increments(user_id, value) ` + upsertScore
+	_, err = tx.Exec(query, boardID, pq.Array(userIDs), pq.Array(values))
+	if err != nil {
+		terrors.Log(err, "error adding to scores")
+	}
+	return err
 }
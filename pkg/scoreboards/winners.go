@@ -0,0 +1,98 @@
+package scoreboards
+
+import (
+	"database/sql"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/miles"
+)
+
+// Winner is someone who finished near the top of a board
+// when its period ended
+type Winner struct {
+	ID             int          `db:"id" json:"-"`
+	ScoreboardID   uint16       `db:"scoreboard_id" json:"-"`
+	ScoreboardName string       `db:"scoreboard_name" json:"scoreboard"`
+	Kind           string       `db:"kind" json:"kind"`
+	PeriodStart    sql.NullTime `db:"period_start" json:"period_start"`
+	Rank           int          `db:"rank" json:"rank"`
+	UserID         uint16       `db:"user_id" json:"-"`
+	Username       string       `db:"username" json:"username"`
+	Value          float32      `db:"value" json:"value"`
+	BonusMiles     float32      `db:"bonus_miles" json:"bonus_miles"`
+	DateCreated    time.Time    `db:"date_created" json:"date_created"`
+}
+
+// Find returns the board for the kind and the period containing t,
+// it returns sql.ErrNoRows if there isn't one
+func Find(kind string, period Period, t time.Time) (Scoreboard, error) {
+	return findScoreboard(Name(kind, period, t))
+}
+
+// ArchiveWinners saves the top of the board to the winners table, and gives
+// them bonus miles (the first bonus goes to first place and so on). Boards
+// are only archived once, so the winners are only returned the first time
+func ArchiveWinners(board Scoreboard, bonuses []float32) ([]Winner, error) {
+	if c.Conf.ReadOnly {
+		return nil, &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	entries, err := board.Top(len(bonuses))
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.Connection().Beginx()
+	if err != nil {
+		terrors.Log(err, "error starting winners transaction")
+		return nil, err
+	}
+	// rollback is a no-op if the transaction was committed
+	defer tx.Rollback()
+
+	var winners []Winner
+	for i, entry := range entries {
+		var winner Winner
+		query := `INSERT INTO leaderboard_winners
+			(scoreboard_id, scoreboard_name, kind, period_start, rank, user_id, username, value, bonus_miles)
+			SELECT $1, $2, $3, $4, $5, id, username, $6, $7 FROM users WHERE username = $8
+			ON CONFLICT (scoreboard_id, user_id) DO NOTHING
+			RETURNING *`
+		err = tx.Get(&winner, query, board.ID, board.Name, board.Kind, board.PeriodStart,
+			entry.Rank, entry.Value, bonuses[i], entry.Username)
+		if err == sql.ErrNoRows {
+			// they were already archived
+			continue
+		}
+		if err != nil {
+			terrors.Log(err, "error saving leaderboard winner")
+			return nil, err
+		}
+		err = miles.CreditInTx(tx, winner.UserID, winner.BonusMiles, "leaderboard")
+		if err != nil {
+			return nil, err
+		}
+		winners = append(winners, winner)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		terrors.Log(err, "error committing leaderboard winners")
+		return nil, err
+	}
+	return winners, nil
+}
+
+// HallOfFame returns the first place winners of the kind, most recent first
+func HallOfFame(kind string, limit int) ([]Winner, error) {
+	var winners []Winner
+	query := `SELECT * FROM leaderboard_winners WHERE kind=$1 AND rank=1
+		ORDER BY period_start DESC, username LIMIT $2`
+	err := database.Connection().Select(&winners, query, kind, limit)
+	if err != nil {
+		terrors.Log(err, "error getting hall of fame")
+	}
+	return winners, err
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/analytics"
+	"github.com/adanalife/tripbot/pkg/apikeys"
+	"github.com/adanalife/tripbot/pkg/chatbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/instrumentation"
+	"github.com/adanalife/tripbot/pkg/video"
+	vlcClient "github.com/adanalife/tripbot/pkg/vlc-client"
+)
+
+// requirePermission wraps a handler so it can only be used with an API key
+// that has the given permission. Keys are passed in the Authorization header
+// (ex: "Authorization: Bearer tb_1234...")
+func requirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := apikeys.Find(apiKeyFromRequest(r))
+		if apiKey == nil {
+			// these aren't written to the DB, so someone
+			// guessing keys can't fill up the audit log
+			instrumentation.APIAuthFailures.Inc()
+			http.Error(w, "404 not found", http.StatusNotFound)
+			return
+		}
+
+		allowed := apiKey.Can(permission)
+		apikeys.Audit(apiKey, permission, r.URL.Path, r.RemoteAddr, allowed)
+		if !allowed {
+			// pretend there's nothing here
+			http.Error(w, "404 not found", http.StatusNotFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// apiKeyFromRequest pulls the API key out of the request headers
+func apiKeyFromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// apiSkipHandler skips forward a number of videos (default 1)
+func apiSkipHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := countParam(w, r)
+	if !ok {
+		return
+	}
+	err := vlcClient.Skip(n)
+	if err != nil {
+		terrors.Log(err, "error from VLC client")
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	video.GetCurrentlyPlaying()
+	fmt.Fprintf(w, "OK")
+}
+
+// apiBackHandler goes back a number of videos (default 1)
+func apiBackHandler(w http.ResponseWriter, r *http.Request) {
+	n, ok := countParam(w, r)
+	if !ok {
+		return
+	}
+	err := vlcClient.Back(n)
+	if err != nil {
+		terrors.Log(err, "error from VLC client")
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	video.GetCurrentlyPlaying()
+	fmt.Fprintf(w, "OK")
+}
+
+// apiChatHandler posts the "message" form value in chat
+func apiChatHandler(w http.ResponseWriter, r *http.Request) {
+	msg := strings.TrimSpace(r.FormValue("message"))
+	if msg == "" {
+		http.Error(w, "400 missing message", http.StatusBadRequest)
+		return
+	}
+	chatbot.Say(msg)
+	fmt.Fprintf(w, "OK")
+}
+
+// apiAnalyticsHandler returns a viewer report for the last "days" days (default 30)
+func apiAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	days, ok := daysParam(w, r)
+	if !ok {
+		return
+	}
+	to := time.Now()
+	report, err := analytics.Generate(to.AddDate(0, 0, -days), to)
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// apiGuessesHandler returns a report of the states people guess wrong
+func apiGuessesHandler(w http.ResponseWriter, r *http.Request) {
+	days, ok := daysParam(w, r)
+	if !ok {
+		return
+	}
+	to := time.Now()
+	report, err := analytics.GenerateGuessReport(to.AddDate(0, 0, -days), to)
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// writeJSON encodes v as the response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		terrors.Log(err, "unable to encode json response")
+	}
+}
+
+// daysParam reads the optional "days" query param (default 30),
+// writing an error response if it's invalid
+func daysParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("days")
+	if param == "" {
+		return 30, true
+	}
+	days, err := strconv.Atoi(param)
+	if err != nil || days < 1 {
+		http.Error(w, "400 invalid days", http.StatusBadRequest)
+		return 0, false
+	}
+	return days, true
+}
+
+// countParam reads the optional "n" query param,
+// writing an error response if it's invalid
+func countParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("n")
+	if param == "" {
+		return 1, true
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil || n < 1 {
+		http.Error(w, "400 invalid n", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adanalife/tripbot/pkg/chatbot"
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+	"github.com/adanalife/tripbot/pkg/instrumentation"
+	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
+	"github.com/adanalife/tripbot/pkg/users"
+	"github.com/logrusorgru/aurora"
+	"github.com/nicklaw5/helix"
+)
+
+// these are the headers Twitch includes with EventSub requests
+const (
+	eventSubMessageIDHeader        = "Twitch-Eventsub-Message-Id"
+	eventSubMessageTimestampHeader = "Twitch-Eventsub-Message-Timestamp"
+	eventSubMessageSignatureHeader = "Twitch-Eventsub-Message-Signature"
+	eventSubMessageTypeHeader      = "Twitch-Eventsub-Message-Type"
+)
+
+// these are the different kinds of EventSub messages
+const (
+	eventSubMessageTypeVerification = "webhook_callback_verification"
+	eventSubMessageTypeNotification = "notification"
+	eventSubMessageTypeRevocation   = "revocation"
+)
+
+// eventSubNotification is the body of every EventSub request,
+// Event is decoded later once we know the subscription type
+type eventSubNotification struct {
+	Subscription helix.EventSubSubscription `json:"subscription"`
+	Challenge    string                     `json:"challenge"`
+	Event        json.RawMessage            `json:"event"`
+}
+
+// requests with timestamps older than this are rejected, which
+// (along with seenMessages) protects us from replayed requests
+var maxEventSubMessageAge = 10 * time.Minute
+
+// allow for a little bit of clock drift between us and Twitch
+var maxEventSubClockSkew = 1 * time.Minute
+
+// Twitch will retry notifications it thinks failed, so we keep
+// track of the message IDs we've seen for this long. Anything older
+// than this will be rejected based on its timestamp anyway
+var seenMessageTTL = maxEventSubMessageAge + maxEventSubClockSkew
+
+// seenMessages contains the EventSub message IDs we've already handled
+var seenMessages = &messageCache{
+	seen:     make(map[string]time.Time),
+	handling: make(map[string]struct{}),
+}
+
+// messageCache is used to de-duplicate EventSub messages
+type messageCache struct {
+	sync.Mutex
+	seen map[string]time.Time
+	// handling are the messages we're in the middle of handling
+	handling map[string]struct{}
+}
+
+// start returns false if the message ID has already been handled (or is
+// being handled right now), otherwise it returns true and the caller
+// has to call finish once they're done with the message
+func (m *messageCache) start(id string) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	// forget about the old messages while we're here
+	now := time.Now()
+	for seenID, seenAt := range m.seen {
+		if now.Sub(seenAt) > seenMessageTTL {
+			delete(m.seen, seenID)
+		}
+	}
+
+	if _, ok := m.seen[id]; ok {
+		return false
+	}
+	if _, ok := m.handling[id]; ok {
+		return false
+	}
+	m.handling[id] = struct{}{}
+	return true
+}
+
+// finish remembers the message ID if it was handled successfully,
+// otherwise it's forgotten so we'll handle it if Twitch retries
+func (m *messageCache) finish(id string, handled bool) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.handling, id)
+	if handled {
+		m.seen[id] = time.Now()
+	}
+}
+
+// eventSubHandler receives all EventSub requests from Twitch
+func eventSubHandler(w http.ResponseWriter, r *http.Request) {
+	if c.Conf.DisableTwitchWebhooks {
+		http.Error(w, "501 not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		terrors.Log(err, "failed to read eventsub request body")
+		rejectEventSub(w, "unreadable_body", http.StatusBadRequest)
+		return
+	}
+
+	if !validEventSubSignature(r.Header, body) {
+		rejectEventSub(w, "invalid_signature", http.StatusForbidden)
+		return
+	}
+
+	if !freshEventSubTimestamp(r.Header, time.Now()) {
+		rejectEventSub(w, "stale_timestamp", http.StatusForbidden)
+		return
+	}
+
+	// twitch may send the same message more than once, and anyone
+	// who captured a request could try sending it again
+	messageID := r.Header.Get(eventSubMessageIDHeader)
+	if messageID == "" {
+		rejectEventSub(w, "missing_message_id", http.StatusBadRequest)
+		return
+	}
+	if !seenMessages.start(messageID) {
+		log.Println("ignoring duplicate eventsub message", messageID)
+		instrumentation.WebhookDuplicates.Inc()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	handled := false
+	defer func() {
+		seenMessages.finish(messageID, handled)
+	}()
+
+	var notification eventSubNotification
+	err = json.Unmarshal(body, &notification)
+	if err != nil {
+		terrors.Log(err, "failed to decode eventsub request")
+		rejectEventSub(w, "invalid_body", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Header.Get(eventSubMessageTypeHeader) {
+	case eventSubMessageTypeVerification:
+		log.Println("returning eventsub challenge for", notification.Subscription.Type)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, notification.Challenge)
+		handled = true
+
+	case eventSubMessageTypeRevocation:
+		sub := notification.Subscription
+		msg := fmt.Sprintf("eventsub subscription for %s was revoked (%s)", sub.Type, sub.Status)
+		terrors.Log(nil, msg)
+		// answer Twitch right away, resubscribing can take a bit
+		go mytwitch.EventSubRevoked(sub.Type, sub.Status)
+		w.WriteHeader(http.StatusNoContent)
+		handled = true
+
+	case eventSubMessageTypeNotification:
+		err = dispatchEventSubNotification(notification)
+		if err != nil {
+			terrors.Log(err, "failed to handle eventsub notification")
+			rejectEventSub(w, "unknown_event", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		handled = true
+
+	default:
+		rejectEventSub(w, "unknown_message_type", http.StatusBadRequest)
+	}
+}
+
+// rejectEventSub responds to a request we won't handle, and keeps
+// track of why in Prometheus so we can alert on forged callbacks
+func rejectEventSub(w http.ResponseWriter, reason string, status int) {
+	log.Println(aurora.Red("rejecting eventsub request:"), reason)
+	if cnt, err := instrumentation.WebhookRejections.GetMetricWithLabelValues(reason); err == nil {
+		cnt.Inc()
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%d %s", status, strings.ToLower(http.StatusText(status))), status)
+}
+
+// validEventSubSignature checks the HMAC signature Twitch sends with
+// every request, which is made using the secret we gave them
+func validEventSubSignature(header http.Header, body []byte) bool {
+	if c.Conf.TwitchEventSubSecret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(c.Conf.TwitchEventSubSecret))
+	mac.Write([]byte(header.Get(eventSubMessageIDHeader)))
+	mac.Write([]byte(header.Get(eventSubMessageTimestampHeader)))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get(eventSubMessageSignatureHeader)))
+}
+
+// freshEventSubTimestamp returns true if the request was sent recently
+func freshEventSubTimestamp(header http.Header, now time.Time) bool {
+	timestamp, err := time.Parse(time.RFC3339Nano, header.Get(eventSubMessageTimestampHeader))
+	if err != nil {
+		return false
+	}
+	if now.Sub(timestamp) > maxEventSubMessageAge {
+		return false
+	}
+	if timestamp.Sub(now) > maxEventSubClockSkew {
+		return false
+	}
+	return true
+}
+
+// dispatchEventSubNotification decodes the event and passes it along to the chatbot
+func dispatchEventSubNotification(notification eventSubNotification) error {
+	eventType := notification.Subscription.Type
+	log.Println("got eventsub notification for", aurora.Cyan(eventType))
+
+	switch eventType {
+	case helix.EventSubTypeChannelFollow:
+		var event helix.EventSubChannelFollowEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		username := strings.ToLower(event.UserLogin)
+		users.LoginIfNecessary(username)
+		users.NewFollower(username)
+		events.Follow(username)
+		chatbot.AnnounceNewFollower(username)
+
+	case helix.EventSubTypeChannelSubscription:
+		var event helix.EventSubChannelSubscribeEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		sub := mytwitch.Subscriber{
+			Username: strings.ToLower(event.UserLogin),
+			Tier:     mytwitch.TierFromPlan(event.Tier),
+			IsGift:   event.IsGift,
+		}
+		users.LoginIfNecessary(sub.Username)
+		users.NewSubscription(sub)
+		// gifts get announced when the gift notification comes through
+		if !sub.IsGift {
+			chatbot.AnnounceSubscriber(sub)
+		}
+
+	case helix.EventSubTypeChannelSubscriptionGift:
+		var event helix.EventSubChannelSubscriptionGiftEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		gifter := strings.ToLower(event.UserLogin)
+		if event.IsAnonymous {
+			gifter = ""
+		}
+		chatbot.AnnounceCommunityGift(gifter, event.Total)
+
+	case helix.EventSubTypeChannelSubscriptionMessage:
+		var event helix.EventSubChannelSubscriptionMessageEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		sub := mytwitch.Subscriber{
+			Username:         strings.ToLower(event.UserLogin),
+			Tier:             mytwitch.TierFromPlan(event.Tier),
+			CumulativeMonths: event.CumulativeTotal,
+		}
+		users.LoginIfNecessary(sub.Username)
+		users.NewSubscription(sub)
+		chatbot.AnnounceSubscriber(sub)
+
+	case helix.EventSubTypeChannelCheer:
+		var event helix.EventSubChannelCheerEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		username := strings.ToLower(event.UserLogin)
+		if event.IsAnonymous {
+			username = ""
+		}
+		chatbot.AnnounceCheer(username, event.Bits)
+
+	case helix.EventSubTypeChannelRaid:
+		var event helix.EventSubChannelRaidEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		chatbot.AnnounceRaid(strings.ToLower(event.FromBroadcasterUserLogin), event.Viewers)
+
+	case helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd:
+		var event helix.EventSubChannelPointsCustomRewardRedemptionEvent
+		if err := json.Unmarshal(notification.Event, &event); err != nil {
+			return err
+		}
+		username := strings.ToLower(event.UserLogin)
+		users.LoginIfNecessary(username)
+		chatbot.HandleRedemption(username, event.Reward.Title, event.UserInput)
+
+	default:
+		return fmt.Errorf("unknown eventsub type %s", eventType)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/nicklaw5/helix"
+)
+
+func TestMain(m *testing.M) {
+	terrors.Initialize(c.Conf)
+	os.Exit(m.Run())
+}
+
+const testEventSubSecret = "s3cr3t"
+
+// useEventSubSecret sets the secret used to sign EventSub requests
+func useEventSubSecret(t *testing.T, secret string) {
+	oldSecret := c.Conf.TwitchEventSubSecret
+	c.Conf.TwitchEventSubSecret = secret
+	t.Cleanup(func() {
+		c.Conf.TwitchEventSubSecret = oldSecret
+	})
+}
+
+// signEventSub signs a request the same way Twitch does
+func signEventSub(secret, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// eventSubHeader creates the headers for a signed EventSub request
+func eventSubHeader(id, messageType string, sentAt time.Time, body []byte) http.Header {
+	timestamp := sentAt.UTC().Format(time.RFC3339Nano)
+	header := http.Header{}
+	header.Set(eventSubMessageIDHeader, id)
+	header.Set(eventSubMessageTimestampHeader, timestamp)
+	header.Set(eventSubMessageTypeHeader, messageType)
+	header.Set(eventSubMessageSignatureHeader, signEventSub(testEventSubSecret, id, timestamp, body))
+	return header
+}
+
+func TestValidEventSubSignature(t *testing.T) {
+	body := []byte(`{"challenge":"abc"}`)
+	tests := []struct {
+		name     string
+		secret   string
+		header   func() http.Header
+		body     []byte
+		expected bool
+	}{
+		{
+			name:     "signed with our secret",
+			secret:   testEventSubSecret,
+			header:   func() http.Header { return eventSubHeader("1", "notification", time.Now(), body) },
+			body:     body,
+			expected: true,
+		},
+		{
+			name:     "signed with a different secret",
+			secret:   "something else",
+			header:   func() http.Header { return eventSubHeader("1", "notification", time.Now(), body) },
+			body:     body,
+			expected: false,
+		},
+		{
+			name:     "body was changed",
+			secret:   testEventSubSecret,
+			header:   func() http.Header { return eventSubHeader("1", "notification", time.Now(), body) },
+			body:     []byte(`{"challenge":"xyz"}`),
+			expected: false,
+		},
+		{
+			name:   "message ID was changed",
+			secret: testEventSubSecret,
+			header: func() http.Header {
+				header := eventSubHeader("1", "notification", time.Now(), body)
+				header.Set(eventSubMessageIDHeader, "2")
+				return header
+			},
+			body:     body,
+			expected: false,
+		},
+		{
+			name:   "no signature",
+			secret: testEventSubSecret,
+			header: func() http.Header {
+				header := eventSubHeader("1", "notification", time.Now(), body)
+				header.Del(eventSubMessageSignatureHeader)
+				return header
+			},
+			body:     body,
+			expected: false,
+		},
+		{
+			name:     "we don't have a secret",
+			secret:   "",
+			header:   func() http.Header { return eventSubHeader("1", "notification", time.Now(), body) },
+			body:     body,
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		useEventSubSecret(t, tt.secret)
+		if got := validEventSubSignature(tt.header(), tt.body); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFreshEventSubTimestamp(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		timestamp string
+		expected  bool
+	}{
+		{"just sent", now.Format(time.RFC3339Nano), true},
+		{"a few minutes old", now.Add(-5 * time.Minute).Format(time.RFC3339Nano), true},
+		{"too old", now.Add(-maxEventSubMessageAge - time.Second).Format(time.RFC3339Nano), false},
+		{"a little in the future", now.Add(30 * time.Second).Format(time.RFC3339Nano), true},
+		{"too far in the future", now.Add(maxEventSubClockSkew + time.Second).Format(time.RFC3339Nano), false},
+		{"not a timestamp", "yesterday", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(eventSubMessageTimestampHeader, tt.timestamp)
+		if got := freshEventSubTimestamp(header, now); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestMessageCache(t *testing.T) {
+	m := &messageCache{
+		seen:     make(map[string]time.Time),
+		handling: make(map[string]struct{}),
+	}
+
+	if !m.start("a") {
+		t.Fatal("a new message was treated as a duplicate")
+	}
+	if m.start("a") {
+		t.Error("a message that's being handled was handled again")
+	}
+	m.finish("a", true)
+	if m.start("a") {
+		t.Error("a handled message was handled again")
+	}
+
+	// messages that failed are handled again when Twitch retries
+	if !m.start("b") {
+		t.Fatal("a new message was treated as a duplicate")
+	}
+	m.finish("b", false)
+	if !m.start("b") {
+		t.Error("a message that failed wasn't retried")
+	}
+	m.finish("b", true)
+
+	// old messages are forgotten
+	m.seen["a"] = time.Now().Add(-seenMessageTTL - time.Second)
+	if !m.start("c") {
+		t.Fatal("a new message was treated as a duplicate")
+	}
+	if _, ok := m.seen["a"]; ok {
+		t.Error("an old message wasn't forgotten")
+	}
+}
+
+func TestEventSubHandlerVerification(t *testing.T) {
+	useEventSubSecret(t, testEventSubSecret)
+	body := []byte(`{"challenge":"pogchamp","subscription":{"type":"channel.follow","status":"webhook_callback_verification_pending"}}`)
+	id := "verification-" + time.Now().Format(time.RFC3339Nano)
+	header := eventSubHeader(id, eventSubMessageTypeVerification, time.Now(), body)
+
+	send := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/webhooks/twitch/eventsub", bytes.NewReader(body))
+		r.Header = header
+		w := httptest.NewRecorder()
+		eventSubHandler(w, r)
+		return w
+	}
+
+	w := send(header)
+	if w.Code != http.StatusOK || w.Body.String() != "pogchamp" {
+		t.Errorf("expected the challenge back, got %d %q", w.Code, w.Body.String())
+	}
+
+	// sending the same message again doesn't do anything
+	w = send(header)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected a duplicate to get an empty 204, got %d %q", w.Code, w.Body.String())
+	}
+
+	// a forged request is rejected
+	forged := eventSubHeader("forged", eventSubMessageTypeVerification, time.Now(), body)
+	forged.Set(eventSubMessageSignatureHeader, "sha256=00")
+	if w = send(forged); w.Code != http.StatusForbidden {
+		t.Errorf("expected a forged request to get a 403, got %d", w.Code)
+	}
+
+	// so is an old one
+	old := eventSubHeader("old", eventSubMessageTypeVerification, time.Now().Add(-time.Hour), body)
+	if w = send(old); w.Code != http.StatusForbidden {
+		t.Errorf("expected an old request to get a 403, got %d", w.Code)
+	}
+}
+
+func TestDispatchEventSubNotification(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		event     string
+	}{
+		{name: "unknown type", eventType: "channel.ban", event: `{}`},
+		{name: "bad follow", eventType: helix.EventSubTypeChannelFollow, event: `[]`},
+		{name: "bad subscription", eventType: helix.EventSubTypeChannelSubscription, event: `"sub"`},
+		{name: "bad gift", eventType: helix.EventSubTypeChannelSubscriptionGift, event: `{"total":"lots"}`},
+		{name: "bad cheer", eventType: helix.EventSubTypeChannelCheer, event: `{"bits":"100"}`},
+		{name: "bad raid", eventType: helix.EventSubTypeChannelRaid, event: `{"viewers":true}`},
+	}
+
+	for _, tt := range tests {
+		notification := eventSubNotification{
+			Subscription: helix.EventSubSubscription{Type: tt.eventType},
+			Event:        json.RawMessage(tt.event),
+		}
+		if err := dispatchEventSubNotification(notification); err == nil {
+			t.Errorf("%s: expected an error, got nil", tt.name)
+		}
+	}
+}
+
+func TestEventSubHandlerUnknownEvent(t *testing.T) {
+	useEventSubSecret(t, testEventSubSecret)
+	body := []byte(`{"subscription":{"type":"channel.ban","status":"enabled"},"event":{}}`)
+	id := "unknown-" + time.Now().Format(time.RFC3339Nano)
+	header := eventSubHeader(id, eventSubMessageTypeNotification, time.Now(), body)
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("POST", "/webhooks/twitch/eventsub", bytes.NewReader(body))
+		r.Header = header
+		w := httptest.NewRecorder()
+		eventSubHandler(w, r)
+		// it wasn't handled, so a retry isn't treated as a duplicate
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("attempt %d: expected an unknown event to get a 400, got %d", i+1, w.Code)
+		}
+	}
+}
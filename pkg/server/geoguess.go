@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/geoguess"
+)
+
+// geoGuessRequest is what the map page posts when someone drops a pin
+type geoGuessRequest struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// geoGuessRound is what the map page polls for
+type geoGuessRound struct {
+	Username string            `json:"username"`
+	Round    *geoGuessOpen     `json:"round"`
+	Last     *geoGuessFinished `json:"last"`
+}
+
+// geoGuessOpen is a round that's still taking guesses
+type geoGuessOpen struct {
+	ID     int       `json:"id"`
+	EndsAt time.Time `json:"ends_at"`
+}
+
+// geoGuessFinished is the most recent round that ended,
+// including where we actually were
+type geoGuessFinished struct {
+	ID      int              `json:"id"`
+	Lat     float64          `json:"lat"`
+	Lng     float64          `json:"lng"`
+	Guesses []geoguess.Guess `json:"guesses"`
+}
+
+// geoGuessPageHandler serves the map page, sending
+// people to log in with Twitch first
+func geoGuessPageHandler(w http.ResponseWriter, r *http.Request) {
+	if viewerFromRequest(r) == "" {
+		http.Redirect(w, r, "/auth/viewer", http.StatusFound)
+		return
+	}
+	http.ServeFile(w, r, "assets/geoguess.html")
+}
+
+// geoGuessRoundHandler returns the current and last round
+func geoGuessRoundHandler(w http.ResponseWriter, r *http.Request) {
+	username := viewerFromRequest(r)
+	if username == "" {
+		http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp := geoGuessRound{Username: username}
+	if round := geoguess.CurrentRound(); round != nil {
+		resp.Round = &geoGuessOpen{ID: round.ID, EndsAt: round.EndsAt()}
+	}
+	if round, guesses := geoguess.LastResults(); round != nil {
+		resp.Last = &geoGuessFinished{ID: round.ID, Lat: round.Lat, Lng: round.Lng, Guesses: guesses}
+	}
+	writeJSON(w, resp)
+}
+
+// geoGuessHandler scores a pin dropped on the map
+func geoGuessHandler(w http.ResponseWriter, r *http.Request) {
+	username := viewerFromRequest(r)
+	if username == "" {
+		http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req geoGuessRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Lat < -90 || req.Lat > 90 || req.Lng < -180 || req.Lng > 180 {
+		http.Error(w, "400 invalid location", http.StatusBadRequest)
+		return
+	}
+
+	guess, err := geoguess.MakeGuess(username, req.Lat, req.Lng)
+	switch err {
+	case nil:
+		writeJSON(w, guess)
+	case geoguess.ErrAlreadyGuessed:
+		http.Error(w, "409 you already guessed this round", http.StatusConflict)
+	case geoguess.ErrNoLocation:
+		http.Error(w, "503 we don't know where we are right now", http.StatusServiceUnavailable)
+	default:
+		terrors.Log(err, "error making geoguess")
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
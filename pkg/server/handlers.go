@@ -6,11 +6,8 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/adanalife/tripbot/pkg/chatbot"
-	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
-	"github.com/adanalife/tripbot/pkg/users"
 	"github.com/logrusorgru/aurora"
 )
 
@@ -20,111 +17,60 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK")
 }
 
-// twitch issues a request here when creating a new webhook subscription
-func webhooksTwitchHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("got webhook challenge request at", r.URL.Path)
-	// exit early if we've disabled webhooks
-	if c.Conf.DisableTwitchWebhooks {
-		http.Error(w, "501 not implemented", http.StatusNotImplemented)
+// twitchHealthHandler fails if we need to log in with OAuth again,
+// or if Twitch stopped sending us EventSub notifications
+func twitchHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if !mytwitch.UserAccessTokenHealthy() {
+		http.Error(w, "503 twitch user access token needs re-authorization", http.StatusServiceUnavailable)
 		return
 	}
-
-	challenge, ok := r.URL.Query()["hub.challenge"]
-	if !ok || len(challenge[0]) < 1 {
-		terrors.Log(nil, "something went wrong with the challenge")
-		log.Printf("%#v", r.URL.Query())
-		http.Error(w, "404 not found", http.StatusNotFound)
-		return
-	}
-	log.Println("returning challenge")
-	fmt.Fprintf(w, string(challenge[0]))
-}
-
-// user webhooks are received via POST at this url
-//TODO: we can use helix.GetWebhookTopicFromRequest() and share a webhooks URL
-func webhooksTwitchUsersFollowsHandler(w http.ResponseWriter, r *http.Request) {
-	if c.Conf.DisableTwitchWebhooks {
-		http.Error(w, "501 not implemented", http.StatusNotImplemented)
-		return
-	}
-
-	resp, err := decodeFollowWebhookResponse(r)
-	if err != nil {
-		terrors.Log(err, "error decoding follow webhook")
-		//TODO: better error
-		http.Error(w, "404 not found", http.StatusNotFound)
+	if !mytwitch.EventSubHealthy() {
+		http.Error(w, "503 twitch eventsub subscriptions were revoked", http.StatusServiceUnavailable)
 		return
 	}
-
-	for _, follower := range resp.Data.Follows {
-		username := follower.FromName
-		log.Println("got webhook for new follower:", username)
-		users.LoginIfNecessary(username)
-		// announce new follower in chat
-		chatbot.AnnounceNewFollower(username)
-	}
-
 	fmt.Fprintf(w, "OK")
 }
 
-// these are sent when users subscribe
-func webhooksTwitchSubscriptionsEventsHandler(w http.ResponseWriter, r *http.Request) {
-	if c.Conf.DisableTwitchWebhooks {
-		http.Error(w, "501 not implemented", http.StatusNotImplemented)
-		return
-	}
-
-	resp, err := decodeSubscriptionWebhookResponse(r)
-	if err != nil {
-		terrors.Log(err, "error decoding subscription webhook")
-		//TODO: better error
-		http.Error(w, "404 not found", http.StatusNotFound)
-		return
-	}
-
-	for _, event := range resp.Data.Events {
-		username := event.Subscription.UserName
-		log.Println("got webhook for new sub:", username)
-		users.LoginIfNecessary(username)
-		// announce new sub in chat
-		chatbot.AnnounceSubscriber(event.Subscription)
-	}
-
-	// update the internal subscribers list
-	mytwitch.GetSubscribers()
-
-	fmt.Fprintf(w, "OK")
+// this endpoint returns private twitch access tokens,
+// it requires an API key with the tokens:read permission
+func authTwitchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, twitchAuthJSON())
 }
 
-// this endpoint returns private twitch access tokens
-func authTwitchHandler(w http.ResponseWriter, r *http.Request) {
-	secret, ok := r.URL.Query()["auth"]
-	if !ok || !isValidSecret(secret[0]) {
-		http.Error(w, "404 not found", http.StatusNotFound)
+// authBotHandler sends the broadcaster to Twitch to authorize the bot
+func authBotHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := newOAuthState(w, botStateCookie)
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, twitchAuthJSON())
+	http.Redirect(w, r, mytwitch.BotAuthorizationURL(state), http.StatusFound)
 }
 
 // oauth callback URL, requests come from Twitch and have a special code
 // we then use that code to generate a User Access Token
 func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	codes, ok := r.URL.Query()["code"]
-
-	if !ok || len(codes[0]) < 1 {
+	if !checkOAuthState(w, r, botStateCookie) {
+		http.Error(w, "400 invalid oauth state", http.StatusBadRequest)
+		return
+	}
+	code, ok := oauthCode(r)
+	if !ok {
 		msg := "no code in response from twitch"
 		terrors.Log(errors.New("code missing"), msg)
 		//TODO: better error than StatusNotFound (404)
 		http.Error(w, msg, http.StatusNotFound)
 		return
 	}
-	code := string(codes[0])
 
 	log.Println(aurora.Cyan("successfully received token from twitch!"))
 	// use the code to generate an access token
-	mytwitch.GenerateUserAccessToken(code)
+	err := mytwitch.GenerateUserAccessToken(code)
+	if err != nil {
+		http.Error(w, "403 unable to authorize the bot with that account", http.StatusForbidden)
+		return
+	}
 
 	//TODO: return a pretty HTML page here (black background, logo, etc)
 	fmt.Fprintf(w, "Success!")
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+)
+
+// the OAuth state is saved in a cookie when someone starts logging in,
+// and the callback has to send back the same one. The bot and the
+// viewers use different cookies so one flow can't finish the other
+const (
+	botStateCookie    = "tripbot_bot_oauth_state"
+	viewerStateCookie = "tripbot_oauth_state"
+)
+
+// newOAuthState makes a random state and saves it in the given cookie
+func newOAuthState(w http.ResponseWriter, cookieName string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		terrors.Log(err, "error generating oauth state")
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   !c.Conf.IsDevelopment(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return state, nil
+}
+
+// checkOAuthState returns true if the callback has the state from the
+// cookie, the cookie is removed either way so a state is only used once
+func checkOAuthState(w http.ResponseWriter, r *http.Request, cookieName string) bool {
+	cookie, err := r.Cookie(cookieName)
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/auth", MaxAge: -1})
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return cookie.Value == r.URL.Query().Get("state")
+}
+
+// oauthCode returns the code Twitch sends to the callbacks
+func oauthCode(r *http.Request) (string, bool) {
+	code := r.URL.Query().Get("code")
+	return code, code != ""
+}
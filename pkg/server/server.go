@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/adanalife/tripbot/pkg/apikeys"
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 	"github.com/adanalife/tripbot/pkg/helpers"
+	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
 	sentrynegroni "github.com/getsentry/sentry-go/negroni"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -31,18 +33,33 @@ func Start() {
 	hp := r.PathPrefix("/health").Methods("GET", "HEAD").Subrouter()
 	hp.HandleFunc("/live", healthHandler)
 	hp.HandleFunc("/ready", healthHandler)
+	// this isn't part of /ready because we need to be
+	// reachable to go through the OAuth flow again
+	hp.HandleFunc("/twitch", twitchHealthHandler)
 
 	// webhooks endpoints
-	// note that these can be both GET and POST requests
-	wh := r.PathPrefix("/webhooks").Subrouter()
-	wh.HandleFunc("/twitch", webhooksTwitchHandler).Methods("GET")
-	wh.HandleFunc("/twitch/users/follows", webhooksTwitchUsersFollowsHandler).Methods("POST")
-	wh.HandleFunc("/twitch/subscriptions/events", webhooksTwitchSubscriptionsEventsHandler).Methods("POST")
+	r.HandleFunc(mytwitch.EventSubCallbackPath, eventSubHandler).Methods("POST")
 
 	// auth endpoints
 	auth := r.PathPrefix("/auth").Methods("GET").Subrouter()
-	auth.HandleFunc("/twitch", authTwitchHandler)
+	auth.HandleFunc("/twitch", requirePermission(apikeys.PermissionReadTokens, authTwitchHandler))
+	auth.HandleFunc("/bot", authBotHandler)
 	auth.HandleFunc("/callback", authCallbackHandler)
+	auth.HandleFunc("/viewer", authViewerHandler)
+	auth.HandleFunc("/viewer/callback", viewerCallbackHandler)
+
+	// endpoints used by supporting scripts
+	api := r.PathPrefix("/api").Methods("POST").Subrouter()
+	api.HandleFunc("/playback/skip", requirePermission(apikeys.PermissionControlPlayback, apiSkipHandler))
+	api.HandleFunc("/playback/back", requirePermission(apikeys.PermissionControlPlayback, apiBackHandler))
+	api.HandleFunc("/chat", requirePermission(apikeys.PermissionPostToChat, apiChatHandler))
+	r.HandleFunc("/api/analytics", requirePermission(apikeys.PermissionReadAnalytics, apiAnalyticsHandler)).Methods("GET")
+	r.HandleFunc("/api/analytics/guesses", requirePermission(apikeys.PermissionReadAnalytics, apiGuessesHandler)).Methods("GET")
+
+	// map guessing game, viewers log in with twitch
+	r.HandleFunc("/geoguess", geoGuessPageHandler).Methods("GET")
+	r.HandleFunc("/geoguess/round", geoGuessRoundHandler).Methods("GET")
+	r.HandleFunc("/geoguess/guess", geoGuessHandler).Methods("POST")
 
 	// static assets
 	r.HandleFunc("/favicon.ico", faviconHandler).Methods("GET")
@@ -96,8 +113,3 @@ func Start() {
 		terrors.Fatal(err, "couldn't start server")
 	}
 }
-
-// isValidSecret returns true if the given secret matches the configured one
-func isValidSecret(secret string) bool {
-	return len(secret) < 1 || secret != c.Conf.TripbotHttpAuth
-}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
+	"github.com/logrusorgru/aurora"
+)
+
+// viewers who log in with Twitch get a cookie with their (encrypted)
+// username in it, so we know who is dropping pins on the map
+const (
+	viewerCookie     = "tripbot_viewer"
+	viewerSessionDur = 7 * 24 * time.Hour
+)
+
+// authViewerHandler sends a viewer to Twitch to log in
+func authViewerHandler(w http.ResponseWriter, r *http.Request) {
+	if c.Conf.ViewerSessionKey == "" {
+		http.Error(w, "503 viewer logins are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	// the state lets us check that the callback came from
+	// a login that started here
+	state, err := newOAuthState(w, viewerStateCookie)
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, mytwitch.ViewerAuthorizationURL(state), http.StatusFound)
+}
+
+// viewerCallbackHandler finishes logging in a viewer
+func viewerCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkOAuthState(w, r, viewerStateCookie) {
+		http.Error(w, "400 invalid oauth state", http.StatusBadRequest)
+		return
+	}
+	code, ok := oauthCode(r)
+	if !ok {
+		http.Error(w, "400 no code in response from twitch", http.StatusBadRequest)
+		return
+	}
+
+	username, err := mytwitch.ViewerUsername(code)
+	if err != nil {
+		http.Error(w, "401 unable to log in with twitch", http.StatusUnauthorized)
+		return
+	}
+
+	err = setViewerCookie(w, username)
+	if err != nil {
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Println(aurora.Cyan(username), "logged in with twitch")
+	http.Redirect(w, r, "/geoguess", http.StatusFound)
+}
+
+// setViewerCookie saves the viewer's username in an encrypted cookie
+func setViewerCookie(w http.ResponseWriter, username string) error {
+	expires := time.Now().Add(viewerSessionDur)
+	value := fmt.Sprintf("%s|%d", username, expires.Unix())
+	encrypted, err := helpers.Encrypt(value, c.Conf.ViewerSessionKey)
+	if err != nil {
+		terrors.Log(err, "error encrypting viewer cookie")
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     viewerCookie,
+		Value:    encrypted,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !c.Conf.IsDevelopment(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// viewerFromRequest returns the username of the logged-in
+// viewer, or an empty string if they aren't logged in
+func viewerFromRequest(r *http.Request) string {
+	if c.Conf.ViewerSessionKey == "" {
+		return ""
+	}
+	cookie, err := r.Cookie(viewerCookie)
+	if err != nil {
+		return ""
+	}
+	value, err := helpers.Decrypt(cookie.Value, c.Conf.ViewerSessionKey)
+	if err != nil {
+		return ""
+	}
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ""
+	}
+	return parts[0]
+}
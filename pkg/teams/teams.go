@@ -0,0 +1,274 @@
+package teams
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+)
+
+// seasons line up with the monthly scoreboards, so the team totals come
+// from the members' monthly scores (minus what they had when they joined)
+const seasonPeriod = scoreboards.Monthly
+
+// GuessPointMiles is how many miles a guess point is worth
+// when adding up a team's score
+var GuessPointMiles float32 = 10
+
+// ErrNoSuchTeam is returned when joining a team that doesn't exist
+var ErrNoSuchTeam = errors.New("no such team")
+
+// ErrAlreadyJoined is returned when someone already picked a team this season
+var ErrAlreadyJoined = errors.New("already on a team this season")
+
+// Team is a group of viewers competing together
+type Team struct {
+	ID          int       `db:"id" json:"-"`
+	Name        string    `db:"name" json:"name"`
+	Title       string    `db:"title" json:"title"`
+	DateCreated time.Time `db:"date_created" json:"-"`
+}
+
+// Season is a stretch of time the teams compete over,
+// everyone has to pick a team again when a new one starts
+type Season struct {
+	ID           int           `db:"id" json:"id"`
+	StartsAt     time.Time     `db:"starts_at" json:"starts_at"`
+	EndsAt       time.Time     `db:"ends_at" json:"ends_at"`
+	WinnerTeamID sql.NullInt32 `db:"winner_team_id" json:"-"`
+	DateEnded    sql.NullTime  `db:"date_ended" json:"-"`
+	DateCreated  time.Time     `db:"date_created" json:"-"`
+}
+
+// Standing is how a team is doing in a season
+type Standing struct {
+	Team
+	Rank        int     `json:"rank"`
+	Members     int     `json:"members"`
+	Miles       float32 `json:"miles"`
+	GuessPoints float32 `json:"guess_points"`
+}
+
+// Score is the team's total, with guess points converted to miles
+func (s Standing) Score() float32 {
+	return s.Miles + s.GuessPoints*GuessPointMiles
+}
+
+// All returns every team
+func All() ([]Team, error) {
+	var teams []Team
+	err := database.Connection().Select(&teams, "SELECT * FROM teams ORDER BY name")
+	if err != nil {
+		terrors.Log(err, "error getting teams")
+	}
+	return teams, err
+}
+
+// Find returns the team matching the name, the title
+// can be used too (ex: "west" or "westcoast")
+func Find(name string) (Team, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), ""))
+	teams, err := All()
+	if err != nil {
+		return Team{}, err
+	}
+	for _, team := range teams {
+		title := strings.ToLower(strings.Join(strings.Fields(team.Title), ""))
+		if name == team.Name || name == title {
+			return team, nil
+		}
+	}
+	return Team{}, ErrNoSuchTeam
+}
+
+// CurrentSeason returns the season that's going on now, starting it if needed
+func CurrentSeason() (Season, error) {
+	start := scoreboards.PeriodStart(seasonPeriod, time.Now())
+	if !c.Conf.ReadOnly {
+		query := `INSERT INTO team_seasons (starts_at, ends_at) VALUES ($1, $2) ON CONFLICT (starts_at) DO NOTHING`
+		_, err := database.Connection().Exec(query, start, start.AddDate(0, 1, 0))
+		if err != nil {
+			terrors.Log(err, "error starting team season")
+			return Season{}, err
+		}
+	}
+	var season Season
+	err := database.Connection().Get(&season, "SELECT * FROM team_seasons WHERE starts_at=$1", start)
+	if err != nil {
+		terrors.Log(err, "error getting team season")
+	}
+	return season, err
+}
+
+// Join puts the user on the team for the current season,
+// people can only pick a team once per season
+func Join(username string, team Team) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	season, err := CurrentSeason()
+	if err != nil {
+		return err
+	}
+	milesBoard, pointsBoard := season.boards()
+	// save their scores so far, only what they earn after joining counts
+	query := `INSERT INTO team_members (season_id, team_id, user_id, miles_at_join, guess_points_at_join)
+		SELECT $1, $2, users.id,
+			COALESCE((SELECT scores.value FROM scores JOIN scoreboards ON scores.scoreboard_id = scoreboards.id
+				WHERE scoreboards.name = $4 AND scores.user_id = users.id), 0),
+			COALESCE((SELECT scores.value FROM scores JOIN scoreboards ON scores.scoreboard_id = scoreboards.id
+				WHERE scoreboards.name = $5 AND scores.user_id = users.id), 0)
+		FROM users WHERE username = $3
+		ON CONFLICT (season_id, user_id) DO NOTHING`
+	res, err := database.Connection().Exec(query, season.ID, team.ID, username, milesBoard, pointsBoard)
+	if err != nil {
+		terrors.Log(err, "error joining team")
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlreadyJoined
+	}
+	return nil
+}
+
+// TeamOf returns the team the user is on this season,
+// it returns sql.ErrNoRows if they haven't joined one
+func TeamOf(username string) (Team, error) {
+	season, err := CurrentSeason()
+	if err != nil {
+		return Team{}, err
+	}
+	var team Team
+	query := `SELECT teams.* FROM teams
+		JOIN team_members ON team_members.team_id = teams.id
+		JOIN users ON team_members.user_id = users.id
+		WHERE team_members.season_id = $1 AND users.username = $2`
+	err = database.Connection().Get(&team, query, season.ID, username)
+	if err != nil && err != sql.ErrNoRows {
+		terrors.Log(err, "error getting user's team")
+	}
+	return team, err
+}
+
+// boards returns the names of the miles and guess point
+// scoreboards that are used to score the season
+func (s Season) boards() (string, string) {
+	// the boards are named using local time
+	start := s.StartsAt.Local()
+	milesBoard := scoreboards.Name(scoreboards.KindMiles, seasonPeriod, start)
+	pointsBoard := scoreboards.Name(scoreboards.KindGuessPoints, seasonPeriod, start)
+	return milesBoard, pointsBoard
+}
+
+// Standings adds up each team's scores for the season, best team first.
+// Only the scores members earned after joining the team are counted
+func (s Season) Standings() ([]Standing, error) {
+	teams, err := All()
+	if err != nil {
+		return nil, err
+	}
+	milesBoard, pointsBoard := s.boards()
+
+	var standings []Standing
+	for _, team := range teams {
+		standing := Standing{Team: team}
+		query := `SELECT COUNT(*) AS members,
+			COALESCE(SUM(GREATEST(COALESCE(miles.value, 0) - team_members.miles_at_join, 0)), 0) AS miles,
+			COALESCE(SUM(GREATEST(COALESCE(points.value, 0) - team_members.guess_points_at_join, 0)), 0) AS guess_points
+			FROM team_members
+			LEFT JOIN scores miles ON miles.user_id = team_members.user_id
+				AND miles.scoreboard_id = (SELECT id FROM scoreboards WHERE name = $3)
+			LEFT JOIN scores points ON points.user_id = team_members.user_id
+				AND points.scoreboard_id = (SELECT id FROM scoreboards WHERE name = $4)
+			WHERE team_members.season_id = $1 AND team_members.team_id = $2`
+		err = database.Connection().QueryRowx(query, s.ID, team.ID, milesBoard, pointsBoard).
+			Scan(&standing.Members, &standing.Miles, &standing.GuessPoints)
+		if err != nil {
+			terrors.Log(err, "error adding up team scores")
+			return nil, err
+		}
+		standings = append(standings, standing)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score() > standings[j].Score()
+	})
+	// ties get the same rank
+	for i := range standings {
+		if i > 0 && standings[i].Score() == standings[i-1].Score() {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+	return standings, nil
+}
+
+// FinalStandings are the standings when a season ended
+type FinalStandings struct {
+	Season    Season
+	Standings []Standing
+}
+
+// Leaders returns the teams in first place, there's more than one if
+// they tied and none if nobody scored
+func (f FinalStandings) Leaders() []Standing {
+	var leaders []Standing
+	for _, standing := range f.Standings {
+		if standing.Rank != 1 || standing.Score() <= 0 {
+			break
+		}
+		leaders = append(leaders, standing)
+	}
+	return leaders
+}
+
+// EndSeasons picks the winners of any seasons that are over, and returns
+// the final standings for each. Seasons are only ended once, so this
+// can be run as often as we like
+func EndSeasons() ([]FinalStandings, error) {
+	if c.Conf.ReadOnly {
+		return nil, nil
+	}
+	var seasons []Season
+	query := `SELECT * FROM team_seasons WHERE ends_at <= $1 AND date_ended IS NULL ORDER BY starts_at`
+	err := database.Connection().Select(&seasons, query, time.Now())
+	if err != nil {
+		terrors.Log(err, "error getting finished team seasons")
+		return nil, err
+	}
+
+	var ended []FinalStandings
+	for _, season := range seasons {
+		standings, err := season.Standings()
+		if err != nil {
+			return ended, err
+		}
+		// nobody wins a season where nobody scored, or one that ended
+		// in a tie (the tied teams are the Leaders() of the standings)
+		var winner sql.NullInt32
+		leaders := FinalStandings{Standings: standings}.Leaders()
+		if len(leaders) == 1 {
+			winner = sql.NullInt32{Int32: int32(leaders[0].ID), Valid: true}
+		}
+		query := `UPDATE team_seasons SET winner_team_id=$1, date_ended=$2
+			WHERE id=$3 AND date_ended IS NULL RETURNING *`
+		err = database.Connection().Get(&season, query, winner, time.Now(), season.ID)
+		if err == sql.ErrNoRows {
+			// it was ended somewhere else
+			continue
+		}
+		if err != nil {
+			terrors.Log(err, "error ending team season")
+			return ended, err
+		}
+		ended = append(ended, FinalStandings{Season: season, Standings: standings})
+	}
+	return ended, nil
+}
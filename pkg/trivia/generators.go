@@ -0,0 +1,108 @@
+package trivia
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/video"
+)
+
+// errCantGenerate is returned when the current video doesn't
+// have what a generator needs (ex: no GPS coords)
+var errCantGenerate = errors.New("can't generate question for this video")
+
+// a generator makes a question about the currently-playing video
+type generator func(vid video.Video, lat, lng float64) (Question, error)
+
+var generators = []generator{
+	capitalQuestion,
+	sunsetQuestion,
+	regionQuestion,
+	timeZoneQuestion,
+	yearQuestion,
+}
+
+// generateQuestion makes a question about the currently-playing video
+func generateQuestion() (Question, error) {
+	vid := video.CurrentlyPlaying
+	if vid.Flagged {
+		// use the location from the next vid
+		vid = vid.Next()
+	}
+	lat, lng, err := vid.Location()
+	if err != nil {
+		return Question{}, err
+	}
+
+	// try them in a random order until one works
+	for _, i := range rand.Perm(len(generators)) {
+		q, err := generators[i](vid, lat, lng)
+		if err == nil {
+			return q, nil
+		}
+	}
+	return Question{}, errCantGenerate
+}
+
+func capitalQuestion(vid video.Video, lat, lng float64) (Question, error) {
+	capital := helpers.StateCapital(vid.State)
+	if capital == "" {
+		return Question{}, errCantGenerate
+	}
+	answers := []string{capital}
+	if strings.HasPrefix(capital, "Saint ") {
+		answers = append(answers, "St "+strings.TrimPrefix(capital, "Saint "))
+	}
+	return Question{
+		Text:    "What's the capital of the state we're in?",
+		Answers: answers,
+	}, nil
+}
+
+func sunsetQuestion(vid video.Video, lat, lng float64) (Question, error) {
+	answer := "before"
+	if helpers.AfterSunset(vid.DateFilmed, lat, lng) {
+		answer = "after"
+	}
+	return Question{
+		Text:    "Is it before or after sunset right now?",
+		Answers: []string{answer, answer + " sunset"},
+	}, nil
+}
+
+func regionQuestion(vid video.Video, lat, lng float64) (Question, error) {
+	region := helpers.StateRegion(vid.State)
+	if region == "" {
+		return Question{}, errCantGenerate
+	}
+	return Question{
+		Text:    "Which region of the US are we in? (Northeast, Midwest, South, or West)",
+		Answers: []string{region},
+	}, nil
+}
+
+func timeZoneQuestion(vid video.Video, lat, lng float64) (Question, error) {
+	zone := helpers.TimeZoneName(lat, lng)
+	if zone == "" {
+		return Question{}, errCantGenerate
+	}
+	return Question{
+		Text:    "What time zone are we in?",
+		Answers: []string{zone, zone + " time"},
+	}, nil
+}
+
+func yearQuestion(vid video.Video, lat, lng float64) (Question, error) {
+	if vid.DateFilmed.IsZero() {
+		return Question{}, errCantGenerate
+	}
+	return Question{
+		Text:    "What year was this footage filmed?",
+		Answers: []string{strconv.Itoa(vid.DateFilmed.Year())},
+		// this one is harder to guess
+		Points: 2,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package trivia
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/logrusorgru/aurora"
+)
+
+// AnswerWindow is how long people have to answer a question
+var AnswerWindow = 60 * time.Second
+
+// AnswerCooldown is how long someone has to wait after two quick wrong
+// answers in a row, so they can't get it right by spamming every
+// possible answer. A single chat message never triggers it
+var AnswerCooldown = 10 * time.Second
+
+// defaultPoints is what a question is worth if it doesn't say
+const defaultPoints = 1.0
+
+// ErrQuestionOpen is returned when asking a question before the last one is done
+var ErrQuestionOpen = errors.New("a trivia question is already open")
+
+// ErrNoQuestions is returned when there is nothing to ask
+var ErrNoQuestions = errors.New("no trivia questions available")
+
+// Question is a trivia question, any of the answers are accepted
+type Question struct {
+	Text    string   `json:"question"`
+	Answers []string `json:"answers"`
+	Points  float32  `json:"points"`
+}
+
+// bank holds the questions loaded from the question file
+var bank []Question
+
+// current is the question that's open for answers (if any)
+var current *Question
+
+// attempt tracks someone's wrong answers to the current question
+type attempt struct {
+	last          time.Time
+	cooldownUntil time.Time
+}
+
+// attempts are the wrong answers to the current question, keyed by username
+var attempts = make(map[string]attempt)
+var currentMutex sync.Mutex
+
+// addPoints is used to award points, it's a var so tests can replace it
+var addPoints = scoreboards.AddToPeriods
+
+// LoadBank loads the question bank from a JSON file,
+// the generated questions are used if there isn't one
+func LoadBank(path string) error {
+	if path == "" {
+		log.Println("no trivia file configured, only using generated questions")
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		terrors.Log(err, "error reading trivia file")
+		return err
+	}
+
+	var questions []Question
+	err = json.Unmarshal(data, &questions)
+	if err != nil {
+		terrors.Log(err, "error parsing trivia file")
+		return err
+	}
+
+	// skip questions nobody could answer
+	bank = nil
+	for _, q := range questions {
+		if q.Text == "" || len(q.Answers) == 0 {
+			continue
+		}
+		bank = append(bank, q)
+	}
+	log.Println("loaded", aurora.Cyan(len(bank)), "trivia questions")
+	return nil
+}
+
+// Ask opens a new question for answers, expired is called
+// if nobody gets it right before the window closes
+func Ask(expired func(Question)) (Question, error) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+	if current != nil {
+		return Question{}, ErrQuestionOpen
+	}
+
+	q, err := pickQuestion()
+	if err != nil {
+		return Question{}, err
+	}
+	if q.Points == 0 {
+		q.Points = defaultPoints
+	}
+	current = &q
+	attempts = make(map[string]attempt)
+
+	time.AfterFunc(AnswerWindow, func() {
+		currentMutex.Lock()
+		// make sure nobody answered it already
+		unanswered := current == &q
+		if unanswered {
+			current = nil
+		}
+		currentMutex.Unlock()
+		if unanswered && expired != nil {
+			expired(q)
+		}
+	})
+	return q, nil
+}
+
+// Current returns the question that's open for answers, if any
+func Current() (Question, bool) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+	if current == nil {
+		return Question{}, false
+	}
+	return *current, true
+}
+
+// Answer checks a chat message against the open question, the first
+// person to get it right closes the question and is awarded the points.
+// Someone who gets it wrong twice within AnswerCooldown has the rest of
+// their messages ignored until the cooldown is over
+func Answer(username, message string) (Question, bool) {
+	currentMutex.Lock()
+	if current == nil {
+		currentMutex.Unlock()
+		return Question{}, false
+	}
+	now := time.Now()
+	a := attempts[username]
+	if now.Before(a.cooldownUntil) {
+		currentMutex.Unlock()
+		return Question{}, false
+	}
+	if !current.matches(message) {
+		// a wrong answer right after another one starts the cooldown
+		if now.Sub(a.last) < AnswerCooldown {
+			a.cooldownUntil = now.Add(AnswerCooldown)
+		}
+		a.last = now
+		attempts[username] = a
+		currentMutex.Unlock()
+		return Question{}, false
+	}
+	q := *current
+	current = nil
+	currentMutex.Unlock()
+
+	err := addPoints(username, scoreboards.KindTrivia, q.Points, scoreboards.Monthly, scoreboards.AllTime)
+	if err != nil {
+		terrors.Log(err, "error adding trivia points")
+	}
+	return q, true
+}
+
+// matches returns true if the message is one of the answers
+func (q Question) matches(message string) bool {
+	message = normalize(message)
+	for _, answer := range q.Answers {
+		if message == normalize(answer) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickQuestion chooses a random question, either generated
+// from the current video or from the question bank
+func pickQuestion() (Question, error) {
+	if len(bank) == 0 || rand.Intn(2) == 0 {
+		q, err := generateQuestion()
+		if err == nil {
+			return q, nil
+		}
+		// fall back to the bank if we couldn't make one
+	}
+	if len(bank) == 0 {
+		return Question{}, ErrNoQuestions
+	}
+	return bank[rand.Intn(len(bank))], nil
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9 ]+`)
+
+// normalize makes answers easier to compare (ex: "St. Paul!" is "st paul")
+func normalize(s string) string {
+	s = nonAlphanumeric.ReplaceAllString(strings.ToLower(s), "")
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.TrimPrefix(s, "the ")
+}
@@ -0,0 +1,114 @@
+package trivia
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+)
+
+func TestMain(m *testing.M) {
+	terrors.Initialize(c.Conf)
+	os.Exit(m.Run())
+}
+
+// fakeQuestion opens a question without starting the answer window
+func fakeQuestion(t *testing.T, answers ...string) *float32 {
+	var points float32
+	oldAddPoints := addPoints
+	addPoints = func(username, kind string, score float32, periods ...scoreboards.Period) error {
+		points += score
+		return nil
+	}
+	current = &Question{Text: "where are we?", Answers: answers, Points: 2}
+	attempts = make(map[string]attempt)
+	t.Cleanup(func() {
+		addPoints = oldAddPoints
+		current = nil
+	})
+	return &points
+}
+
+func TestAnswer(t *testing.T) {
+	points := fakeQuestion(t, "St. Paul")
+
+	if _, correct := Answer("alice", "what a view"); correct {
+		t.Errorf("expected chatting not to answer the question")
+	}
+	// chatting first shouldn't stop alice from answering
+	q, correct := Answer("alice", "st paul!")
+	if !correct {
+		t.Errorf("expected alice to get it right after chatting")
+	}
+	if q.Text != "where are we?" || *points != 2 {
+		t.Errorf("expected alice to get 2 points, got %v", *points)
+	}
+
+	// the question is closed now
+	if _, correct := Answer("bob", "st paul"); correct {
+		t.Errorf("expected the question to be closed")
+	}
+}
+
+func TestAnswerCooldown(t *testing.T) {
+	fakeQuestion(t, "Denver")
+
+	Answer("alice", "boulder")
+	Answer("alice", "aspen")
+	if _, correct := Answer("alice", "denver"); correct {
+		t.Errorf("expected alice to be cooling down after two wrong answers")
+	}
+
+	// other people can still answer
+	if _, correct := Answer("bob", "denver"); !correct {
+		t.Errorf("expected bob to get it right")
+	}
+}
+
+func TestAnswerCooldownEnds(t *testing.T) {
+	fakeQuestion(t, "Denver")
+
+	Answer("alice", "boulder")
+	Answer("alice", "aspen")
+
+	// pretend the cooldown started a while ago
+	a := attempts["alice"]
+	a.last = a.last.Add(-2 * AnswerCooldown)
+	a.cooldownUntil = a.cooldownUntil.Add(-2 * AnswerCooldown)
+	attempts["alice"] = a
+
+	if _, correct := Answer("alice", "denver"); !correct {
+		t.Errorf("expected alice to be able to answer after the cooldown")
+	}
+}
+
+func TestAnswerSlowGuesses(t *testing.T) {
+	fakeQuestion(t, "Denver")
+
+	// a wrong answer long after the last one doesn't start the cooldown
+	attempts["alice"] = attempt{last: time.Now().Add(-2 * AnswerCooldown)}
+	Answer("alice", "boulder")
+	if !attempts["alice"].cooldownUntil.IsZero() {
+		t.Errorf("expected spaced out guesses not to start the cooldown")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "St. Paul!", expected: "st paul"},
+		{input: "  The   Grand Canyon ", expected: "grand canyon"},
+		{input: "1999", expected: "1999"},
+	}
+
+	for _, tt := range tests {
+		if got := normalize(tt.input); got != tt.expected {
+			t.Errorf("normalize(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
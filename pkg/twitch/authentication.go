@@ -1,8 +1,14 @@
 package twitch
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
@@ -20,9 +26,36 @@ var ClientSecret string
 var AuthToken string
 var AppAccessToken string
 
-// these are used to authenticate requests that require user permissions
+// these are used to authenticate requests that require user permissions,
+// use CurrentUserAccessToken() instead of reading them directly
 var UserAccessToken string
 var UserRefreshToken string
+var UserAccessTokenExpiry time.Time
+
+// userAccessTokenFailing is true when we couldn't refresh the
+// user access token, and someone has to log in with OAuth again
+var userAccessTokenFailing bool
+
+// tokenMutex protects the user access token variables
+var tokenMutex sync.Mutex
+
+// refreshMutex is held while we check, refresh, and save the user
+// access token, so the crons can't refresh it at the same time
+var refreshMutex sync.Mutex
+
+// we refresh the user access token when it's this close to expiring
+var refreshWindow = 15 * time.Minute
+
+// Scopes are the permissions we ask for when authenticating with Twitch
+//TODO: move to configs lib
+var Scopes = []string{
+	"openid",
+	"user:edit:broadcast",
+	"channel:read:subscriptions",
+	"channel:read:redemptions",
+	"bits:read",
+	"moderator:read:chatters",
+}
 
 // init makes sure we have all of the require ENV vars
 func init() {
@@ -58,11 +91,8 @@ func Client() (*helix.Client, error) {
 		terrors.Log(err, "error creating client")
 	}
 
-	//TODO: move to configs lib
-	//TODO: revisit that we need all of these
-	scopes := []string{"openid", "user:edit:broadcast", "channel:read:subscriptions"}
 	// set the AppAccessToken
-	resp, err := client.RequestAppAccessToken(scopes)
+	resp, err := client.RequestAppAccessToken(Scopes)
 	if err != nil {
 		terrors.Log(err, "error getting app access token from twitch")
 	}
@@ -77,51 +107,238 @@ func Client() (*helix.Client, error) {
 
 // GenerateUserAccessToken sends a code to Twitch to generate a
 // user access token. This is called by the web server after
-// going through the OAuth flow
-func GenerateUserAccessToken(code string) {
+// going through the OAuth flow. The token is only used if it
+// belongs to the channel and has the scopes we asked for
+func GenerateUserAccessToken(code string) error {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
 	resp, err := currentTwitchClient.RequestUserAccessToken(code)
 	if err != nil {
 		terrors.Log(err, "error getting user access token from twitch")
-		return
+		return err
+	}
+	if resp.Data.AccessToken == "" {
+		return errors.New("twitch refused code: " + resp.ErrorMessage)
 	}
 
-	UserAccessToken = resp.Data.AccessToken
-	UserRefreshToken = resp.Data.RefreshToken
+	err = checkUserAccessToken(resp.Data.AccessToken)
+	if err != nil {
+		log.Println(aurora.Red("refusing user access token:"), err)
+		return err
+	}
 
-	// update the current client with the access token
-	currentTwitchClient.SetUserAccessToken(UserAccessToken)
+	expiresAt := time.Now().Add(time.Duration(resp.Data.ExpiresIn) * time.Second)
+	setUserAccessToken(resp.Data.AccessToken, resp.Data.RefreshToken, expiresAt)
+	saveUserAccessToken()
+
+	log.Println(aurora.Cyan("successfully generated user access token"))
+	return nil
+}
+
+// checkUserAccessToken makes sure a new token was made by the channel
+// account with exactly the scopes we asked for, so someone logging in
+// with their own account can't replace the bot's token
+func checkUserAccessToken(accessToken string) error {
+	// use a separate client, ValidateToken sets the token on the client
+	client, err := helix.NewClient(&helix.Options{ClientID: ClientID})
+	if err != nil {
+		terrors.Log(err, "error creating client")
+		return err
+	}
+	valid, validation, err := client.ValidateToken(accessToken)
+	if err != nil {
+		terrors.Log(err, "error validating new user access token")
+		return err
+	}
+	if !valid {
+		return errors.New("user access token is not valid")
+	}
+	if !strings.EqualFold(validation.Data.Login, c.Conf.ChannelName) {
+		return fmt.Errorf("user access token is for %s, not %s", validation.Data.Login, c.Conf.ChannelName)
+	}
+	scopes := make([]string, len(validation.Data.Scopes))
+	copy(scopes, validation.Data.Scopes)
+	sort.Strings(scopes)
+	if strings.Join(scopes, " ") != scopesKey() {
+		return fmt.Errorf("user access token has scopes %v, we asked for %v", validation.Data.Scopes, Scopes)
+	}
+	return nil
+}
+
+// LoadUserAccessToken uses the token saved in the DB (if there is one)
+// so we don't have to go through the OAuth flow every time we restart.
+// It returns true if we ended up with a working token
+func LoadUserAccessToken() bool {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
+	if !loadUserAccessToken() {
+		return false
+	}
+	expiry := userAccessTokenExpiry()
+	log.Println("loaded saved user access token, it expires", expiry.Format(time.RFC3339))
+
+	// make sure the token still works, it might have been revoked
+	// or expired while we were down
+	if time.Until(expiry) > refreshWindow && validUserAccessToken() {
+		return true
+	}
+	return refreshUserAccessToken()
 }
 
 // RefreshUserAccessToken makes a call to Twitch to generate a
 // fresh user access token. It requires a UserRefreshToken to be
-// set already.
-func RefreshUserAccessToken() {
+// set already. It returns true if the refresh worked
+func RefreshUserAccessToken() bool {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+	return refreshUserAccessToken()
+}
+
+// refreshUserAccessToken does the refresh, refreshMutex must be held
+func refreshUserAccessToken() bool {
+	accessToken, refreshToken := userTokens()
 	// check to see if we have the required tokens to work with
-	if UserRefreshToken == "" || UserAccessToken == "" {
+	if refreshToken == "" || accessToken == "" {
 		log.Println("no user access token was present, did you log in with OAuth?")
-		authURL := currentTwitchClient.GetAuthorizationURL(&helix.AuthorizationURLParams{
-			//TODO: move to configs lib
-			Scopes:       []string{"openid", "user:edit:broadcast", "channel:read:subscriptions"},
-			ResponseType: "code",
-		})
-		log.Println(aurora.Blue(authURL).Underline())
-		// send a text message cause some features won't work
-		// without a user access token
-		helpers.SendSMS("refreshing user access token failed!")
-		return
+		userAccessTokenFailed("no user access token present")
+		return false
 	}
 
-	resp, err := currentTwitchClient.RefreshUserAccessToken(UserRefreshToken)
+	resp, err := currentTwitchClient.RefreshUserAccessToken(refreshToken)
 	if err != nil {
 		terrors.Log(err, "error refreshing user access token")
+		userAccessTokenFailed("refreshing user access token failed!")
+		return false
+	}
+	if resp.Data.AccessToken == "" {
+		// this usually means the refresh token was revoked
+		log.Println(aurora.Red("twitch refused to refresh user access token:"), resp.ErrorMessage)
+		userAccessTokenFailed("refreshing user access token failed!")
+		return false
+	}
+
+	expiresAt := time.Now().Add(time.Duration(resp.Data.ExpiresIn) * time.Second)
+	setUserAccessToken(resp.Data.AccessToken, resp.Data.RefreshToken, expiresAt)
+	saveUserAccessToken()
+
+	log.Println(aurora.Cyan("successfully updated user access token"))
+	return true
+}
+
+// RefreshUserAccessTokenIfNecessary refreshes the user access token
+// if it's about to expire. It is run regularly by a cron job
+func RefreshUserAccessTokenIfNecessary() {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
+	if CurrentUserAccessToken() != "" && time.Until(userAccessTokenExpiry()) > refreshWindow {
+		return
+	}
+	refreshUserAccessToken()
+}
+
+// ValidateUserAccessToken checks the token with Twitch (which they
+// require apps to do hourly) and refreshes it if it stopped working
+func ValidateUserAccessToken() {
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
+	if CurrentUserAccessToken() == "" {
+		userAccessTokenFailed("no user access token present")
 		return
 	}
+	if validUserAccessToken() {
+		return
+	}
+	log.Println(aurora.Yellow("user access token is no longer valid, refreshing"))
+	refreshUserAccessToken()
+}
 
-	UserAccessToken = resp.Data.AccessToken
-	UserRefreshToken = resp.Data.RefreshToken
+// CurrentUserAccessToken returns the user access token,
+// or an empty string if we don't have one
+func CurrentUserAccessToken() string {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	return UserAccessToken
+}
+
+// userTokens returns the user access and refresh tokens
+func userTokens() (string, string) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	return UserAccessToken, UserRefreshToken
+}
+
+// userAccessTokenExpiry returns when the user access token expires
+func userAccessTokenExpiry() time.Time {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	return UserAccessTokenExpiry
+}
+
+// UserAccessTokenHealthy returns false if we need someone
+// to go through the OAuth flow again
+func UserAccessTokenHealthy() bool {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+	return UserAccessToken != "" && !userAccessTokenFailing
+}
+
+// AuthorizationURL is where you go to (re-)authorize the bot, the
+// web server sets up the OAuth state and sends you on to Twitch
+func AuthorizationURL() string {
+	return c.Conf.ExternalURL + "/auth/bot"
+}
+
+// BotAuthorizationURL is the Twitch page that authorizes the bot,
+// the state is checked when Twitch sends us back
+func BotAuthorizationURL(state string) string {
+	return currentTwitchClient.GetAuthorizationURL(&helix.AuthorizationURLParams{
+		Scopes:       Scopes,
+		ResponseType: "code",
+		State:        state,
+	})
+}
+
+// validUserAccessToken asks Twitch if the current token is valid
+func validUserAccessToken() bool {
+	valid, _, err := currentTwitchClient.ValidateToken(CurrentUserAccessToken())
+	if err != nil {
+		terrors.Log(err, "error validating user access token")
+		return false
+	}
+	return valid
+}
+
+// setUserAccessToken updates the tokens and the shared client
+func setUserAccessToken(accessToken, refreshToken string, expiresAt time.Time) {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	UserAccessToken = accessToken
+	UserRefreshToken = refreshToken
+	UserAccessTokenExpiry = expiresAt
+	userAccessTokenFailing = false
 
 	// update the current client with the new access token
 	currentTwitchClient.SetUserAccessToken(UserAccessToken)
+}
 
-	log.Println(aurora.Cyan("successfully updated user access token"))
+// userAccessTokenFailed lets us know that someone needs to re-auth,
+// we only send a text the first time so we don't get spammed
+func userAccessTokenFailed(msg string) {
+	tokenMutex.Lock()
+	alreadyFailing := userAccessTokenFailing
+	userAccessTokenFailing = true
+	tokenMutex.Unlock()
+
+	if alreadyFailing {
+		return
+	}
+	log.Println(aurora.Blue(AuthorizationURL()).Underline())
+	// send a text message cause some features won't work
+	// without a user access token
+	helpers.SendSMS(msg)
 }
@@ -0,0 +1,158 @@
+package twitch
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/logrusorgru/aurora"
+	"github.com/nicklaw5/helix"
+)
+
+// EventSubCallbackPath is where Twitch will send EventSub notifications
+const EventSubCallbackPath = "/webhooks/twitch/eventsub"
+
+// eventSubTypes are the EventSub events we want to be notified about
+var eventSubTypes = []string{
+	helix.EventSubTypeChannelFollow,
+	helix.EventSubTypeChannelSubscription,
+	helix.EventSubTypeChannelSubscriptionGift,
+	helix.EventSubTypeChannelSubscriptionMessage,
+	helix.EventSubTypeChannelCheer,
+	helix.EventSubTypeChannelRaid,
+	helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd,
+}
+
+// affiliateEventSubTypes are only available to affiliates, and since
+// the staging account isn't one, we only use these on production
+var affiliateEventSubTypes = map[string]bool{
+	helix.EventSubTypeChannelSubscription:                    true,
+	helix.EventSubTypeChannelSubscriptionGift:                true,
+	helix.EventSubTypeChannelSubscriptionMessage:             true,
+	helix.EventSubTypeChannelCheer:                           true,
+	helix.EventSubTypeChannelPointsCustomRewardRedemptionAdd: true,
+}
+
+// revokedEventSubs are the EventSub types Twitch revoked that we
+// haven't been able to subscribe to again, keyed by type
+var revokedEventSubs = make(map[string]string)
+var revokedEventSubsMutex sync.Mutex
+
+// EventSubRevoked is called when Twitch revokes one of our subscriptions
+// (ex: too many failed notifications), we try to subscribe again and
+// the health check fails until that works
+func EventSubRevoked(eventType, status string) {
+	revokedEventSubsMutex.Lock()
+	revokedEventSubs[eventType] = status
+	revokedEventSubsMutex.Unlock()
+
+	if !subscribeToEventSub(eventType) {
+		terrors.Log(nil, fmt.Sprintf("unable to resubscribe to revoked eventsub subscription for %s (%s)", eventType, status))
+	}
+}
+
+// EventSubHealthy returns false if any of our subscriptions
+// were revoked and couldn't be created again
+func EventSubHealthy() bool {
+	revokedEventSubsMutex.Lock()
+	defer revokedEventSubsMutex.Unlock()
+	return len(revokedEventSubs) == 0
+}
+
+// UpdateEventSubSubscriptions makes sure we are subscribed to all of
+// the EventSub events we care about
+func UpdateEventSubSubscriptions() {
+	if c.Conf.DisableTwitchWebhooks {
+		return
+	}
+	if c.Conf.TwitchEventSubSecret == "" {
+		terrors.Log(nil, "TWITCH_EVENTSUB_SECRET is not set, not subscribing to EventSub")
+		return
+	}
+	if ChannelID == "" {
+		ChannelID = getChannelID(c.Conf.ChannelName)
+	}
+
+	existing := existingEventSubSubscriptions()
+	for _, eventType := range eventSubTypes {
+		if affiliateEventSubTypes[eventType] && !c.Conf.IsProduction() {
+			continue
+		}
+		if existing[eventType] {
+			continue
+		}
+		subscribeToEventSub(eventType)
+	}
+}
+
+// existingEventSubSubscriptions returns the types of the EventSub
+// subscriptions that are already working
+func existingEventSubSubscriptions() map[string]bool {
+	existing := make(map[string]bool)
+	resp, err := currentTwitchClient.GetEventSubSubscriptions(&helix.EventSubSubscriptionsParams{})
+	if err != nil {
+		terrors.Log(err, "failed to get eventsub subscriptions")
+		return existing
+	}
+
+	for _, sub := range resp.Data.EventSubSubscriptions {
+		// twitch keeps around failed subscriptions, so clean those up
+		if sub.Status != helix.EventSubStatusEnabled && sub.Status != helix.EventSubStatusPending {
+			log.Println("removing", aurora.Red(sub.Status), "eventsub subscription for", sub.Type)
+			RemoveEventSubSubscription(sub.ID)
+			continue
+		}
+		existing[sub.Type] = true
+	}
+
+	if c.Conf.Verbose {
+		spew.Dump(resp.Data.EventSubSubscriptions)
+	}
+	return existing
+}
+
+// subscribeToEventSub creates a new EventSub subscription,
+// it returns true if it worked
+func subscribeToEventSub(eventType string) bool {
+	condition := helix.EventSubCondition{BroadcasterUserID: ChannelID}
+	// raids are the only event we use with a different condition
+	if eventType == helix.EventSubTypeChannelRaid {
+		condition = helix.EventSubCondition{ToBroadcasterUserID: ChannelID}
+	}
+
+	resp, err := currentTwitchClient.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:      eventType,
+		Version:   "1",
+		Condition: condition,
+		Transport: helix.EventSubTransport{
+			Method:   "webhook",
+			Callback: c.Conf.ExternalURL + EventSubCallbackPath,
+			Secret:   c.Conf.TwitchEventSubSecret,
+		},
+	})
+	if err != nil {
+		terrors.Log(err, "failed to create eventsub subscription for "+eventType)
+		return false
+	}
+	if resp.ErrorMessage != "" {
+		terrors.Log(nil, "failed to create eventsub subscription for "+eventType+": "+resp.ErrorMessage)
+		return false
+	}
+	log.Println("created eventsub subscription for", aurora.Cyan(eventType))
+
+	revokedEventSubsMutex.Lock()
+	delete(revokedEventSubs, eventType)
+	revokedEventSubsMutex.Unlock()
+	return true
+}
+
+// RemoveEventSubSubscription deletes an EventSub subscription
+func RemoveEventSubSubscription(id string) {
+	_, err := currentTwitchClient.RemoveEventSubSubscription(id)
+	if err != nil {
+		terrors.Log(err, "failed to remove eventsub subscription")
+	}
+}
@@ -0,0 +1,19 @@
+package twitch
+
+import "testing"
+
+func TestEventSubHealthy(t *testing.T) {
+	t.Cleanup(func() {
+		revokedEventSubs = make(map[string]string)
+	})
+
+	if !EventSubHealthy() {
+		t.Errorf("expected eventsub to be healthy with nothing revoked")
+	}
+
+	// a revocation we couldn't recover from
+	revokedEventSubs["channel.follow"] = "authorization_revoked"
+	if EventSubHealthy() {
+		t.Errorf("expected eventsub to be unhealthy after a revocation")
+	}
+}
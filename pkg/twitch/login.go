@@ -0,0 +1,68 @@
+package twitch
+
+import (
+	"errors"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/nicklaw5/helix"
+)
+
+// viewerClient creates a client for a viewer logging in with Twitch. Each
+// login gets its own client so viewer tokens never end up on the shared
+// client (or on each other's, ValidateToken sets the token on the client)
+func viewerClient() (*helix.Client, error) {
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		// this is set at https://dev.twitch.tv/console/apps (viewers
+		// have their own callback, separate from the bot's)
+		RedirectURI: c.Conf.ExternalURL + "/auth/viewer/callback",
+	})
+	if err != nil {
+		terrors.Log(err, "error creating viewer client")
+		return nil, err
+	}
+	return client, nil
+}
+
+// ViewerAuthorizationURL is where viewers go to log in with Twitch,
+// we don't ask for any scopes because we only need to know who they are
+func ViewerAuthorizationURL(state string) string {
+	client, err := viewerClient()
+	if err != nil {
+		return ""
+	}
+	return client.GetAuthorizationURL(&helix.AuthorizationURLParams{
+		Scopes:       []string{},
+		ResponseType: "code",
+		State:        state,
+	})
+}
+
+// ViewerUsername trades the code Twitch gave a viewer for an
+// access token, and uses it to look up their username
+func ViewerUsername(code string) (string, error) {
+	client, err := viewerClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.RequestUserAccessToken(code)
+	if err != nil {
+		terrors.Log(err, "error getting viewer access token from twitch")
+		return "", err
+	}
+	if resp.Data.AccessToken == "" {
+		return "", errors.New("twitch refused viewer code: " + resp.ErrorMessage)
+	}
+
+	valid, validation, err := client.ValidateToken(resp.Data.AccessToken)
+	if err != nil {
+		terrors.Log(err, "error validating viewer access token")
+		return "", err
+	}
+	if !valid || validation.Data.Login == "" {
+		return "", errors.New("viewer access token is not valid")
+	}
+	return validation.Data.Login, nil
+}
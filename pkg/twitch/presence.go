@@ -0,0 +1,102 @@
+package twitch
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/logrusorgru/aurora"
+)
+
+// these are the different values for PRESENCE_SOURCE
+const (
+	PresenceSourceHelix = "helix"
+	PresenceSourceIRC   = "irc"
+	PresenceSourceFake  = "fake"
+)
+
+// PresenceSource is somewhere we can find out who is currently in chat
+type PresenceSource interface {
+	// Chatters returns the (lowercase) usernames of everyone in chat
+	Chatters() (map[string]struct{}, error)
+}
+
+// IRC keeps track of who is in chat based on the JOIN and PART
+// messages the bot receives. It's always kept up to date (even when
+// it isn't the CurrentPresenceSource) so it's ready to use as a fallback
+var IRC = NewIRCPresence()
+
+// CurrentPresenceSource is used by UpdateChatters
+var CurrentPresenceSource PresenceSource = newPresenceSource(c.Conf.PresenceSource)
+
+// newPresenceSource returns the presence source with the given name
+func newPresenceSource(name string) PresenceSource {
+	switch name {
+	case PresenceSourceIRC:
+		return IRC
+	case PresenceSourceFake:
+		return &FakePresence{}
+	case PresenceSourceHelix, "":
+		return &HelixPresence{}
+	}
+	log.Println(aurora.Yellow("unknown presence source"), name, aurora.Yellow("using helix"))
+	return &HelixPresence{}
+}
+
+// IRCPresence tracks chatters using IRC JOIN/PART messages.
+// Twitch batches these up and doesn't send them at all for
+// large channels, so it's less accurate than Helix
+type IRCPresence struct {
+	mu       sync.RWMutex
+	chatters map[string]struct{}
+}
+
+// NewIRCPresence creates an empty IRCPresence
+func NewIRCPresence() *IRCPresence {
+	return &IRCPresence{chatters: make(map[string]struct{})}
+}
+
+// Join records that a user joined the channel
+func (p *IRCPresence) Join(username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chatters[strings.ToLower(username)] = struct{}{}
+}
+
+// Part records that a user left the channel
+func (p *IRCPresence) Part(username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.chatters, strings.ToLower(username))
+}
+
+// Chatters returns a copy of the users who have joined and not left
+func (p *IRCPresence) Chatters() (map[string]struct{}, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	chatters := make(map[string]struct{}, len(p.chatters))
+	for chatter := range p.chatters {
+		chatters[chatter] = struct{}{}
+	}
+	return chatters, nil
+}
+
+// FakePresence returns whoever is in Usernames (or Err),
+// it's used for testing and local development
+type FakePresence struct {
+	Usernames []string
+	Err       error
+}
+
+// Chatters returns the fake chatters
+func (p *FakePresence) Chatters() (map[string]struct{}, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	chatters := make(map[string]struct{}, len(p.Usernames))
+	for _, username := range p.Usernames {
+		chatters[strings.ToLower(username)] = struct{}{}
+	}
+	return chatters, nil
+}
@@ -0,0 +1,106 @@
+package twitch
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/logrusorgru/aurora"
+)
+
+// storedToken is a user access token, as it's saved in the DB.
+// The tokens are encrypted using TwitchTokenKey
+type storedToken struct {
+	ID           int       `db:"id"`
+	Scopes       string    `db:"scopes"`
+	AccessToken  string    `db:"access_token"`
+	RefreshToken string    `db:"refresh_token"`
+	ExpiresAt    time.Time `db:"expires_at"`
+	DateCreated  time.Time `db:"date_created"`
+	DateUpdated  time.Time `db:"date_updated"`
+}
+
+// scopesKey is used to look up the token for the current set of scopes,
+// so changing the scopes we ask for will require a new token
+func scopesKey() string {
+	scopes := make([]string, len(Scopes))
+	copy(scopes, Scopes)
+	sort.Strings(scopes)
+	return strings.Join(scopes, " ")
+}
+
+// saveUserAccessToken stores the current user access token in the DB
+func saveUserAccessToken() error {
+	if c.Conf.TwitchTokenKey == "" {
+		log.Println(aurora.Yellow("TWITCH_TOKEN_KEY is not set, not saving user access token"))
+		return nil
+	}
+
+	tokenMutex.Lock()
+	userAccessToken, userRefreshToken, expiresAt := UserAccessToken, UserRefreshToken, UserAccessTokenExpiry
+	tokenMutex.Unlock()
+
+	accessToken, err := helpers.Encrypt(userAccessToken, c.Conf.TwitchTokenKey)
+	if err != nil {
+		terrors.Log(err, "error encrypting user access token")
+		return err
+	}
+	refreshToken, err := helpers.Encrypt(userRefreshToken, c.Conf.TwitchTokenKey)
+	if err != nil {
+		terrors.Log(err, "error encrypting user refresh token")
+		return err
+	}
+
+	query := `INSERT INTO twitch_tokens (scopes, access_token, refresh_token, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scopes) DO UPDATE SET
+			access_token = EXCLUDED.access_token,
+			refresh_token = EXCLUDED.refresh_token,
+			expires_at = EXCLUDED.expires_at,
+			date_updated = CURRENT_TIMESTAMP`
+	_, err = database.Connection().Exec(query, scopesKey(), accessToken, refreshToken, expiresAt)
+	if err != nil {
+		terrors.Log(err, "error saving user access token")
+	}
+	return err
+}
+
+// loadUserAccessToken reads the user access token from the DB
+// and returns true if one was found
+func loadUserAccessToken() bool {
+	if c.Conf.TwitchTokenKey == "" {
+		return false
+	}
+
+	var token storedToken
+	query := `SELECT * FROM twitch_tokens WHERE scopes=$1`
+	err := database.Connection().Get(&token, query, scopesKey())
+	if err == sql.ErrNoRows {
+		log.Println("no saved user access token found")
+		return false
+	}
+	if err != nil {
+		terrors.Log(err, "error loading user access token")
+		return false
+	}
+
+	accessToken, err := helpers.Decrypt(token.AccessToken, c.Conf.TwitchTokenKey)
+	if err != nil {
+		terrors.Log(err, "error decrypting user access token")
+		return false
+	}
+	refreshToken, err := helpers.Decrypt(token.RefreshToken, c.Conf.TwitchTokenKey)
+	if err != nil {
+		terrors.Log(err, "error decrypting user refresh token")
+		return false
+	}
+
+	setUserAccessToken(accessToken, refreshToken, token.ExpiresAt)
+	return true
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
@@ -13,9 +15,28 @@ import (
 // ChannelID contains the twitch-internal user ID
 var ChannelID string
 
-// subscribers is a list of the usernames of the current subscribers
-//TODO: this could include tier and gift info if we wanted
-var subscribers []string
+// Subscriber contains the details of a user's subscription
+type Subscriber struct {
+	Username string
+	// Tier is 1, 2, or 3 (prime subs are tier 1)
+	Tier   int
+	IsGift bool
+	// Gifter is the username of whoever gifted the sub
+	Gifter string
+	// CumulativeMonths is only known when it comes from chat
+	CumulativeMonths int
+}
+
+// subscribers maps the usernames of the current subscribers to their subscription
+var subscribers = make(map[string]Subscriber)
+var subscribersMutex sync.RWMutex
+
+// newSubscribers tracks when AddSubscriber was last called for a user.
+// The Twitch API can take a while to list new subs, so these are kept
+// across refreshes until it does (or the grace period runs out)
+var newSubscribers = make(map[string]time.Time)
+
+const newSubscriberGracePeriod = time.Hour
 
 // getChannelID makes a request to twitch to get the user ID for the channel
 func getChannelID(username string) string {
@@ -38,55 +59,157 @@ func getChannelID(username string) string {
 	return resp.Data.Users[0].ID
 }
 
-// GetSubscribers pulls down the most recent list of subscribers
-func GetSubscribers() {
+// GetSubscribers pulls down the most recent list of subscribers,
+// it returns an error if we couldn't get the whole list
+func GetSubscribers() error {
 	//TODO: should we do this elsewhere as well?
 	if ChannelID == "" {
 		ChannelID = getChannelID(c.Conf.ChannelName)
 	}
-	resp, err := currentTwitchClient.GetSubscriptions(&helix.SubscriptionsParams{
-		BroadcasterID: ChannelID,
-	})
-	if err != nil {
-		terrors.Log(err, "error getting subscriptions from twitch")
-	}
 
-	// spew.Dump(resp)
+	latestSubscribers := make(map[string]Subscriber)
+	var usernames []string
+
+	// twitch only gives us one page at a time
+	var cursor string
+	for {
+		resp, err := currentTwitchClient.GetSubscriptions(&helix.SubscriptionsParams{
+			BroadcasterID: ChannelID,
+			First:         100,
+			After:         cursor,
+		})
+		if err != nil {
+			terrors.Log(err, "error getting subscriptions from twitch")
+			return err
+		}
+		if resp.ErrorMessage != "" {
+			err = fmt.Errorf("%d: %s", resp.StatusCode, resp.ErrorMessage)
+			terrors.Log(err, "twitch refused to list subscriptions")
+			return err
+		}
 
-	// reset the current subscriber list
-	subscribers = []string{}
+		// pull out the usernames
+		for _, sub := range resp.Data.Subscriptions {
+			username := strings.ToLower(sub.UserName)
+			latestSubscribers[username] = Subscriber{
+				Username: username,
+				Tier:     TierFromPlan(sub.Tier),
+				IsGift:   sub.IsGift,
+				Gifter:   strings.ToLower(sub.GifterLogin),
+			}
+			usernames = append(usernames, username)
+		}
 
-	// pull out the usernames
-	for _, sub := range resp.Data.Subscriptions {
-		subscribers = append(subscribers, strings.ToLower(sub.UserName))
+		cursor = resp.Data.Pagination.Cursor
+		if cursor == "" || len(resp.Data.Subscriptions) == 0 {
+			break
+		}
 	}
 
-	if len(subscribers) > 0 {
-		log.Println("subscribers:", strings.Join(subscribers, ", "))
+	subscribersMutex.Lock()
+	mergeSubscribers(latestSubscribers, time.Now())
+	subscribersMutex.Unlock()
+
+	if len(usernames) > 0 {
+		log.Println("subscribers:", strings.Join(usernames, ", "))
 	} else {
 		log.Println(c.Conf.ChannelName, "has no subscribers :(")
 	}
+	return nil
+}
+
+// Subscribers returns a copy of the current subscribers
+func Subscribers() []Subscriber {
+	subscribersMutex.RLock()
+	defer subscribersMutex.RUnlock()
+	subs := make([]Subscriber, 0, len(subscribers))
+	for _, sub := range subscribers {
+		subs = append(subs, sub)
+	}
+	return subs
 }
 
 // UserIsSubscriber returns true if the user subscribes to the channel
 func UserIsSubscriber(username string) bool {
-	for _, sub := range subscribers {
-		if username == sub {
-			return true
+	subscribersMutex.RLock()
+	defer subscribersMutex.RUnlock()
+	_, ok := subscribers[username]
+	return ok
+}
+
+// SubscriberTier returns the tier of the user's subscription,
+// or 0 if they aren't a subscriber
+func SubscriberTier(username string) int {
+	subscribersMutex.RLock()
+	defer subscribersMutex.RUnlock()
+	return subscribers[username].Tier
+}
+
+// AddSubscriber adds a new subscriber to the list, this is used
+// so we don't have to wait for the next GetSubscribers()
+func AddSubscriber(sub Subscriber) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	subscribers[sub.Username] = sub
+	newSubscribers[sub.Username] = time.Now()
+}
+
+// mergeSubscribers replaces the current subscriber list with the latest
+// one from Twitch, keeping any new subscribers it hasn't caught up with.
+// The caller must hold subscribersMutex
+func mergeSubscribers(latest map[string]Subscriber, now time.Time) {
+	for username, added := range newSubscribers {
+		if _, ok := latest[username]; ok || now.Sub(added) > newSubscriberGracePeriod {
+			delete(newSubscribers, username)
+			continue
+		}
+		if sub, ok := subscribers[username]; ok {
+			latest[username] = sub
+		}
+	}
+
+	// the API doesn't include cumulative months, so hang on to them
+	for username, sub := range latest {
+		if old, ok := subscribers[username]; ok && sub.CumulativeMonths == 0 {
+			sub.CumulativeMonths = old.CumulativeMonths
+			latest[username] = sub
 		}
 	}
-	return false
+
+	subscribers = latest
+}
+
+// TierFromPlan converts a Twitch sub plan ("Prime", "1000", "2000",
+// or "3000") to a tier number
+func TierFromPlan(plan string) int {
+	switch plan {
+	case "2000":
+		return 2
+	case "3000":
+		return 3
+	}
+	return 1
 }
 
 // UserIsFollower returns true if the user follows the channel
 func UserIsFollower(username string) bool {
+	follower, _ := FollowerStatus(username)
+	return follower
+}
+
+// FollowerStatus returns true if the user follows the channel, the
+// error is set if we weren't able to find out
+func FollowerStatus(username string) (bool, error) {
 	// I can't follow myself so just do this
 	if c.UserIsAdmin(username) {
-		return true
+		return true, nil
 	}
 
 	// get the channel ID for the given user
 	userID := getChannelID(username)
+	if userID == "" {
+		return false, fmt.Errorf("unable to find twitch user %s", username)
+	}
 
 	resp, err := currentTwitchClient.GetUsersFollows(&helix.UsersFollowsParams{
 		ToID:   ChannelID,
@@ -94,12 +217,11 @@ func UserIsFollower(username string) bool {
 	})
 	if err != nil {
 		terrors.Log(err, "error getting user follows")
-		return false
+		return false, err
 	}
-
-	if resp.Data.Total < 1 {
-		return false
+	if resp.ErrorMessage != "" {
+		return false, fmt.Errorf("%d: %s", resp.StatusCode, resp.ErrorMessage)
 	}
-	return true
 
+	return resp.Data.Total > 0, nil
 }
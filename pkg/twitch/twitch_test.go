@@ -0,0 +1,79 @@
+package twitch
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeSubscribers replaces the subscriber list for the test
+func fakeSubscribers(t *testing.T, subs ...Subscriber) {
+	oldSubscribers, oldNewSubscribers := subscribers, newSubscribers
+	subscribers = make(map[string]Subscriber)
+	newSubscribers = make(map[string]time.Time)
+	for _, sub := range subs {
+		subscribers[sub.Username] = sub
+	}
+	t.Cleanup(func() {
+		subscribers, newSubscribers = oldSubscribers, oldNewSubscribers
+	})
+}
+
+func subscriberNames() []string {
+	var usernames []string
+	for _, sub := range Subscribers() {
+		usernames = append(usernames, sub.Username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+func TestMergeSubscribers(t *testing.T) {
+	fakeSubscribers(t,
+		Subscriber{Username: "alice", Tier: 1},
+		Subscriber{Username: "bob", Tier: 1},
+	)
+	// carol subscribes while the list is being refreshed
+	AddSubscriber(Subscriber{Username: "carol", Tier: 2, CumulativeMonths: 4})
+
+	now := time.Now()
+	mergeSubscribers(map[string]Subscriber{
+		"alice": {Username: "alice", Tier: 3},
+	}, now)
+
+	if got := subscriberNames(); !reflect.DeepEqual(got, []string{"alice", "carol"}) {
+		t.Errorf("expected alice and carol to be subscribers, got %v", got)
+	}
+	if tier := SubscriberTier("alice"); tier != 3 {
+		t.Errorf("expected alice to be tier 3, got %d", tier)
+	}
+
+	// twitch catches up, but doesn't know about cumulative months
+	mergeSubscribers(map[string]Subscriber{
+		"alice": {Username: "alice", Tier: 3},
+		"carol": {Username: "carol", Tier: 2},
+	}, now)
+	if months := subscribers["carol"].CumulativeMonths; months != 4 {
+		t.Errorf("expected carol to keep 4 cumulative months, got %d", months)
+	}
+	if _, ok := newSubscribers["carol"]; ok {
+		t.Errorf("expected carol to no longer be a new subscriber")
+	}
+}
+
+func TestMergeSubscribersGracePeriod(t *testing.T) {
+	fakeSubscribers(t)
+	AddSubscriber(Subscriber{Username: "carol", Tier: 1})
+
+	// twitch never lists carol
+	mergeSubscribers(map[string]Subscriber{}, time.Now().Add(newSubscriberGracePeriod/2))
+	if !UserIsSubscriber("carol") {
+		t.Errorf("expected carol to be kept during the grace period")
+	}
+
+	mergeSubscribers(map[string]Subscriber{}, time.Now().Add(2*newSubscriberGracePeriod))
+	if UserIsSubscriber("carol") {
+		t.Errorf("expected carol to be removed after the grace period")
+	}
+}
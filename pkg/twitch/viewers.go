@@ -2,9 +2,12 @@ package twitch
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	terrors "github.com/adanalife/tripbot/pkg/errors"
@@ -12,21 +15,33 @@ import (
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 )
 
-// chattersAPIURL is the URL to hit for current chatter list
-var chattersAPIURL = "https://tmi.twitch.tv/group/user/" + strings.ToLower(c.Conf.ChannelName) + "/chatters"
+// chattersAPIURL is the Helix Get Chatters endpoint
+var chattersAPIURL = "https://api.twitch.tv/helix/chat/chatters"
+
+// chattersPageSize is the most chatters Twitch will return at once
+const chattersPageSize = 1000
 
 // chattersResponse is the json returned by the Twitch chatters endpoint
 type chattersResponse struct {
-	Count    int                 `json:"chatter_count"`
-	Chatters map[string][]string `json:"chatters"`
+	Data []struct {
+		UserID    string `json:"user_id"`
+		UserLogin string `json:"user_login"`
+	} `json:"data"`
+	Pagination struct {
+		Cursor string `json:"cursor"`
+	} `json:"pagination"`
+	Total int `json:"total"`
 }
 
 // currentChatters will contain the current viewers
-var currentChatters chattersResponse
+var currentChatters = make(map[string]struct{})
+var chattersMutex sync.RWMutex
 
-// ChatterCount returns the number of chatters (as reported by Twitch)
+// ChatterCount returns the number of chatters
 func ChatterCount() int {
-	return currentChatters.Count
+	chattersMutex.RLock()
+	defer chattersMutex.RUnlock()
+	return len(currentChatters)
 }
 
 // Chatters returns a map where the keys are current chatters
@@ -34,49 +49,101 @@ func ChatterCount() int {
 // c.p. https://stackoverflow.com/a/10486196
 //TODO: consider using an int as the value and have that be the ID in the DB
 func Chatters() map[string]struct{} {
-	//TODO: maybe we don't want to make this every time?
-	var chatters = make(map[string]struct{})
-	for _, list := range currentChatters.Chatters {
-		for _, chatter := range list {
-			chatters[chatter] = struct{}{}
-		}
+	chattersMutex.RLock()
+	defer chattersMutex.RUnlock()
+	chatters := make(map[string]struct{}, len(currentChatters))
+	for chatter := range currentChatters {
+		chatters[chatter] = struct{}{}
 	}
 	return chatters
 }
 
-// UpdateChatters makes a request to the chatters API and updates currentChatters
-func UpdateChatters() {
-	var latestChatters chattersResponse
+// UpdateChatters asks the CurrentPresenceSource who is in chat.
+// If that fails we keep the previous list and return the error
+func UpdateChatters() error {
+	latestChatters, err := CurrentPresenceSource.Chatters()
+	if err != nil {
+		terrors.Log(err, "error getting chatters")
+		return err
+	}
 
-	client := http.Client{
-		Timeout: 2 * time.Second,
+	chattersMutex.Lock()
+	defer chattersMutex.Unlock()
+	currentChatters = latestChatters
+	return nil
+}
+
+// HelixPresence uses the Helix Get Chatters endpoint, which requires
+// a user access token from a moderator (or the broadcaster) with the
+// moderator:read:chatters scope
+type HelixPresence struct{}
+
+// Chatters fetches every page of chatters from Twitch
+func (p *HelixPresence) Chatters() (map[string]struct{}, error) {
+	token := CurrentUserAccessToken()
+	if token == "" {
+		return nil, fmt.Errorf("no user access token, unable to get chatters")
+	}
+	if ChannelID == "" {
+		ChannelID = getChannelID(c.Conf.ChannelName)
 	}
 
-	req, err := http.NewRequest(http.MethodGet, chattersAPIURL, nil)
-	if err != nil {
-		terrors.Log(err, "error creating request")
-		return
+	chatters := make(map[string]struct{})
+	cursor := ""
+	for {
+		page, err := getChattersPage(token, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, chatter := range page.Data {
+			chatters[strings.ToLower(chatter.UserLogin)] = struct{}{}
+		}
+		cursor = page.Pagination.Cursor
+		if cursor == "" {
+			break
+		}
 	}
+	return chatters, nil
+}
 
-	//TODO: make this a config var
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36")
+// getChattersPage makes a single request to the chatters endpoint
+func getChattersPage(token, cursor string) (chattersResponse, error) {
+	var page chattersResponse
+
+	params := url.Values{}
+	params.Set("broadcaster_id", ChannelID)
+	// the user access token belongs to the broadcaster,
+	// who counts as a moderator of their own channel
+	params.Set("moderator_id", ChannelID)
+	params.Set("first", fmt.Sprintf("%d", chattersPageSize))
+	if cursor != "" {
+		params.Set("after", cursor)
+	}
 
-	res, err := client.Do(req)
+	req, err := http.NewRequest(http.MethodGet, chattersAPIURL+"?"+params.Encode(), nil)
 	if err != nil {
-		terrors.Log(err, "error making request")
-		return
+		return page, err
 	}
+	req.Header.Set("Client-Id", ClientID)
+	req.Header.Set("Authorization", "Bearer "+token)
 
-	body, err := ioutil.ReadAll(res.Body)
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	res, err := client.Do(req)
 	if err != nil {
-		terrors.Log(err, "error reading request body")
-		return
+		return page, err
 	}
+	defer res.Body.Close()
 
-	err = json.Unmarshal(body, &latestChatters)
+	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		terrors.Log(err, "error unmarshalling json")
+		return page, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return page, fmt.Errorf("chatters request failed with %d: %s", res.StatusCode, body)
 	}
 
-	currentChatters = latestChatters
+	err = json.Unmarshal(body, &page)
+	return page, err
 }
@@ -0,0 +1,211 @@
+package users
+
+import (
+	"log"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/miles"
+	"github.com/adanalife/tripbot/pkg/scoreboards"
+	"github.com/logrusorgru/aurora"
+)
+
+// sessionCheckpoint is a record of a session that hasn't ended yet.
+// If the bot gets killed, these are left behind in the DB
+type sessionCheckpoint struct {
+	ID          int       `db:"id"`
+	UserID      uint16    `db:"user_id"`
+	Username    string    `db:"username"`
+	LoggedInAt  time.Time `db:"logged_in_at"`
+	Miles       float32   `db:"miles"`
+	DateCreated time.Time `db:"date_created"`
+	DateUpdated time.Time `db:"date_updated"`
+}
+
+// checkpointChange is what CheckpointSession will do to a user
+// in memory once the transaction has been committed
+type checkpointChange struct {
+	user         User
+	milesDelta   float32
+	creditsDelta float32
+	bonusMiles   float32
+}
+
+// CheckpointSession saves the miles everyone has earned so far this session,
+// so they aren't lost if the bot crashes. Everything is saved in a single
+// transaction so a failure part of the way through doesn't double-count
+func CheckpointSession() {
+	if c.Conf.ReadOnly {
+		return
+	}
+
+	sessionUsers := Session.Snapshot()
+	if len(sessionUsers) == 0 {
+		return
+	}
+
+	// work out the miles before taking the lock, this can be slow
+	// (the miles rules may hit the Twitch API) so only do it once per user
+	now := time.Now()
+	var changes []checkpointChange
+	for _, u := range sessionUsers {
+		// the bonus is locked in at the current rate,
+		// so later rule changes don't affect it
+		bonusMiles := u.bonusMilesAt(now)
+		sessionMiles := helpers.DurationToMiles(now.Sub(u.LoggedIn)) + bonusMiles
+		milesDelta := sessionMiles - u.checkpointedMiles
+		if milesDelta < 0 {
+			milesDelta = 0
+		}
+		creditsDelta := sessionMiles - u.creditedMiles
+		if creditsDelta < 0 {
+			creditsDelta = 0
+		}
+		changes = append(changes, checkpointChange{user: u, milesDelta: milesDelta, creditsDelta: creditsDelta, bonusMiles: bonusMiles})
+	}
+
+	// the users can't log out (or be credited) while we save them,
+	// anyone who is busy right now gets saved next time
+	var claimed []checkpointChange
+	for _, change := range changes {
+		release, ok := Session.tryClaim(change.user.Username)
+		if !ok {
+			continue
+		}
+		defer release()
+		claimed = append(claimed, change)
+	}
+	if len(claimed) == 0 {
+		return
+	}
+
+	tx, err := database.Connection().Beginx()
+	if err != nil {
+		terrors.Log(err, "error starting checkpoint transaction")
+		return
+	}
+	// rollback is a no-op if the transaction was committed
+	defer tx.Rollback()
+
+	var saved []checkpointChange
+	monthlyMiles := make(map[uint16]float32)
+	for _, change := range claimed {
+		// skip anyone who logged out (or was credited) since we looked,
+		// they'll be picked up by the next checkpoint
+		u, ok := Session.Get(change.user.Username)
+		if !ok || !u.LoggedIn.Equal(change.user.LoggedIn) ||
+			u.checkpointedMiles != change.user.checkpointedMiles ||
+			u.creditedMiles != change.user.creditedMiles {
+			continue
+		}
+
+		query := `UPDATE users SET miles=$1, last_seen=$2 WHERE id=$3`
+		_, err = tx.Exec(query, u.Miles+change.milesDelta, now, u.ID)
+		if err != nil {
+			terrors.Log(err, "error checkpointing user miles")
+			return
+		}
+		if change.milesDelta > 0 {
+			monthlyMiles[u.ID] = change.milesDelta
+		}
+		err = miles.CreditInTx(tx, u.ID, change.creditsDelta, "session")
+		if err != nil {
+			return
+		}
+
+		query = `INSERT INTO session_checkpoints (user_id, username, logged_in_at, miles)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id) DO UPDATE SET
+				miles = EXCLUDED.miles,
+				date_updated = CURRENT_TIMESTAMP`
+		_, err = tx.Exec(query, u.ID, u.Username, u.LoggedIn, u.checkpointedMiles+change.milesDelta)
+		if err != nil {
+			terrors.Log(err, "error saving session checkpoint")
+			return
+		}
+
+		saved = append(saved, change)
+	}
+
+	// update the monthly scoreboard for everyone at once
+	// (the scoreboard itself is found or created outside of the transaction)
+	err = scoreboards.AddToScoresInTx(tx, scoreboards.CurrentMilesScoreboard(), monthlyMiles)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		terrors.Log(err, "error committing session checkpoint")
+		return
+	}
+
+	InvalidateLeaderboard()
+
+	// now that it's saved, update the users in the session to match
+	for _, change := range saved {
+		Session.Update(change.user.Username, func(u *User) {
+			u.Miles += change.milesDelta
+			u.checkpointedMiles += change.milesDelta
+			u.creditedMiles += change.creditsDelta
+			u.bonusMiles = change.bonusMiles
+			u.bonusAccruedAt = now
+			u.LastSeen = now
+		})
+	}
+
+	if c.Conf.Verbose {
+		log.Println("checkpointed session miles for", aurora.Cyan(len(saved)), "users")
+	}
+}
+
+// ReconcileSessions cleans up after sessions that were interrupted by a
+// crash. Their miles were saved up to the last checkpoint, so all that's
+// left to do is log them out. This must run before anyone is logged in
+func ReconcileSessions() {
+	if c.Conf.ReadOnly {
+		return
+	}
+
+	var checkpoints []sessionCheckpoint
+	err := database.Connection().Select(&checkpoints, `SELECT * FROM session_checkpoints`)
+	if err != nil {
+		terrors.Log(err, "error loading session checkpoints")
+		return
+	}
+	if len(checkpoints) == 0 {
+		return
+	}
+
+	log.Println(aurora.Yellow("recovering"), len(checkpoints), aurora.Yellow("sessions that didn't end cleanly"))
+	for _, checkpoint := range checkpoints {
+		if c.Conf.Verbose {
+			log.Printf("recovered %.2f miles for %s", checkpoint.Miles, checkpoint.Username)
+		}
+		// they were last seen at the last checkpoint
+		err = events.LogoutAt(checkpoint.Username, checkpoint.DateUpdated)
+		if err != nil {
+			terrors.Log(err, "error creating logout event")
+		}
+	}
+
+	_, err = database.Connection().Exec(`DELETE FROM session_checkpoints`)
+	if err != nil {
+		terrors.Log(err, "error removing session checkpoints")
+	}
+}
+
+// clearCheckpoint removes the checkpoint once a session ends normally
+func (u *User) clearCheckpoint() {
+	if c.Conf.ReadOnly {
+		return
+	}
+	_, err := database.Connection().Exec(`DELETE FROM session_checkpoints WHERE user_id=$1`, u.ID)
+	if err != nil {
+		terrors.Log(err, "error removing session checkpoint")
+	}
+}
@@ -2,109 +2,201 @@ package users
 
 import (
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
 	"github.com/adanalife/tripbot/pkg/database"
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 	"github.com/jmoiron/sqlx"
-	"github.com/logrusorgru/aurora"
 )
 
-var LifetimeMilesLeaderboard [][]string
-var initLeaderboardSize = 25
-var maxLeaderboardSize = 50
+// LeaderboardEntry is a user's place on the lifetime miles leaderboard
+type LeaderboardEntry struct {
+	Rank     int     `db:"-" json:"rank"`
+	Username string  `db:"username" json:"username"`
+	Miles    float32 `db:"miles" json:"miles"`
+}
 
-// LifetimeMilesLeaderboard creates a leaderboard
-func InitLeaderboard() {
-	users := []User{}
+// leaderboardTTL is how long we keep the miles from the DB before
+// reloading them, it's also reloaded whenever miles are saved
+var leaderboardTTL = 10 * time.Minute
+
+// rankedTTL is how long the ranked leaderboard (including session
+// miles) is kept, figuring out session miles can be slow
+var rankedTTL = time.Minute
+
+// leaderboardCache holds everyone's saved miles, and the ranked
+// leaderboard that has the live session miles added on top
+var leaderboardCache struct {
+	sync.Mutex
+	entries  []LeaderboardEntry
+	loadedAt time.Time
+	ranked   []LeaderboardEntry
+	rankedAt time.Time
+}
 
-	ignoredUsers := append(c.IgnoredUsers, strings.ToLower(c.Conf.ChannelName))
-	// we use MySQL-style ? bindvars instead of postgres ones here
-	// because that's what sqlx wants for In()
-	q := `SELECT * FROM users WHERE miles != 0 AND is_bot = false AND username NOT IN (?) ORDER BY miles DESC LIMIT ?`
-	query, args, err := sqlx.In(q, ignoredUsers, initLeaderboardSize)
-	if err != nil {
-		terrors.Log(err, "error generating query")
-	}
-	query = database.Connection().Rebind(query)
-	err = database.Connection().Select(&users, query, args...)
+// InitLeaderboard loads the lifetime leaderboard so the first
+// command that uses it doesn't have to wait
+func InitLeaderboard() {
+	_, err := savedMiles()
 	if err != nil {
-		terrors.Log(err, "error generating query")
+		terrors.Log(err, "error loading leaderboard")
 	}
+}
 
-	for _, user := range users {
-		miles := fmt.Sprintf("%.1f", user.Miles)
-		pair := []string{user.Username, miles}
-		LifetimeMilesLeaderboard = append(LifetimeMilesLeaderboard, pair)
-	}
+// InvalidateLeaderboard makes the next read reload miles from the DB,
+// it's called whenever miles are saved
+func InvalidateLeaderboard() {
+	leaderboardCache.Lock()
+	defer leaderboardCache.Unlock()
+	leaderboardCache.loadedAt = time.Time{}
 }
 
+// UpdateLeaderboard refreshes the session miles on the leaderboard,
+// it is run regularly by a cron job
 func UpdateLeaderboard() {
-	for _, user := range LoggedIn {
-		// skip adding this user if they're a bot or ignored
-		if user.IsBot || c.UserIsIgnored(user.Username) || c.UserIsAdmin(user.Username) {
-			continue
-		}
-		insertIntoLeaderboard(*user)
+	_, err := rankLeaderboard()
+	if err != nil {
+		terrors.Log(err, "error updating leaderboard")
+	}
+}
+
+// LifetimeLeaderboard returns a page of the lifetime miles leaderboard,
+// pages start at 1
+func LifetimeLeaderboard(page, pageSize int) ([]LeaderboardEntry, error) {
+	entries, err := lifetimeLeaderboard()
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start >= len(entries) {
+		return []LeaderboardEntry{}, nil
 	}
-	// truncate LifetimeMilesLeaderboard if it gets too big
-	if len(LifetimeMilesLeaderboard) > maxLeaderboardSize {
-		LifetimeMilesLeaderboard = LifetimeMilesLeaderboard[:maxLeaderboardSize]
+	end := start + pageSize
+	if end > len(entries) {
+		end = len(entries)
 	}
+	return entries[start:end], nil
 }
 
-// convert the string to a float32
-func strToFloat32(str string) float32 {
-	value, err := strconv.ParseFloat(str, 32)
+// LifetimeRank returns the user's place on the lifetime miles leaderboard,
+// and false if they aren't on it
+func LifetimeRank(username string) (LeaderboardEntry, bool, error) {
+	entries, err := lifetimeLeaderboard()
 	if err != nil {
-		terrors.Log(err, "error parsing float")
-		return 0.0
+		return LeaderboardEntry{}, false, err
 	}
-	return float32(value)
+	for _, entry := range entries {
+		if entry.Username == username {
+			return entry, true, nil
+		}
+	}
+	return LeaderboardEntry{}, false, nil
 }
 
-func insertIntoLeaderboard(user User) {
-	// first we remove this user from the board
-	removeFromLeaderboard(user.Username)
+// lifetimeLeaderboard returns the ranked leaderboard, using the cache if it's fresh
+func lifetimeLeaderboard() ([]LeaderboardEntry, error) {
+	leaderboardCache.Lock()
+	fresh := time.Since(leaderboardCache.rankedAt) < rankedTTL
+	ranked := leaderboardCache.ranked
+	leaderboardCache.Unlock()
 
-	// get the current miles as a float
-	miles := user.CurrentMiles()
+	if fresh {
+		return ranked, nil
+	}
+	return rankLeaderboard()
+}
 
-	for i, pair := range LifetimeMilesLeaderboard {
-		val := strToFloat32(pair[1])
-		// see if our miles are higher
-		if miles >= val {
-			milesStr := fmt.Sprintf("%.1f", miles)
-			newPair := []string{user.Username, milesStr}
+// rankLeaderboard combines the saved miles with the
+// miles from the current session, and ranks everyone
+func rankLeaderboard() ([]LeaderboardEntry, error) {
+	saved, err := savedMiles()
+	if err != nil {
+		return nil, err
+	}
 
-			// insert into LifetimeMilesLeaderboard
-			// https://github.com/golang/go/wiki/SliceTricks#insert
-			LifetimeMilesLeaderboard = append(LifetimeMilesLeaderboard[:i], append([][]string{newPair}, LifetimeMilesLeaderboard[i:]...)...)
-			return
+	byUsername := make(map[string]float32, len(saved))
+	for _, entry := range saved {
+		byUsername[entry.Username] = entry.Miles
+	}
+	// logged-in users have miles that haven't been saved yet
+	for _, user := range Session.Snapshot() {
+		if !onLeaderboard(user) {
+			continue
 		}
+		byUsername[user.Username] = user.CurrentMiles()
 	}
-}
 
-// removeFromLeaderboard searches the LifetimeMilesLeaderboard for
-// a username and removes it
-func removeFromLeaderboard(username string) {
-	for i, pair := range LifetimeMilesLeaderboard {
-		if pair[0] == username {
-			// delete from LifetimeMilesLeaderboard
-			// https://github.com/golang/go/wiki/SliceTricks#delete
-			LifetimeMilesLeaderboard = append(LifetimeMilesLeaderboard[:i], LifetimeMilesLeaderboard[i+1:]...)
-			return
+	entries := make([]LeaderboardEntry, 0, len(byUsername))
+	for username, miles := range byUsername {
+		if miles == 0 {
+			continue
+		}
+		entries = append(entries, LeaderboardEntry{Username: username, Miles: miles})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Miles != entries[j].Miles {
+			return entries[i].Miles > entries[j].Miles
+		}
+		return entries[i].Username < entries[j].Username
+	})
+
+	// ties get the same rank
+	for i := range entries {
+		if i > 0 && entries[i].Miles == entries[i-1].Miles {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
 		}
 	}
+
+	leaderboardCache.Lock()
+	leaderboardCache.ranked = entries
+	leaderboardCache.rankedAt = time.Now()
+	leaderboardCache.Unlock()
+	return entries, nil
 }
 
-// this was used for development
-func printLeaderboard() {
-	for i, pair := range LifetimeMilesLeaderboard {
-		fmt.Printf("%d: %s - %s\n", i+1, pair[1], aurora.Magenta(pair[0]))
+// savedMiles returns everyone's miles from the DB, using the cache if it's fresh
+func savedMiles() ([]LeaderboardEntry, error) {
+	leaderboardCache.Lock()
+	defer leaderboardCache.Unlock()
+
+	if time.Since(leaderboardCache.loadedAt) < leaderboardTTL {
+		return leaderboardCache.entries, nil
 	}
+
+	ignoredUsers := append([]string{strings.ToLower(c.Conf.ChannelName)}, c.IgnoredUsers...)
+	// we use MySQL-style ? bindvars instead of postgres ones here
+	// because that's what sqlx wants for In()
+	q := `SELECT username, miles FROM users WHERE miles != 0 AND is_bot = false AND username NOT IN (?)`
+	query, args, err := sqlx.In(q, ignoredUsers)
+	if err != nil {
+		terrors.Log(err, "error generating query")
+		return nil, err
+	}
+	query = database.Connection().Rebind(query)
+
+	var entries []LeaderboardEntry
+	err = database.Connection().Select(&entries, query, args...)
+	if err != nil {
+		terrors.Log(err, "error loading leaderboard miles")
+		return nil, err
+	}
+	leaderboardCache.entries = entries
+	leaderboardCache.loadedAt = time.Now()
+	return entries, nil
+}
+
+// onLeaderboard returns false for users who can't be on the leaderboard
+func onLeaderboard(user User) bool {
+	return !user.IsBot && !c.UserIsIgnored(user.Username) && !c.UserIsAdmin(user.Username)
 }
 
 // LeaderboardContent creates the content for the leaderboard onscreen
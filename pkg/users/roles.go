@@ -0,0 +1,216 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/twitch"
+)
+
+// Role is what a user is allowed to do, higher roles can
+// do everything the lower ones can
+type Role int
+
+// these are the roles, in order
+const (
+	RoleViewer Role = iota
+	RoleSubscriber
+	RoleVIP
+	RoleModerator
+	RoleBroadcaster
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:      "viewer",
+	RoleSubscriber:  "subscriber",
+	RoleVIP:         "vip",
+	RoleModerator:   "moderator",
+	RoleBroadcaster: "broadcaster",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// ErrInvalidRole is returned for roles that can't be given out
+var ErrInvalidRole = errors.New("invalid role")
+
+// ParseRole returns the role with the given name, the broadcaster
+// role can't be given to anyone so it isn't accepted
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "viewer":
+		return RoleViewer, nil
+	case "subscriber", "sub":
+		return RoleSubscriber, nil
+	case "vip":
+		return RoleVIP, nil
+	case "moderator", "mod":
+		return RoleModerator, nil
+	}
+	return RoleViewer, ErrInvalidRole
+}
+
+// chatBadges is what we learned about a user from the
+// badges on their most recent chat message
+type chatBadges struct {
+	role       Role
+	subscriber bool
+}
+
+// badges are keyed by username
+var badges = make(map[string]chatBadges)
+
+// roleOverrides are roles saved in the DB, they take the place of
+// the role from the badges (ex: to let someone moderate the bot
+// without making them a Twitch mod)
+var roleOverrides = make(map[string]Role)
+var rolesMutex sync.RWMutex
+
+// InitRoles loads the role overrides from the DB
+func InitRoles() {
+	var rows []struct {
+		Username string `db:"username"`
+		Role     string `db:"role"`
+	}
+	query := `SELECT users.username, user_roles.role FROM user_roles JOIN users ON user_roles.user_id = users.id`
+	err := database.Connection().Select(&rows, query)
+	if err != nil {
+		terrors.Log(err, "error loading role overrides")
+		return
+	}
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	for _, row := range rows {
+		role, err := ParseRole(row.Role)
+		if err != nil {
+			continue
+		}
+		roleOverrides[row.Username] = role
+	}
+}
+
+// UpdateBadges records the user's role from the badges on a chat message
+// (ex: {"moderator": 1, "subscriber": 12})
+func UpdateBadges(username string, badgeMap map[string]int) {
+	var b chatBadges
+	switch {
+	case badgeMap["broadcaster"] > 0:
+		b.role = RoleBroadcaster
+	case badgeMap["moderator"] > 0:
+		b.role = RoleModerator
+	case badgeMap["vip"] > 0:
+		b.role = RoleVIP
+	}
+	// the number is how many months they've been subscribed
+	_, subscriber := badgeMap["subscriber"]
+	_, founder := badgeMap["founder"]
+	b.subscriber = subscriber || founder
+	if b.subscriber && b.role < RoleSubscriber {
+		b.role = RoleSubscriber
+	}
+
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	badges[username] = b
+}
+
+// forgetBadges drops what we learned from the user's badges, it's called
+// when they log out so the map doesn't keep everyone who ever chatted
+func forgetBadges(username string) {
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	delete(badges, username)
+}
+
+// SetRole saves a role override for the user
+func SetRole(username string, role Role, grantedBy string) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	if role == RoleBroadcaster {
+		return ErrInvalidRole
+	}
+	query := `INSERT INTO user_roles (user_id, role, granted_by)
+		SELECT id, $2, $3 FROM users WHERE username = $1
+		ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by`
+	_, err := database.Connection().Exec(query, username, role.String(), grantedBy)
+	if err != nil {
+		terrors.Log(err, "error saving role override")
+		return err
+	}
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	roleOverrides[username] = role
+	return nil
+}
+
+// ResetRole removes the user's role override,
+// so their role comes from their badges again
+func ResetRole(username string) error {
+	if c.Conf.ReadOnly {
+		return &terrors.ReadOnlyError{Msg: "read-only mode"}
+	}
+	query := `DELETE FROM user_roles USING users WHERE user_roles.user_id = users.id AND users.username = $1`
+	_, err := database.Connection().Exec(query, username)
+	if err != nil {
+		terrors.Log(err, "error removing role override")
+		return err
+	}
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	delete(roleOverrides, username)
+	return nil
+}
+
+// Role returns what the user is allowed to do
+func (u User) Role() Role {
+	if c.UserIsAdmin(u.Username) {
+		return RoleBroadcaster
+	}
+	rolesMutex.RLock()
+	b, seen := badges[u.Username]
+	override, overridden := roleOverrides[u.Username]
+	rolesMutex.RUnlock()
+
+	if b.role == RoleBroadcaster {
+		return RoleBroadcaster
+	}
+	if overridden {
+		return override
+	}
+	if seen && b.role > RoleSubscriber {
+		return b.role
+	}
+	if u.IsSubscriber() {
+		return RoleSubscriber
+	}
+	return RoleViewer
+}
+
+// IsModerator returns true for moderators and the broadcaster
+func (u User) IsModerator() bool {
+	return u.Role() >= RoleModerator
+}
+
+// IsBroadcaster returns true if the user owns the channel
+func (u User) IsBroadcaster() bool {
+	return u.Role() == RoleBroadcaster
+}
+
+// IsSubscriber returns true if the user is a subscriber, we check their
+// chat badges first so we don't have to wait for the subscriber list
+func (u User) IsSubscriber() bool {
+	return hasSubscriberBadge(u.Username) || twitch.UserIsSubscriber(u.Username)
+}
+
+// hasSubscriberBadge returns true if the user's last chat message had a sub badge
+func hasSubscriberBadge(username string) bool {
+	rolesMutex.RLock()
+	defer rolesMutex.RUnlock()
+	return badges[username].subscriber
+}
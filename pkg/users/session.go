@@ -4,42 +4,53 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"sort"
 	"strings"
 	"time"
 
 	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
 	"github.com/adanalife/tripbot/pkg/events"
+	"github.com/adanalife/tripbot/pkg/miles"
 	"github.com/adanalife/tripbot/pkg/scoreboards"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hako/durafmt"
 
 	"github.com/adanalife/tripbot/pkg/twitch"
-	mytwitch "github.com/adanalife/tripbot/pkg/twitch"
 	"github.com/logrusorgru/aurora"
 )
 
 //TODO: consider moving this whole thing elsewhere (to background perhaps?)
 
-// LoggedIn is a map that contains all the currently logged-in users,
-// mapping their username to a User
-var LoggedIn = make(map[string]*User)
+// Session contains all the currently logged-in users
+var Session = NewSessionStore()
+
+// startSession and endSession do the DB work when users log in and
+// out, they're vars so the tests can run without a DB
+var (
+	startSession = login
+	endSession   = saveSession
+)
 
 // UpdateSession will use the data from the Twitch API to maintain a list
 // of currently-logged-in users
 func UpdateSession() {
 	// fetch the latest chatters from Twitch
-	twitch.UpdateChatters()
+	err := twitch.UpdateChatters()
+	if err != nil {
+		// we don't know who is here, so leave the session alone
+		// rather than logging everybody out
+		return
+	}
 	currentChatters := twitch.Chatters()
 
 	// log out the people who arent present
-	for username, user := range LoggedIn {
-		if _, ok := currentChatters[username]; ok {
+	for _, user := range Session.Snapshot() {
+		if _, ok := currentChatters[user.Username]; ok {
 			// they're logged in and a current chatter, do nothing
 			continue
 		} else {
 			// they're logged in and NOT a current chatter, so log them out
-			user.logout()
+			LogoutIfNecessary(user.Username)
 			continue
 		}
 	}
@@ -55,27 +66,44 @@ func UpdateSession() {
 }
 
 // LoginIfNecessary checks the list of currently-logged in users and will
-// run login() if this user isn't currently logged in
+// run login() if this user isn't currently logged in. It returns a copy
+// of the user, changes to it have to go through Session.Update()
 func LoginIfNecessary(username string) *User {
 	// check if the user is currently logged in
-	if isLoggedIn(username) {
-		return LoggedIn[username]
+	if user, ok := Session.Get(username); ok {
+		return &user
+	}
+
+	// make sure nobody else logs them in (or out) while we do,
+	// and check again in case someone just did
+	release := Session.claim(username)
+	if user, ok := Session.Get(username); ok {
+		release()
+		return &user
 	}
+
 	// they weren't logged in, so note in the DB
-	return login(username)
+	user := startSession(username)
+	Session.Add(user)
+	release()
+
+	// create a login event as well
+	events.Login(username)
+	return &user
 }
 
 // LogoutIfNecessary will log out the user if it finds them in the session
 func LogoutIfNecessary(username string) {
-	if isLoggedIn(username) {
-		user := *LoggedIn[username]
-		user.logout()
-	}
+	// wait for anything else happening to them to finish first
+	release := Session.claim(username)
+	defer release()
+	logout(username)
 }
 
-// login will record the users presence in the DB
+// login will record the users presence in the DB,
+// the caller is responsible for adding them to the session
 //TODO: do we want to make a DB update here? we could do it on logout()
-func login(username string) *User {
+func login(username string) User {
 	now := time.Now()
 
 	user := FindOrCreate(username)
@@ -91,29 +119,35 @@ func login(username string) *User {
 	user.lastLocation = now.AddDate(0, 0, -1)
 	user.save()
 
+	// look up how many days in a row they've visited
+	streak, err := events.LoginStreak(username)
+	if err != nil {
+		terrors.Log(err, "error getting login streak")
+	}
+	user.streakDays = streak
+
 	// raise an error if a user is supposed to be a bot
 	if c.UserIsIgnored(username) && !user.IsBot {
 		log.Println(aurora.Red(username), errors.New("user should be bot"))
 	}
 
 	// just a silly message to confirm subscriber feature is working
-	if mytwitch.UserIsSubscriber(username) {
+	if user.IsSubscriber() {
 		msg := fmt.Sprintf("subscriber %s logged in!", username)
 		log.Println(aurora.Magenta(msg))
 	}
 
-	// add them to the session
-	LoggedIn[username] = &user
-
-	// create a login event as well
-	events.Login(username)
-
-	return &user
+	return user
 }
 
-// User.logout() removes the user from the list of currently-logged in users,
-// and updates the DB with their most up-to-date values
-func (u User) logout() {
+// logout removes the user from the list of currently-logged in users,
+// and updates the DB with their most up-to-date values. The caller
+// must have claimed the user
+func logout(username string) {
+	u, ok := Session.Get(username)
+	if !ok {
+		return
+	}
 	sessionMiles := u.sessionMiles()
 
 	// print logout message if they're human
@@ -125,66 +159,89 @@ func (u User) logout() {
 		log.Println("logging out", u, dur, miles)
 	}
 
+	// remove them from the session, so nothing else changes them while
+	// we save. Anything that changed since we looked is in this copy
+	u, ok = Session.Remove(username)
+	if !ok {
+		return
+	}
+	// they'll be sent again with their next chat message
+	forgetBadges(username)
+	endSession(u, sessionMiles)
+}
+
+// saveSession updates the DB with the miles from a session that just ended
+func saveSession(u User, sessionMiles float32) {
+	// some of the session may have been saved by CheckpointSession already
+	unsavedMiles := sessionMiles - u.checkpointedMiles
+	if unsavedMiles < 0 {
+		unsavedMiles = 0
+	}
+
 	// update miles
-	u.Miles = u.CurrentMiles()
+	u.Miles += unsavedMiles
+	u.checkpointedMiles += unsavedMiles
 	// update the last seen date
 	u.LastSeen = time.Now()
 	// store the user in the db
 	u.save()
+	InvalidateLeaderboard()
 
 	// update the monthly scoreboard
-	u.AddToScore(scoreboards.CurrentMilesScoreboard(), sessionMiles)
+	u.AddToScore(scoreboards.CurrentMilesScoreboard(), unsavedMiles)
 
-	// create a login event as well
-	events.Logout(u.Username)
+	// add the rest of their session miles to their spendable balance
+	u.creditSessionMiles(sessionMiles)
 
-	// remove them from the session
-	delete(LoggedIn, u.Username)
-}
-
-// isLoggedIn checks if the user is currently logged in
-func isLoggedIn(username string) bool {
-	if _, ok := LoggedIn[username]; ok {
-		return true
+	if sessionMiles > 0 {
+		events.Miles(u.Username, sessionMiles, "session")
 	}
-	return false
+
+	// the session ended normally, so there's nothing to recover
+	u.clearCheckpoint()
+
+	// create a logout event as well
+	events.Logout(u.Username)
 }
 
 // ShutDown loops through all of the logged-in users and logs them out
 func Shutdown() {
 	if c.Conf.Verbose {
 		log.Println("these were the logged-in users")
-		spew.Dump(LoggedIn)
+		spew.Dump(Session.Snapshot())
 	}
-	for _, user := range LoggedIn {
-		user.logout()
+	for _, username := range Session.Usernames() {
+		LogoutIfNecessary(username)
 	}
 }
 
 // GiveEveryoneMiles gives all logged-in users miles
 func GiveEveryoneMiles(gift float32) {
 	log.Println(aurora.Green("giving all logged-in users gift miles"))
-	for _, user := range LoggedIn {
-		user.Miles += gift
+	for _, user := range Session.Snapshot() {
+		Session.Update(user.Username, func(u *User) {
+			u.Miles += gift
+		})
+		events.Miles(user.Username, gift, "gift")
+		err := miles.Credit(user.ID, gift, "gift")
+		if err != nil {
+			terrors.Log(err, "error crediting gift miles")
+		}
 	}
 }
 
 // sortedUsernameList creates a list of only usernames, and sort it
 func sortedUsernameList() []string {
-	usernames := make([]string, 0, len(LoggedIn))
-	for username, _ := range LoggedIn {
-		usernames = append(usernames, username)
-	}
-	sort.Sort(sort.StringSlice(usernames))
-	return usernames
+	return Session.Usernames()
 }
 
 // colorizeUsernames loops over the sorted names and colorizes them
 func colorizeUsernames(usernames []string) []string {
 	coloredUsernames := make([]string, 0, len(usernames))
 	for _, username := range usernames {
-		user := *LoggedIn[username]
-		if user.IsBot {
+		user, ok := Session.Get(username)
+		if !ok || user.IsBot {
+			// they logged out or they're a bot,
 			// don't add them to the output
 			continue
 		}
@@ -195,9 +252,9 @@ func colorizeUsernames(usernames []string) []string {
 }
 
 // humans returns the users in the session who are not bots
-func humans() []*User {
-	var humans []*User
-	for _, user := range LoggedIn {
+func humans() []User {
+	var humans []User
+	for _, user := range Session.Snapshot() {
 		if !user.IsBot {
 			humans = append(humans, user)
 		}
@@ -211,9 +268,9 @@ func countHumans() int {
 }
 
 // bots returns the users in the session who are known bots
-func bots() []*User {
-	var bots []*User
-	for _, user := range LoggedIn {
+func bots() []User {
+	var bots []User
+	for _, user := range Session.Snapshot() {
 		if user.IsBot {
 			bots = append(bots, user)
 		}
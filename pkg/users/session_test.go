@@ -0,0 +1,84 @@
+package users
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/adanalife/tripbot/pkg/twitch"
+)
+
+// fakePresence makes UpdateSession use a FakePresence
+func fakePresence(t *testing.T) *twitch.FakePresence {
+	presence := &twitch.FakePresence{}
+	oldSource := twitch.CurrentPresenceSource
+	twitch.CurrentPresenceSource = presence
+	t.Cleanup(func() {
+		twitch.CurrentPresenceSource = oldSource
+	})
+	return presence
+}
+
+func TestUpdateSession(t *testing.T) {
+	logins, logouts := fakeSessions(t)
+	presence := fakePresence(t)
+
+	presence.Usernames = []string{"Alice", "bob"}
+	UpdateSession()
+	if got := Session.Usernames(); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Errorf("expected alice and bob to be logged in, got %v", got)
+	}
+
+	// bob leaves and carol shows up
+	presence.Usernames = []string{"alice", "carol"}
+	UpdateSession()
+	if got := Session.Usernames(); !reflect.DeepEqual(got, []string{"alice", "carol"}) {
+		t.Errorf("expected alice and carol to be logged in, got %v", got)
+	}
+	if *logins != 3 || *logouts != 1 {
+		t.Errorf("expected 3 logins and 1 logout, got %d and %d", *logins, *logouts)
+	}
+
+	// everyone leaves
+	presence.Usernames = nil
+	UpdateSession()
+	if Session.Len() != 0 {
+		t.Errorf("expected everyone to be logged out, got %v", Session.Usernames())
+	}
+	if *logouts != 3 {
+		t.Errorf("expected 3 logouts, got %d", *logouts)
+	}
+}
+
+func TestUpdateSessionKeepsSessionOnError(t *testing.T) {
+	logins, logouts := fakeSessions(t)
+	presence := fakePresence(t)
+
+	presence.Usernames = []string{"alice"}
+	UpdateSession()
+
+	// if we can't tell who is here, nobody should be logged out
+	presence.Err = errors.New("twitch is down")
+	UpdateSession()
+	if !Session.Contains("alice") {
+		t.Error("alice was logged out when the presence source failed")
+	}
+	if *logins != 1 || *logouts != 0 {
+		t.Errorf("expected 1 login and no logouts, got %d and %d", *logins, *logouts)
+	}
+}
+
+func TestLogoutForgetsBadges(t *testing.T) {
+	fakeSessions(t)
+
+	UpdateBadges("alice", map[string]int{"moderator": 1})
+	LoginIfNecessary("alice")
+	LogoutIfNecessary("alice")
+
+	rolesMutex.RLock()
+	_, ok := badges["alice"]
+	rolesMutex.RUnlock()
+	if ok {
+		t.Error("alice's badges were kept after logging out")
+	}
+}
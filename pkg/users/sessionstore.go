@@ -0,0 +1,149 @@
+package users
+
+import (
+	"sort"
+	"sync"
+)
+
+// SessionStore keeps track of the currently logged-in users. It is
+// used from cron jobs, IRC callbacks, and webhooks at the same time,
+// so all access goes through a lock. The store only ever hands out
+// copies of the users, changes have to go through Update(). Anything
+// that needs to loop over the users should use Snapshot() so the
+// lock isn't held while talking to the DB
+type SessionStore struct {
+	mu    sync.RWMutex
+	users map[string]*User
+
+	// transitions protects pending, it's only held long
+	// enough to check or change the map
+	transitions sync.Mutex
+	// pending are the users who are being logged in, logged out, or saved,
+	// the channel is closed when that's done. Only one of these can happen
+	// to a user at a time, but the DB work is done without holding a lock
+	// so a slow query doesn't hold up anyone else
+	pending map[string]chan struct{}
+}
+
+// NewSessionStore creates an empty SessionStore
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		users:   make(map[string]*User),
+		pending: make(map[string]chan struct{}),
+	}
+}
+
+// claim waits until nothing else is happening to the user, and marks
+// them as pending. The returned func has to be called when done
+func (s *SessionStore) claim(username string) func() {
+	for {
+		release, ok := s.tryClaim(username)
+		if ok {
+			return release
+		}
+		s.transitions.Lock()
+		done, ok := s.pending[username]
+		s.transitions.Unlock()
+		if ok {
+			<-done
+		}
+	}
+}
+
+// tryClaim is claim, but it gives up right away if the user is pending
+func (s *SessionStore) tryClaim(username string) (func(), bool) {
+	s.transitions.Lock()
+	defer s.transitions.Unlock()
+	if _, ok := s.pending[username]; ok {
+		return nil, false
+	}
+	done := make(chan struct{})
+	s.pending[username] = done
+	return func() {
+		s.transitions.Lock()
+		delete(s.pending, username)
+		s.transitions.Unlock()
+		close(done)
+	}, true
+}
+
+// Get returns a copy of the logged-in user with the given username
+func (s *SessionStore) Get(username string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[username]
+	if !ok {
+		return User{}, false
+	}
+	return *user, true
+}
+
+// Contains returns true if the user is logged in
+func (s *SessionStore) Contains(username string) bool {
+	_, ok := s.Get(username)
+	return ok
+}
+
+// Add puts a copy of the user in the session,
+// replacing anyone with the same username
+func (s *SessionStore) Add(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.Username] = &user
+}
+
+// Remove takes the user out of the session and returns them
+func (s *SessionStore) Remove(username string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return User{}, false
+	}
+	delete(s.users, username)
+	return *user, true
+}
+
+// Len returns the number of users in the session
+func (s *SessionStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Snapshot returns copies of the users in the session at this moment.
+// Changes to the session after this is called won't affect the result
+func (s *SessionStore) Snapshot() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	return users
+}
+
+// Usernames returns a sorted list of the usernames in the session
+func (s *SessionStore) Usernames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usernames := make([]string, 0, len(s.users))
+	for username := range s.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// Update runs fn on the logged-in user while holding the session lock,
+// it returns false if the user isn't logged in
+func (s *SessionStore) Update(username string, fn func(*User)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return false
+	}
+	fn(user)
+	return true
+}
@@ -0,0 +1,189 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+	terrors.Initialize(c.Conf)
+	os.Exit(m.Run())
+}
+
+// fakeSessions swaps out the DB work done on login and logout, it
+// returns how many times each was called
+func fakeSessions(t *testing.T) (logins, logouts *int32) {
+	logins, logouts = new(int32), new(int32)
+	oldSession, oldStart, oldEnd := Session, startSession, endSession
+	t.Cleanup(func() {
+		Session, startSession, endSession = oldSession, oldStart, oldEnd
+	})
+
+	// starting is used to catch two logins for the same user at once
+	var starting sync.Map
+	Session = NewSessionStore()
+	startSession = func(username string) User {
+		if _, loaded := starting.LoadOrStore(username, true); loaded {
+			t.Errorf("%s was logged in twice at the same time", username)
+		}
+		defer starting.Delete(username)
+		atomic.AddInt32(logins, 1)
+		// pretend to talk to the DB
+		time.Sleep(time.Millisecond)
+		return User{Username: username, LoggedIn: time.Now()}
+	}
+	endSession = func(u User, sessionMiles float32) {
+		atomic.AddInt32(logouts, 1)
+	}
+	return logins, logouts
+}
+
+func TestSnapshotReturnsCopies(t *testing.T) {
+	s := NewSessionStore()
+	s.Add(User{Username: "alice", Miles: 1})
+
+	for _, user := range s.Snapshot() {
+		user.Miles = 100
+	}
+	user, _ := s.Get("alice")
+	user.NumVisits = 100
+
+	user, ok := s.Get("alice")
+	if !ok {
+		t.Fatal("alice should be in the session")
+	}
+	if user.Miles != 1 || user.NumVisits != 0 {
+		t.Errorf("changing a copy changed the session: %+v", user)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := NewSessionStore()
+	s.Add(User{Username: "alice"})
+
+	if !s.Update("alice", func(u *User) { u.Miles = 5 }) {
+		t.Error("Update returned false for a logged-in user")
+	}
+	if s.Update("bob", func(u *User) { u.Miles = 5 }) {
+		t.Error("Update returned true for a user who isn't logged in")
+	}
+	if user, _ := s.Get("alice"); user.Miles != 5 {
+		t.Errorf("expected 5 miles, got %v", user.Miles)
+	}
+}
+
+func TestSessionStoreConcurrentAccess(t *testing.T) {
+	s := NewSessionStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		username := fmt.Sprintf("user%d", i%4)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				s.Add(User{Username: username})
+				s.Update(username, func(u *User) { u.Miles++ })
+				for _, user := range s.Snapshot() {
+					user.Miles = -1
+				}
+				if user, ok := s.Get(username); ok && user.Miles < 0 {
+					t.Error("a snapshot changed the session")
+				}
+				s.Usernames()
+				s.Remove(username)
+			}
+		}()
+	}
+	wg.Wait()
+	if s.Len() != 0 {
+		t.Errorf("expected an empty session, got %v", s.Usernames())
+	}
+}
+
+func TestConcurrentLoginLogout(t *testing.T) {
+	logins, logouts := fakeSessions(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		username := fmt.Sprintf("user%d", i%4)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				user := LoginIfNecessary(username)
+				if user.Username != username {
+					t.Errorf("expected %s, got %s", username, user.Username)
+				}
+				user.SetLastLocationTime()
+				Session.Update(username, func(u *User) { u.Miles++ })
+				Session.Snapshot()
+				LogoutIfNecessary(username)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if Session.Len() != 0 {
+		t.Errorf("expected everyone to be logged out, got %v", Session.Usernames())
+	}
+	if *logins != *logouts {
+		t.Errorf("%d logins but %d logouts", *logins, *logouts)
+	}
+	if len(Session.pending) != 0 {
+		t.Errorf("logins were left pending: %v", Session.pending)
+	}
+}
+
+func TestLoginIfNecessaryOnlyLogsInOnce(t *testing.T) {
+	logins, _ := fakeSessions(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			LoginIfNecessary("alice")
+		}()
+	}
+	wg.Wait()
+
+	if *logins != 1 {
+		t.Errorf("expected 1 login, got %d", *logins)
+	}
+	if !Session.Contains("alice") {
+		t.Error("alice should be logged in")
+	}
+}
+
+func TestSlowLogoutOnlyBlocksThatUser(t *testing.T) {
+	fakeSessions(t)
+	LoginIfNecessary("alice")
+
+	// alice's logout gets stuck talking to the DB
+	stuck, unstick := make(chan struct{}), make(chan struct{})
+	endSession = func(u User, sessionMiles float32) {
+		close(stuck)
+		<-unstick
+	}
+	go LogoutIfNecessary("alice")
+	<-stuck
+
+	loggedIn := make(chan struct{})
+	go func() {
+		LoginIfNecessary("bob")
+		close(loggedIn)
+	}()
+	select {
+	case <-loggedIn:
+	case <-time.After(time.Second):
+		t.Error("bob couldn't log in while alice was logging out")
+	}
+	close(unstick)
+}
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"log"
+
+	c "github.com/adanalife/tripbot/pkg/config/tripbot"
+	"github.com/adanalife/tripbot/pkg/database"
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/events"
+	"github.com/adanalife/tripbot/pkg/twitch"
+	"github.com/lib/pq"
+)
+
+// UpdateSubscribers fetches the latest subscribers from Twitch
+// and stores them in the DB
+func UpdateSubscribers() {
+	if err := twitch.GetSubscribers(); err != nil {
+		// don't prune anyone based on a partial list
+		return
+	}
+	subs := twitch.Subscribers()
+	usernames := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		SaveSubscriber(sub)
+		usernames = append(usernames, sub.Username)
+	}
+	pruneSubscribers(usernames)
+}
+
+// pruneSubscribers removes the subscriptions that have expired
+// (everyone in the DB who isn't in the latest list)
+func pruneSubscribers(current []string) {
+	if c.Conf.ReadOnly {
+		return
+	}
+	query := `DELETE FROM subscribers USING users
+		WHERE subscribers.user_id = users.id AND NOT (users.username = ANY($1))`
+	res, err := database.Connection().Exec(query, pq.Array(current))
+	if err != nil {
+		terrors.Log(err, "error removing expired subscribers")
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Println("removed", n, "expired subscribers")
+	}
+}
+
+// NewSubscription saves a sub that just happened (as opposed to one
+// we found out about from the Twitch API) and records it as an event
+func NewSubscription(sub twitch.Subscriber) error {
+	// update the internal subscriber list so we don't have
+	// to wait for the Twitch API to catch up
+	twitch.AddSubscriber(sub)
+
+	events.Subscribe(sub.Username, events.SubscribePayload{
+		Tier:             sub.Tier,
+		IsGift:           sub.IsGift,
+		Gifter:           sub.Gifter,
+		CumulativeMonths: sub.CumulativeMonths,
+	})
+	return SaveSubscriber(sub)
+}
+
+// SaveSubscriber stores the subscription details in the DB.
+// Cumulative months only ever go up, since they aren't included
+// when we get the list of subscribers from the Twitch API
+func SaveSubscriber(sub twitch.Subscriber) error {
+	user := FindOrCreate(sub.Username)
+	query := `INSERT INTO subscribers (user_id, tier, is_gift, gifter, cumulative_months)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			tier = EXCLUDED.tier,
+			is_gift = EXCLUDED.is_gift,
+			gifter = EXCLUDED.gifter,
+			cumulative_months = GREATEST(subscribers.cumulative_months, EXCLUDED.cumulative_months),
+			date_updated = CURRENT_TIMESTAMP`
+	_, err := database.Connection().Exec(query, user.ID, sub.Tier, sub.IsGift, sub.Gifter, sub.CumulativeMonths)
+	if err != nil {
+		terrors.Log(err, "error saving subscriber")
+		return err
+	}
+	if c.Conf.Verbose {
+		log.Printf("saved subscriber %s (tier %d)", user, sub.Tier)
+	}
+	return nil
+}
+
+// SubscriberTier returns the tier of the user's subscription,
+// or 0 if they aren't a subscriber
+func (u User) SubscriberTier() int {
+	tier := twitch.SubscriberTier(u.Username)
+	// the badge doesn't tell us the tier, so
+	// assume tier 1 until the list catches up
+	if tier == 0 && hasSubscriberBadge(u.Username) {
+		return 1
+	}
+	return tier
+}
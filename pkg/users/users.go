@@ -6,6 +6,7 @@ import (
 
 	terrors "github.com/adanalife/tripbot/pkg/errors"
 	"github.com/adanalife/tripbot/pkg/helpers"
+	"github.com/adanalife/tripbot/pkg/miles"
 	"github.com/adanalife/tripbot/pkg/scoreboards"
 	"github.com/adanalife/tripbot/pkg/twitch"
 	"github.com/logrusorgru/aurora"
@@ -27,53 +28,101 @@ type User struct {
 	LoggedIn     time.Time
 	lastCmd      time.Time
 	lastLocation time.Time
+	streakDays   int
+	// creditedMiles are the session miles already added to the ledger
+	creditedMiles float32
+	// checkpointedMiles are the session miles already added to Miles
+	// (and the monthly scoreboard) by CheckpointSession
+	checkpointedMiles float32
+	// bonusMiles are the bonus miles earned up until bonusAccruedAt,
+	// each checkpoint adds the bonus using the rules active at the time
+	bonusMiles     float32
+	bonusAccruedAt time.Time
+	// follower is cached for the session so we don't
+	// have to ask Twitch every time the miles are counted
+	follower        bool
+	followerChecked bool
 }
 
 // this is how long they have before they can guess again
 var guessCooldown = 3 * time.Minute
 
-func (u User) loggedInDur() time.Duration {
-	// exit early if they're not logged in
-	if !isLoggedIn(u.Username) {
-		return 0 * time.Second
-	}
-	// lookup the user in the session so the LoggedIn value is current
-	return time.Now().Sub(LoggedIn[u.Username].LoggedIn)
-}
-
 func (u User) sessionMiles() float32 {
-	// exit early if they're not logged in
-	if !isLoggedIn(u.Username) {
+	// lookup the user in the session so the bonus is current
+	user, ok := Session.Get(u.Username)
+	if !ok {
 		return 0.0
 	}
-	loggedInDur := u.loggedInDur()
-	sessionMiles := helpers.DurationToMiles(loggedInDur)
-	// give subscribers a miles bonus
-	if u.IsSubscriber() {
-		bonusMiles := u.BonusMiles()
-		if c.Conf.Verbose {
-			log.Println(u.String(), "will get", aurora.Green(bonusMiles), "bonus miles")
-		}
-		sessionMiles += bonusMiles
+	return user.sessionMilesAt(time.Now())
+}
+
+// sessionMilesAt returns the miles earned this session up until the given time,
+// u has to be the current copy of the user from the session
+func (u User) sessionMilesAt(now time.Time) float32 {
+	sessionMiles := helpers.DurationToMiles(now.Sub(u.LoggedIn))
+	// add any bonuses from the miles rules
+	bonusMiles := u.bonusMilesAt(now)
+	if bonusMiles != 0 && c.Conf.Verbose {
+		log.Println(u.String(), "will get", aurora.Green(bonusMiles), "bonus miles")
 	}
-	return sessionMiles
+	return sessionMiles + bonusMiles
 }
 
 func (u User) CurrentMiles() float32 {
-	return u.Miles + u.sessionMiles()
+	return u.Miles + u.uncheckpointedMiles()
+}
+
+// uncheckpointedMiles returns the session miles that haven't been saved yet
+func (u User) uncheckpointedMiles() float32 {
+	user, ok := Session.Get(u.Username)
+	if !ok {
+		return 0.0
+	}
+	remaining := user.sessionMilesAt(time.Now()) - user.checkpointedMiles
+	if remaining < 0 {
+		return 0.0
+	}
+	return remaining
 }
 
+// BonusMiles returns the extra miles earned this session
+// from the active miles rules
 func (u User) BonusMiles() float32 {
-	if isLoggedIn(u.Username) {
-		loggedInDur := u.loggedInDur()
-		sessionMiles := helpers.DurationToMiles(loggedInDur)
-		return sessionMiles * 0.05
+	user, ok := Session.Get(u.Username)
+	if !ok {
+		return 0.0
+	}
+	return user.bonusMilesAt(time.Now())
+}
+
+// bonusMilesAt returns the bonus miles earned up until the given time. The
+// miles since the last checkpoint use the rules that are active right now
+func (u User) bonusMilesAt(now time.Time) float32 {
+	since := u.LoggedIn
+	if u.bonusAccruedAt.After(since) {
+		since = u.bonusAccruedAt
+	}
+	unaccrued := helpers.DurationToMiles(now.Sub(since))
+	return u.bonusMiles + unaccrued*(miles.Multiplier(u.milesFacts())-1.0)
+}
+
+// ActiveMilesRules returns the miles rules that currently apply to the user
+func (u User) ActiveMilesRules() []miles.Rule {
+	return miles.ActiveRules(u.milesFacts())
+}
+
+// milesFacts returns what the miles rules need to know about the user
+func (u User) milesFacts() miles.Facts {
+	return miles.Facts{
+		IsSubscriber:   u.IsSubscriber,
+		SubscriberTier: u.SubscriberTier,
+		IsFollower:     u.IsFollower,
+		StreakDays:     func() int { return u.streakDays },
 	}
-	return 0.0
 }
 
 func (u User) CurrentMonthlyMiles() float32 {
-	return u.GetScore(scoreboards.CurrentMilesScoreboard()) + u.sessionMiles()
+	return u.GetScore(scoreboards.CurrentMilesScoreboard()) + u.uncheckpointedMiles()
 }
 
 // User.save() will take the given user and store it in the DB
@@ -88,14 +137,31 @@ func (u User) save() {
 	}
 }
 
-// IsFollower returns true if the user is a follower
+// IsFollower returns true if the user is a follower, we only
+// ask Twitch once per session
 func (u User) IsFollower() bool {
-	return twitch.UserIsFollower(u.Username)
+	if user, ok := Session.Get(u.Username); ok && user.followerChecked {
+		return user.follower
+	}
+	follower, err := twitch.FollowerStatus(u.Username)
+	if err != nil {
+		// try again next time
+		return false
+	}
+	Session.Update(u.Username, func(u *User) {
+		u.follower = follower
+		u.followerChecked = true
+	})
+	return follower
 }
 
-// IsSubscriber returns true if the user is a subscriber
-func (u User) IsSubscriber() bool {
-	return twitch.UserIsSubscriber(u.Username)
+// NewFollower records that the user just followed the channel,
+// so the cached follower status is up to date
+func NewFollower(username string) {
+	Session.Update(username, func(u *User) {
+		u.follower = true
+		u.followerChecked = true
+	})
 }
 
 // User.String prints a colored version of the user
@@ -138,19 +204,24 @@ func Find(username string) User {
 // unless they are a follower in which case they can run
 // as many as they like
 func (u *User) HasCommandAvailable() bool {
-	// followers get unlimited commands
-	if u.IsFollower() {
+	// subscribers, VIPs, mods, and followers get unlimited commands
+	if u.Role() > RoleViewer || u.IsFollower() {
 		return true
 	}
 	// check if they ran a command in the last 24 hrs
 	now := time.Now()
-	if now.Sub(u.lastCmd) > 24*time.Hour {
+	var available bool
+	u.update(func(u *User) {
+		if now.Sub(u.lastCmd) > 24*time.Hour {
+			// update their lastCmd time
+			u.lastCmd = now
+			available = true
+		}
+	})
+	if available {
 		log.Println("letting", u, "run a command")
-		// update their lastCmd time
-		u.lastCmd = now
-		return true
 	}
-	return false
+	return available
 }
 
 // GuessCooldownRemaining returns the amount of time a user needs to
@@ -181,7 +252,22 @@ func (u *User) HasGuessCommandAvailable(lastTimewarpTime time.Time) bool {
 }
 
 func (u *User) SetLastLocationTime() {
-	u.lastLocation = time.Now()
+	now := time.Now()
+	u.update(func(u *User) {
+		u.lastLocation = now
+	})
+}
+
+// update makes a change to the user in the session, and to this copy of
+// them as well. If they aren't logged in only this copy is changed
+func (u *User) update(fn func(*User)) {
+	updated := Session.Update(u.Username, func(current *User) {
+		fn(current)
+		*u = *current
+	})
+	if !updated {
+		fn(u)
+	}
 }
 
 //TODO: maybe return an err here?
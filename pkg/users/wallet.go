@@ -0,0 +1,64 @@
+package users
+
+import (
+	terrors "github.com/adanalife/tripbot/pkg/errors"
+	"github.com/adanalife/tripbot/pkg/miles"
+)
+
+// SpendableMiles returns the miles the user is able to spend,
+// including the ones they've earned so far this session
+func (u *User) SpendableMiles() float32 {
+	u.lockedCreditSessionMiles()
+	balance, err := miles.Balance(u.ID)
+	if err != nil {
+		return 0.0
+	}
+	return balance
+}
+
+// SpendMiles removes miles from the user's spendable balance
+func (u *User) SpendMiles(amount float32, reason string) error {
+	u.lockedCreditSessionMiles()
+	return miles.Spend(u.ID, amount, reason)
+}
+
+// RefundMiles gives back miles that were spent on something that didn't work
+func (u *User) RefundMiles(amount float32, reason string) {
+	err := miles.Credit(u.ID, amount, "refund: "+reason)
+	if err != nil {
+		terrors.Log(err, "error refunding miles")
+	}
+}
+
+// lockedCreditSessionMiles is creditSessionMiles for use outside of
+// login/logout, it makes sure CheckpointSession isn't crediting at the same time
+func (u *User) lockedCreditSessionMiles() {
+	release := Session.claim(u.Username)
+	defer release()
+	current, ok := Session.Get(u.Username)
+	if !ok {
+		return
+	}
+	credited := current.creditSessionMiles(current.sessionMiles())
+	if credited > 0 {
+		u.update(func(u *User) {
+			u.creditedMiles += credited
+		})
+	}
+}
+
+// creditSessionMiles adds any session miles that haven't been
+// added to the user's spendable balance yet, and returns the
+// amount that was added
+func (u User) creditSessionMiles(sessionMiles float32) float32 {
+	uncredited := sessionMiles - u.creditedMiles
+	if uncredited <= 0 {
+		return 0.0
+	}
+	err := miles.Credit(u.ID, uncredited, "session")
+	if err != nil {
+		terrors.Log(err, "error crediting session miles")
+		return 0.0
+	}
+	return uncredited
+}
@@ -220,6 +220,34 @@ func onscreensLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func onscreensGeoGuessHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	switch vars["action"] {
+	case "show":
+		base64content, ok := r.URL.Query()["content"]
+		if !ok || len(base64content) > 1 {
+			http.Error(w, "417 expectation failed", http.StatusExpectationFailed)
+			return
+		}
+		content, err := helpers.Base64Decode(base64content[0])
+		if err != nil {
+			terrors.Log(err, "unable to decode string")
+			http.Error(w, "422 unprocessable entity", http.StatusUnprocessableEntity)
+			return
+		}
+
+		onscreensServer.ShowGeoGuess(content)
+		fmt.Fprintf(w, "OK")
+	case "hide":
+		onscreensServer.GeoGuess.Hide()
+		fmt.Fprintf(w, "OK")
+	default:
+		http.Error(w, "417 expectation failed", http.StatusExpectationFailed)
+		return
+	}
+}
+
 func faviconHandler(w http.ResponseWriter, r *http.Request) {
 	//	// return a favicon if anyone asks for one
 	//} else if r.URL.Path == "/favicon.ico" {
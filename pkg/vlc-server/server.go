@@ -50,6 +50,7 @@ func Start() {
 	osc.HandleFunc("/gps/{action}", onscreensGpsHandler)
 	osc.HandleFunc("/gps/{action}", onscreensGpsHandler)
 	osc.HandleFunc("/leaderboard/{action}", onscreensLeaderboardHandler)
+	osc.HandleFunc("/geoguess/{action}", onscreensGeoGuessHandler)
 	osc.HandleFunc("/middle/{action}", onscreensMiddleHandler)
 	osc.HandleFunc("/middle/{action}", onscreensMiddleHandler)
 	osc.HandleFunc("/timewarp/{action}", onscreensTimewarpHandler)
@@ -0,0 +1,162 @@
+package main
+
+// this posts signed EventSub payloads to a locally-running tripbot,
+// so we can test the EventSub handler without Twitch
+//
+// usage:
+//   TWITCH_EVENTSUB_SECRET=hunter2hunter2 go run script/mock-eventsub/mock-eventsub.go -type channel.cheer -user someone
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	url       = flag.String("url", "http://localhost:8080/webhooks/twitch/eventsub", "the EventSub callback URL")
+	secret    = flag.String("secret", os.Getenv("TWITCH_EVENTSUB_SECRET"), "the EventSub secret")
+	eventType = flag.String("type", "channel.follow", "the event type to send, or \"verification\" or \"revocation\"")
+	username  = flag.String("user", "testuser", "the user the event comes from")
+	messageID = flag.String("id", "", "the message ID to use (defaults to random, reuse one to test de-duplication)")
+	badSig    = flag.Bool("bad-signature", false, "send an invalid signature")
+)
+
+// these are used as the broadcaster in the mock events
+var channelID = "12345"
+var channelName = "tripbot"
+
+// mockEvents contains an example event for each of the types we handle
+var mockEvents = map[string]map[string]interface{}{
+	"channel.follow": {
+		"user_login": "%s",
+	},
+	"channel.subscribe": {
+		"user_login": "%s",
+		"tier":       "1000",
+		"is_gift":    false,
+	},
+	"channel.subscription.gift": {
+		"user_login":   "%s",
+		"tier":         "1000",
+		"total":        5,
+		"is_anonymous": false,
+	},
+	"channel.subscription.message": {
+		"user_login":       "%s",
+		"tier":             "2000",
+		"cumulative_total": 12,
+	},
+	"channel.cheer": {
+		"user_login":   "%s",
+		"bits":         100,
+		"is_anonymous": false,
+	},
+	"channel.raid": {
+		"from_broadcaster_user_login": "%s",
+		"viewers":                     42,
+	},
+	"channel.channel_points_custom_reward_redemption.add": {
+		"user_login": "%s",
+		"user_input": "",
+		"reward":     map[string]interface{}{"title": "Timewarp"},
+	},
+}
+
+func main() {
+	flag.Parse()
+	rand.Seed(time.Now().UnixNano())
+
+	if *messageID == "" {
+		*messageID = fmt.Sprintf("mock-%d", rand.Int63())
+	}
+
+	messageType := "notification"
+	subType := *eventType
+	switch *eventType {
+	case "verification":
+		messageType = "webhook_callback_verification"
+		subType = "channel.follow"
+	case "revocation":
+		messageType = "revocation"
+		subType = "channel.follow"
+	}
+
+	payload := map[string]interface{}{
+		"subscription": map[string]interface{}{
+			"id":      "mock-subscription",
+			"type":    subType,
+			"version": "1",
+			"status":  "enabled",
+		},
+	}
+
+	switch messageType {
+	case "webhook_callback_verification":
+		payload["challenge"] = "mock-challenge"
+	case "revocation":
+		payload["subscription"].(map[string]interface{})["status"] = "authorization_revoked"
+	default:
+		event, ok := mockEvents[subType]
+		if !ok {
+			log.Fatalf("unknown event type %s", subType)
+		}
+		for k, v := range event {
+			if v == "%s" {
+				event[k] = *username
+			}
+		}
+		event["broadcaster_user_id"] = channelID
+		event["broadcaster_user_login"] = channelName
+		payload["event"] = event
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	signature := sign(*secret, *messageID, timestamp, body)
+	if *badSig {
+		signature = sign("not-the-secret", *messageID, timestamp, body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Twitch-Eventsub-Message-Id", *messageID)
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", signature)
+	req.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	log.Printf("sent %s %s (id: %s)", messageType, subType, *messageID)
+	log.Printf("got %d: %s", resp.StatusCode, respBody)
+}
+
+// sign creates the signature the same way Twitch does
+func sign(secret, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}